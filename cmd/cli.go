@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/database/postgres"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/oauth"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/events"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/keys"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/rbac"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/exp/slog"
+)
+
+// command is a CLI subcommand. Subcommands with their own subcommands
+// ("user create") are dispatched by their run function.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"serve":   {usage: "serve                     start the HTTP servers (default)", run: runServe},
+	"migrate": {usage: "migrate                   apply database schema migrations", run: runMigrate},
+	"user":    {usage: "user <action> --email     create [--verified], verify, disable --reason, enable [--cancel-deletion] or delete [--yes] an account, show or set its roles [--role] [--permission]", run: runUser},
+	"tokens":  {usage: "tokens revoke --user      revoke all sessions of a user, given by email or ID", run: runTokens},
+	"keys":    {usage: "keys rotate               create a new signing key and retire the previous one", run: runKeys},
+	"config":  {usage: "config check              validate the configuration file", run: runConfig},
+	"clients": {usage: "clients <action>          create --name --redirect-uri|--machine [--scope] [--public] [--public-key], list or delete --id OAuth clients", run: runClients},
+}
+
+// runCommand runs the named subcommand with the remaining arguments.
+func runCommand(name string, args []string) error {
+	if name == "help" {
+		printUsage()
+		return nil
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return cmd.run(args)
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: kidneysmart-auth <command> [flags]\n\nCommands:")
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nEvery command accepts --config (env KSA_CONFIG).")
+}
+
+// cliEnv is what the operational commands share: the validated configuration,
+// a logger writing to stderr and the repositories.
+type cliEnv struct {
+	cfg     *config.Config
+	lg      *slog.Logger
+	store   *repository.Store
+	audit   *audit.Recorder
+	actorID string
+	close   func(ctx context.Context) error
+}
+
+// openCLIEnv loads the configuration named by --config and connects to the database.
+func openCLIEnv(fs *flag.FlagSet, args []string) (*cliEnv, error) {
+	configFile := configFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	lg := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	store, closeStorage := setupStorage(cfg, lg, nil)
+	return &cliEnv{
+		cfg:     cfg,
+		lg:      lg,
+		store:   store,
+		audit:   audit.NewRecorder(store.Audit, lg),
+		actorID: "cli:" + currentUser(),
+		close:   closeStorage,
+	}, nil
+}
+
+// record appends an operator action to the audit log.
+func (e *cliEnv) record(ctx context.Context, action string, u *db.AuthUser, details map[string]string) {
+	e.audit.Record(ctx, audit.Event{
+		Action:  audit.AdminPrefix + action,
+		Outcome: audit.OutcomeSuccess,
+		ActorID: e.actorID,
+		UserID:  u.ID.Hex(),
+		Email:   u.Email,
+		Details: details,
+	})
+}
+
+// currentUser returns the name of the operating system user running the command.
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configFile := configFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if cfg.Database.Driver != config.DriverPostgres {
+		// MongoDB has no schema; setupMongo converts documents of earlier versions
+		_, closeStorage := setupStorage(cfg, slog.New(slog.NewTextHandler(os.Stderr, nil)), nil)
+		if err := closeStorage(ctx); err != nil {
+			return err
+		}
+		fmt.Println("Migrations applied")
+		return nil
+	}
+
+	conn, err := postgres.GetDB(ctx, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := postgres.Migrate(ctx, conn); err != nil {
+		return err
+	}
+	fmt.Println("Migrations applied")
+	return nil
+}
+
+func runUser(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: user create|verify|disable|enable|delete|roles --email addr")
+	}
+	action, args := args[0], args[1:]
+	switch action {
+	case "create", "verify", "disable", "enable", "delete", "roles":
+	default:
+		return fmt.Errorf("unknown user command %q", action)
+	}
+
+	fs := flag.NewFlagSet("user "+action, flag.ExitOnError)
+	email := fs.String("email", "", "email address of the account")
+	verified := fs.Bool("verified", false, "create: mark the email address as verified")
+	yes := fs.Bool("yes", false, "delete: confirm the deletion")
+	reason := fs.String("reason", "", "disable, enable: reason for the status change, required by disable")
+	cancelDeletion := fs.Bool("cancel-deletion", false, "enable: cancel the scheduled deletion of the account")
+	var roleList, permissionList stringList
+	fs.Var(&roleList, "role", "roles: role to assign ("+strings.Join(rbac.Roles(), ", ")+"), may be repeated")
+	fs.Var(&permissionList, "permission", "roles: scope granted in addition to the roles, may be repeated")
+	env, err := openCLIEnv(fs, args)
+	if err != nil {
+		return err
+	}
+	defer env.close(context.Background())
+
+	if *email == "" {
+		return errors.New("--email is required")
+	}
+	if !utils.ValidateEmail(*email) {
+		return fmt.Errorf("invalid email address %q", *email)
+	}
+
+	ctx := context.Background()
+	users := env.store.Users
+
+	if action == "create" {
+		if _, err := users.FindByEmail(ctx, *email); err == nil {
+			return fmt.Errorf("user %s already exists", *email)
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		if err := users.Create(ctx, *email, utils.GenerateRandomCode()); err != nil {
+			return err
+		}
+		if *verified {
+			if err := users.SetEmailVerified(ctx, *email); err != nil {
+				return err
+			}
+		}
+		u, err := users.FindByEmail(ctx, *email)
+		if err != nil {
+			return err
+		}
+		env.record(ctx, audit.ActionUserCreate, u, map[string]string{"verified": fmt.Sprint(*verified)})
+		fmt.Printf("Created user %s (%s)\n", u.Email, u.ID.Hex())
+		return nil
+	}
+
+	u, err := users.FindByEmail(ctx, *email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("user %s not found", *email)
+	} else if err != nil {
+		return err
+	}
+
+	switch action {
+	case "verify":
+		if err := users.SetEmailVerified(ctx, u.Email); err != nil {
+			return err
+		}
+		env.record(ctx, audit.ActionUserVerify, u, nil)
+		fmt.Printf("Verified user %s\n", u.Email)
+
+	case "disable":
+		if *reason == "" {
+			return errors.New("--reason is required")
+		}
+		if u.AccountStatus() == db.StatusPendingDeletion {
+			return fmt.Errorf("user %s is scheduled for deletion", u.Email)
+		}
+		revoked, err := account.Suspend(ctx, users, env.store.Tokens, u, *reason)
+		if err != nil {
+			return err
+		}
+		env.record(ctx, audit.ActionUserDisable, u, map[string]string{"reason": *reason, "revokedSessions": fmt.Sprint(revoked)})
+		fmt.Printf("Suspended user %s, revoked %d sessions\n", u.Email, revoked)
+
+	case "enable":
+		if u.AccountStatus() == db.StatusPendingDeletion && !*cancelDeletion {
+			return fmt.Errorf("user %s is scheduled for deletion, pass --cancel-deletion to cancel it", u.Email)
+		}
+		if err := account.Reactivate(ctx, users, u, *reason); err != nil {
+			return err
+		}
+		env.record(ctx, audit.ActionUserEnable, u, map[string]string{"reason": *reason, "previousStatus": u.AccountStatus()})
+		fmt.Printf("Enabled user %s\n", u.Email)
+
+	case "delete":
+		if !*yes {
+			return fmt.Errorf("deleting %s cannot be undone, pass --yes to confirm", u.Email)
+		}
+		// Как и janitor: событие account.deleted, анонимизация аудита и удаление всех данных пользователя
+		purger := account.NewPurger(users, env.store.Maintenance, events.NewWebhookPublisher(env.cfg.Events, env.lg), env.audit, env.cfg.Account.AuditPseudonymKey, env.lg)
+		pseudonym, err := purger.Purge(ctx, u, audit.AdminPrefix+audit.ActionUserDelete, env.actorID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Deleted user %s, recorded in the audit log as %s\n", u.Email, pseudonym)
+
+	case "roles":
+		// Без --role и --permission выводятся текущие роли; так назначается первый администратор
+		if len(roleList) == 0 && len(permissionList) == 0 {
+			fmt.Printf("Roles of %s: %s\nScopes: %s\n", u.Email,
+				strings.Join(rbac.EffectiveRoles(u), " "), strings.Join(rbac.Scopes(u), " "))
+			return nil
+		}
+		for _, role := range roleList {
+			if !rbac.ValidRole(role) {
+				return fmt.Errorf("unknown role %q, expected one of %s", role, strings.Join(rbac.Roles(), ", "))
+			}
+		}
+		for _, permission := range permissionList {
+			if !rbac.ValidScope(permission) {
+				return fmt.Errorf("invalid permission %q", permission)
+			}
+		}
+		updated := *u
+		updated.Roles = rbac.Normalize(roleList)
+		updated.Permissions = rbac.Normalize(permissionList)
+		if err := users.SetRoles(ctx, u.Email, updated.Roles, updated.Permissions); err != nil {
+			return err
+		}
+		env.record(ctx, audit.ActionRolesUpdate, u, map[string]string{
+			"rolesBefore":       strings.Join(rbac.EffectiveRoles(u), " "),
+			"rolesAfter":        strings.Join(rbac.EffectiveRoles(&updated), " "),
+			"permissionsBefore": strings.Join(u.Permissions, " "),
+			"permissionsAfter":  strings.Join(updated.Permissions, " "),
+		})
+		fmt.Printf("Set roles of %s to %s; they apply from the next access token\n", u.Email, strings.Join(rbac.EffectiveRoles(&updated), " "))
+	}
+	return nil
+}
+
+func runTokens(args []string) error {
+	if len(args) == 0 || args[0] != "revoke" {
+		return errors.New("usage: tokens revoke --user email|id")
+	}
+
+	fs := flag.NewFlagSet("tokens revoke", flag.ExitOnError)
+	userRef := fs.String("user", "", "email address or ID of the user")
+	env, err := openCLIEnv(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	defer env.close(context.Background())
+
+	if *userRef == "" {
+		return errors.New("--user is required")
+	}
+
+	ctx := context.Background()
+	var u *db.AuthUser
+	if id, idErr := primitive.ObjectIDFromHex(*userRef); idErr == nil {
+		u, err = env.store.Users.FindByID(ctx, id)
+	} else {
+		u, err = env.store.Users.FindByEmail(ctx, *userRef)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("user %s not found", *userRef)
+	} else if err != nil {
+		return err
+	}
+
+	revoked, err := env.store.Tokens.RevokeByUser(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	env.record(ctx, audit.ActionSessionsRevoke, u, map[string]string{"revokedSessions": fmt.Sprint(revoked)})
+	fmt.Printf("Revoked %d sessions of %s\n", revoked, u.Email)
+	return nil
+}
+
+func runKeys(args []string) error {
+	if len(args) == 0 || args[0] != "rotate" {
+		return errors.New("usage: keys rotate")
+	}
+
+	fs := flag.NewFlagSet("keys rotate", flag.ExitOnError)
+	env, err := openCLIEnv(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	defer env.close(context.Background())
+
+	ctx := context.Background()
+	manager := keys.NewManager(env.store.Keys, env.cfg.Authentication.JWTSecret, refreshTokenLifetime(env.cfg), env.lg)
+	kid, err := manager.Rotate(ctx)
+	if err != nil {
+		return err
+	}
+	env.audit.Record(ctx, audit.Event{
+		Action:  audit.AdminPrefix + audit.ActionKeyRotate,
+		Outcome: audit.OutcomeSuccess,
+		ActorID: env.actorID,
+		Details: map[string]string{"kid": kid, "algorithm": keys.Algorithm},
+	})
+	fmt.Printf("Created signing key %s; running servers switch to it within %s\n", kid, keys.DefaultRefreshInterval)
+	return nil
+}
+
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("usage: config check [--config file]")
+	}
+
+	fs := flag.NewFlagSet("config check", flag.ExitOnError)
+	configFile := configFlag(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if _, err := config.Load(*configFile); err != nil {
+		return err
+	}
+	fmt.Printf("Configuration %s is valid\n", *configFile)
+	return nil
+}
+
+// stringList is a flag that can be repeated, e.g. --redirect-uri a --redirect-uri b.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runClients(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: clients create|list|delete")
+	}
+	action, args := args[0], args[1:]
+	switch action {
+	case "create", "list", "delete":
+	default:
+		return fmt.Errorf("unknown clients command %q", action)
+	}
+
+	fs := flag.NewFlagSet("clients "+action, flag.ExitOnError)
+	name := fs.String("name", "", "create: name shown to users on the consent page")
+	var redirectURIs stringList
+	fs.Var(&redirectURIs, "redirect-uri", "create: allowed redirect URI, may be repeated")
+	scope := fs.String("scope", "", "create: space separated scopes the client may request (default \"openid email profile\", required with --machine)")
+	public := fs.Bool("public", false, "create: register a public client without a secret (SPA, mobile app)")
+	machine := fs.Bool("machine", false, "create: register a machine client for the client_credentials grant (backend jobs)")
+	publicKeyFile := fs.String("public-key", "", "create: PEM public key file; the client authenticates with private_key_jwt instead of a secret")
+	id := fs.String("id", "", "delete: client ID")
+	env, err := openCLIEnv(fs, args)
+	if err != nil {
+		return err
+	}
+	defer env.close(context.Background())
+
+	ctx := context.Background()
+	clients := env.store.Clients
+
+	switch action {
+	case "list":
+		list, err := clients.List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, client := range list {
+			fmt.Printf("%s\t%s\t%s\tauth=%s\tscopes=%s\tredirect=%s\n", client.ID, client.Type, client.Name,
+				client.AuthMethod, strings.Join(client.AllowedScopes, " "), strings.Join(client.RedirectURIs, ","))
+		}
+		return nil
+
+	case "delete":
+		if *id == "" {
+			return errors.New("--id is required")
+		}
+		if err := clients.Delete(ctx, *id); errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("client %s not found", *id)
+		} else if err != nil {
+			return err
+		}
+		env.recordClient(ctx, audit.ActionClientDelete, *id, nil)
+		fmt.Printf("Deleted client %s\n", *id)
+		return nil
+	}
+
+	switch {
+	case *name == "":
+		return errors.New("--name is required")
+	case *public && *machine:
+		return errors.New("--public and --machine cannot be combined")
+	case *public && *publicKeyFile != "":
+		return errors.New("public clients do not authenticate, --public-key cannot be used")
+	case *machine && len(redirectURIs) > 0:
+		return errors.New("machine clients do not sign users in, --redirect-uri cannot be used")
+	case !*machine && len(redirectURIs) == 0:
+		return errors.New("at least one --redirect-uri is required")
+	case *machine && *scope == "":
+		return errors.New("--scope is required for machine clients, e.g. --scope \"labresults:write\"")
+	case *scope == "":
+		*scope = "openid email profile"
+	}
+	for _, uri := range redirectURIs {
+		if u, err := url.Parse(uri); err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			return fmt.Errorf("invalid redirect URI %q: must be absolute and without fragment", uri)
+		}
+	}
+	client := db.OAuthClient{
+		Name:          *name,
+		Type:          db.ClientTypeConfidential,
+		RedirectURIs:  redirectURIs,
+		AllowedScopes: strings.Fields(*scope),
+		CreatedAt:     time.Now().UTC(),
+	}
+	if client.ID, err = utils.GenerateOpaqueToken(16); err != nil {
+		return err
+	}
+	if *machine {
+		client.Type = db.ClientTypeMachine
+	}
+	var secret string
+	switch {
+	case *public:
+		client.Type = db.ClientTypePublic
+	case *publicKeyFile != "":
+		data, err := os.ReadFile(*publicKeyFile)
+		if err != nil {
+			return err
+		}
+		if _, err := oauth.ParseClientPublicKey(string(data)); err != nil {
+			return fmt.Errorf("invalid public key: %w", err)
+		}
+		client.AuthMethod, client.PublicKey = db.AuthMethodPrivateKeyJWT, string(data)
+	default:
+		if secret, err = utils.GenerateOpaqueToken(32); err != nil {
+			return err
+		}
+		client.AuthMethod, client.SecretHash = db.AuthMethodClientSecret, utils.HashOpaqueToken(secret)
+	}
+	if err := clients.Create(ctx, client); err != nil {
+		return err
+	}
+	env.recordClient(ctx, audit.ActionClientCreate, client.ID, map[string]string{
+		"name":       client.Name,
+		"type":       client.Type,
+		"authMethod": client.AuthMethod,
+		"scopes":     strings.Join(client.AllowedScopes, " "),
+	})
+
+	fmt.Printf("Created %s client %s\nclient_id:     %s\n", client.Type, client.Name, client.ID)
+	if secret != "" {
+		fmt.Printf("client_secret: %s\nThe secret is not stored and cannot be shown again.\n", secret)
+	}
+	return nil
+}
+
+// recordClient appends an operator action on an OAuth client to the audit log.
+func (e *cliEnv) recordClient(ctx context.Context, action, clientID string, details map[string]string) {
+	if details == nil {
+		details = map[string]string{}
+	}
+	details["clientId"] = clientID
+	e.audit.Record(ctx, audit.Event{
+		Action:  audit.AdminPrefix + action,
+		Outcome: audit.OutcomeSuccess,
+		ActorID: e.actorID,
+		Details: details,
+	})
+}
@@ -2,85 +2,212 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 
 	"net/http"
 
 	"os"
+	"strings"
 
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/a-dev-mobile/kidneysmart-auth/database/mongo"
+	"github.com/a-dev-mobile/kidneysmart-auth/database/postgres"
 	"github.com/a-dev-mobile/kidneysmart-auth/docs"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
 	"github.com/a-dev-mobile/kidneysmart-auth/pkg/emailclient"
-
+	authproto "github.com/a-dev-mobile/kidneysmart-auth/proto"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/admin/auditlog"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/admin/roles"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/admin/users"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/grpc/authservice"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/health"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/accountdeletion"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/introspect"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/oauth"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/userinfo"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/wellknown"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/password"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/login"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/verifycode"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/refresh_token"
 
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/events"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/grpcserver"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/janitor"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/keys"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/lifecycle"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/logging"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/metrics"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/requestid"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/tracing"
 
 	"golang.org/x/exp/slog"
 
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/middleware"
 
-	mongodriver "go.mongodb.org/mongo-driver/mongo"
-
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
-	cfg, lg := initializeApp()
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
 
-	// Set up the database connection
-	db, cleanup := setupDatabase(cfg, lg)
-	defer cleanup()
+	if err := runCommand(name, args); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// runServe starts the HTTP servers and blocks until the service is shut down.
+func runServe(args []string) error {
+	cfg, configFile, lg, closeLogger := initializeApp("serve", args)
+	lc := lifecycle.New(cfg.Lifecycle, lg)
+
+	// Reloadable settings are read through the holder; SIGHUP re-reads the file
+	cfgHolder := config.NewHolder(cfg)
+	reloader := config.NewReloader(configFile, cfgHolder, time.Duration(cfg.Reload.PollIntervalSeconds)*time.Second, lg)
+	reloader.OnReload(func(c *config.Config) { logging.SetLevel(c.Logging.Level) })
+	reloader.Start(context.Background())
+	m := metrics.New()
+
+	// Tracing is set up before any instrumented client is created
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, cfg.Environment)
+	if err != nil {
+		lg.Error("Failed to set up tracing", logging.Err(err))
+		os.Exit(1)
+	}
+
+	// Set up the storage backend
+	store, closeStorage := setupStorage(cfg, lg, m)
 	setGinMode(cfg)
 
+	// Signing keys are reloaded periodically so that rotations done through the CLI are picked up
+	signingKeys := keys.NewManager(store.Keys, cfg.Authentication.JWTSecret, refreshTokenLifetime(cfg), lg)
+	// Без ES256 ключа токены подписываются HS256 и не проверяются по JWKS
+	kid, created, err := signingKeys.EnsureKey(context.Background())
+	if err != nil {
+		lg.Error("Failed to create the initial signing key", logging.Err(err))
+		os.Exit(1)
+	}
+	if created {
+		lg.Info("Created the initial signing key", slog.String("kid", kid), slog.String("algorithm", keys.Algorithm))
+	}
+	signingKeys.Start(context.Background(), keys.DefaultRefreshInterval)
+
 	// Initialize gRPC connection to SMTP server with updated security settings
 	smtpConn, err := grpc.Dial(
 		cfg.ExternalService.SmtpServer.Grpc.Host+":"+cfg.ExternalService.SmtpServer.Grpc.Port,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),    // Updated to use WithTransportCredentials
 		grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(5<<20)), // Set max message size if needed
+		grpc.WithChainUnaryInterceptor(
+			m.EmailClientInterceptor(),         // Email send latency and failures
+			requestid.UnaryClientInterceptor(), // Forward X-Request-ID to the email sender
+		),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),           // Spans and trace context propagation
 	)
 	if err != nil {
 		lg.Error("Failed to connect to SMTP server:", logging.Err(err))
 		os.Exit(1)
 	}
-	defer smtpConn.Close()
 
 	emailClient := emailclient.NewEmailClient(smtpConn, lg)
 
+	// Security audit log shared by the handlers
+	recorder := audit.NewRecorder(store.Audit, lg)
+
+	// Start the background cleanup of expired tokens, abandoned sign-ups and deleted accounts
+	var jn *janitor.Janitor
+	if cfg.Janitor.Enabled {
+		auditRetention := time.Duration(cfg.Audit.RetentionDays) * 24 * time.Hour
+		purger := account.NewPurger(store.Users, store.Maintenance, events.NewWebhookPublisher(cfg.Events, lg), recorder, cfg.Account.AuditPseudonymKey, lg)
+		jn = janitor.New(store.Maintenance, store.Leases, purger, cfg.Janitor, auditRetention, lg)
+		jn.Start(context.Background())
+		m.RegisterJanitor(jn.Stats)
+	} else {
+		lg.Warn("Janitor is disabled, accounts pending deletion are not removed after the grace period")
+	}
+	m.RegisterActiveSessions(store.Tokens.CountActive, lg)
+
+	// Liveness and readiness probes
+	hctxHealth := health.NewHealthServiceContext(lg, lc.Ready, lc.ShuttingDown,
+		time.Duration(cfg.Lifecycle.ReadinessCheckTimeoutSeconds)*time.Second)
+	hctxHealth.AddCheck("database", store.Pinger.Ping)
+	hctxHealth.AddCheck("emailSender", health.GRPCConnCheck(smtpConn))
+	hctxHealth.AddCheck("signingKeys", health.SigningKeyCheck(signingKeys.Loaded))
+
 	// Set up your server's routes and handlers
-	router := setupRouter(cfg, lg)
+	router := setupRouter(cfg, cfgHolder, lg, hctxHealth, m)
 
 	// Create a new context for the Login handler including the email client
-	hctxLogin := login.NewLoginServiceContext(db, lg, cfg, emailClient)
+	hctxLogin := login.NewLoginServiceContext(store.Users, recorder, lg, cfg, emailClient)
 	router.POST("kidneysmart-auth/v1/login", hctxLogin.LoginUserHandler)
 	//
-	hctxVerifyCode := verifycode.NewVerifyCodeServiceContext(db, lg, cfg)
+	hctxVerifyCode := verifycode.NewVerifyCodeServiceContext(store.Users, store.Verifications, recorder, signingKeys, lg, cfg)
 	router.POST("kidneysmart-auth/v1/verify-code", hctxVerifyCode.VerifyCodeHandler)
 	//
 
-	 hctxRefreshToken := refreshtoken.NewRefreshTokenServiceContext(db, lg, cfg)
+	 hctxRefreshToken := refreshtoken.NewRefreshTokenServiceContext(store.Users, store.Tokens, recorder, signingKeys, lg, cfg)
 	 router.POST("kidneysmart-auth/v1/refresh-token", hctxRefreshToken.RefreshTokenHandler)
 	
 
 
 	// 
-	hctxPassword := password.NewPasswordServiceContext(db, lg, cfg)
+	hctxPassword := password.NewPasswordServiceContext(store.Users, recorder, lg, cfg)
 	// Применение AuthMiddleware к endpoint set-password
-	authMiddleware := middleware.AuthMiddleware(cfg.Authentication.JWTSecret)
+	authMiddleware := middleware.AuthMiddleware(signingKeys, store.Users)
 	router.POST("kidneysmart-auth/v1/set-password", authMiddleware, hctxPassword.PasswordHandler)
 
+	// Self-service account deletion with a grace period; the janitor removes the account afterwards
+	hctxAccountDeletion := accountdeletion.NewAccountDeletionServiceContext(store.Users, store.Tokens, recorder, emailClient, lg, cfg)
+	router.POST("kidneysmart-auth/v1/account/reauthenticate", authMiddleware, hctxAccountDeletion.ReauthenticateHandler)
+	router.DELETE("kidneysmart-auth/v1/account", authMiddleware, hctxAccountDeletion.DeleteAccountHandler)
+	router.POST("kidneysmart-auth/v1/account/deletion/cancel", hctxAccountDeletion.CancelDeletionHandler)
+
+	// Token verification for other services: public keys and introspection (pkg/authmw)
+	hctxWellKnown := wellknown.NewWellKnownServiceContext(signingKeys, cfg)
+	router.GET("kidneysmart-auth/.well-known/jwks.json", hctxWellKnown.JWKSHandler)
+	hctxIntrospect := introspect.NewIntrospectServiceContext(store.Users, signingKeys, lg)
+	router.POST("kidneysmart-auth/v1/introspect", hctxIntrospect.IntrospectHandler)
+	// Userinfo also serves OAuth clients; their tokens need the openid scope
+	hctxUserinfo := userinfo.NewUserinfoServiceContext(store.Users, lg)
+	tokenMiddleware := middleware.TokenMiddleware(signingKeys, store.Users)
+	router.GET("kidneysmart-auth/v1/userinfo", tokenMiddleware, hctxUserinfo.UserinfoHandler)
+	router.POST("kidneysmart-auth/v1/userinfo", tokenMiddleware, hctxUserinfo.UserinfoHandler)
+
+	// OAuth 2.0 authorization code flow with PKCE and OpenID Connect for third-party clients
+	if cfg.OAuth.Enabled {
+		router.GET("kidneysmart-auth/.well-known/openid-configuration", hctxWellKnown.OpenIDConfigurationHandler)
+		hctxOAuth := oauth.NewOAuthServiceContext(store, recorder, signingKeys, lg, cfg, emailClient)
+		router.GET("kidneysmart-auth/v1/oauth/authorize", hctxOAuth.AuthorizeHandler)
+		router.GET("kidneysmart-auth/v1/oauth/authorize/requests/:requestId", hctxOAuth.AuthorizationRequestHandler)
+		router.POST("kidneysmart-auth/v1/oauth/authorize/login", hctxOAuth.AuthorizeLoginHandler)
+		router.POST("kidneysmart-auth/v1/oauth/authorize/verify", hctxOAuth.AuthorizeVerifyHandler)
+		router.POST("kidneysmart-auth/v1/oauth/authorize/consent", hctxOAuth.AuthorizeConsentHandler)
+		router.POST("kidneysmart-auth/v1/oauth/token", hctxOAuth.TokenHandler)
+	}
+
 	// hctxLogin := login.NewLoginServiceContext(db, lg, cfg)
 	// router.POST("kidneysmart-auth/v1/login", hctxLogin.LoginUserHandler)
 
@@ -95,30 +222,92 @@ func main() {
 	docs.SwaggerInfo.Version = "v1"
 	router.GET("/kidneysmart-auth/v1/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 
-	startServer(cfg, router, lg)
+	srv := newServer(cfg, router)
+	servers := []func() error{
+		func() error { return serve(srv, lg) },
+	}
+
+	// Internal gRPC AuthService on its own port
+	var grpcSrv *grpcserver.Server
+	if cfg.GrpcConnection.Enabled {
+		grpcAuth := grpcserver.NewAuthenticator(signingKeys, cfg.GrpcConnection.Services, authproto.AuthService_IssueServiceToken_FullMethodName)
+		grpcSrv, err = grpcserver.New(cfg.GrpcConnection, grpcAuth, lg)
+		if err != nil {
+			return fmt.Errorf("grpc server: %w", err)
+		}
+		authproto.RegisterAuthServiceServer(grpcSrv.Server,
+			authservice.NewAuthServiceContext(store.Users, store.Tokens, recorder, signingKeys, lg, cfg))
+		servers = append(servers, grpcSrv.Serve)
+	}
+
+	hctxAuditLog := auditlog.NewAuditLogServiceContext(store.Audit, recorder, lg, cfg)
+	hctxRoles := roles.NewRolesServiceContext(store.Users, recorder, lg)
+	hctxUsers := users.NewUsersServiceContext(store.Users, store.Tokens, recorder, emailClient, lg)
+	adminSrv, err := newAdminServer(cfg, setupAdminRouter(m, signingKeys, cfg.AdminConnection.TLS.AllowedClientNames, hctxAuditLog, hctxUsers, hctxRoles))
+	if err != nil {
+		return fmt.Errorf("admin server: %w", err)
+	}
+	servers = append(servers, func() error { return serve(adminSrv, lg) })
+
+	// Shutdown hooks run in this order once SIGINT or SIGTERM is received
+	lc.OnShutdown("config reloader", reloader.Stop)
+	lc.OnShutdown("http server", srv.Shutdown)
+	lc.OnShutdown("admin server", adminSrv.Shutdown)
+	if grpcSrv != nil {
+		lc.OnShutdown("grpc server", grpcSrv.Shutdown)
+	}
+	if jn != nil {
+		lc.OnShutdown("janitor", jn.Stop)
+	}
+	lc.OnShutdown("signing keys", signingKeys.Stop)
+	lc.OnShutdown("smtp grpc connection", func(context.Context) error { return smtpConn.Close() })
+	lc.OnShutdown("database", closeStorage)
+	lc.OnShutdown("tracing", shutdownTracing)
+	lc.OnShutdown("logger", func(context.Context) error { return closeLogger() })
+
+	return lc.Run(servers...)
 }
 
 // initializeApp sets up the application environment, configuration, and logger.
 // It determines the application's running environment, loads the appropriate configuration,
 // and initializes the logging system.
-func initializeApp() (*config.Config, *slog.Logger) {
+func initializeApp(name string, args []string) (*config.Config, string, *slog.Logger, func() error) {
 
-	cfg := getConfigOrFail()
+	cfg, configFile := getConfigOrFail(name, args)
 
-	lg := logging.SetupLogger(cfg)
+	lg, closeLogger := logging.SetupLogger(cfg)
 
-	return cfg, lg
+	return cfg, configFile, lg, closeLogger
 }
 
-func getConfigOrFail() *config.Config {
+// defaultConfigFile is used when neither --config nor KSA_CONFIG is given.
+const defaultConfigFile = "../config/config.yaml"
+
+func getConfigOrFail(name string, args []string) (*config.Config, string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	configFile := configFlag(fs)
+	_ = fs.Parse(args)
 
-	cfg, err := config.LoadConfig("../config", "config.yaml")
+	cfg, err := config.Load(*configFile)
 
 	if err != nil {
 		log.Fatalf("Error loading config: %s", err)
 	}
 
-	return cfg
+	return cfg, *configFile
+}
+
+// configFlag registers the --config flag shared by all commands.
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", configFileFromEnv(), "path to the YAML configuration file (env KSA_CONFIG)")
+}
+
+// configFileFromEnv returns the configuration file named by KSA_CONFIG or the default one.
+func configFileFromEnv() string {
+	if file := os.Getenv(config.EnvPrefix + "CONFIG"); file != "" {
+		return file
+	}
+	return defaultConfigFile
 }
 
 // setGinMode configures the Gin mode (debug or release) based on the application's configuration.
@@ -131,76 +320,183 @@ func setGinMode(cfg *config.Config) {
 	}
 }
 
-// setupDatabase initializes the MongoDB database connection using the provided configuration and logger.
-// It returns a MongoDB client and a cleanup function to disconnect from the database.
-// setupDatabase initializes the MongoDB database connection using the provided configuration and logger.
-// It returns a MongoDB client and a cleanup function to disconnect from the database.
-func setupDatabase(cfg *config.Config, lg *slog.Logger) (*mongodriver.Client, func()) {
-	dbUser := cfg.Database.User
-	dbPassword := cfg.Database.Password
-	dbPort := cfg.Database.Port
-	dbHost := cfg.Database.Host
+// setupStorage connects to the database selected by cfg.Database.Driver and
+// returns the repositories backed by it together with a function that closes the connection.
+// m may be nil for commands that do not export metrics.
+func setupStorage(cfg *config.Config, lg *slog.Logger, m *metrics.Metrics) (*repository.Store, func(ctx context.Context) error) {
+	switch cfg.Database.Driver {
+	case config.DriverPostgres:
+		return setupPostgres(cfg, lg)
+	default:
+		return setupMongo(cfg, lg, m)
+	}
+}
 
-	db, err := mongo.GetDB(context.Background(), dbUser, dbPassword, dbHost, dbPort)
+// setupMongo initializes the MongoDB database connection using the provided configuration and logger.
+// It returns the MongoDB repositories and a function to disconnect from the database.
+func setupMongo(cfg *config.Config, lg *slog.Logger, m *metrics.Metrics) (*repository.Store, func(ctx context.Context) error) {
+	monitor := otelmongo.NewMonitor()
+	if m != nil {
+		monitor = mongo.ChainMonitors(m.MongoMonitor(), monitor)
+	}
+	monitoring := options.Client().SetMonitor(monitor)
+	db, err := mongo.GetDB(context.Background(), cfg.Database, lg, monitoring)
 	if err != nil {
 		lg.Error("Error initializing database", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
-	return db, func() {
-		if err := db.Disconnect(context.Background()); err != nil {
-			lg.Error("Error disconnecting from database", "error", err.Error())
-		}
+	if err := repository.MigrateMongo(context.Background(), db.Database(cfg.Database.Name), cfg.Database.Collections); err != nil {
+		lg.Error("Error migrating database", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	store := repository.NewMongoStore(db.Database(cfg.Database.Name), cfg.Database.Collections)
+	return store, db.Disconnect
+}
+
+// setupPostgres opens the PostgreSQL connection pool and applies pending migrations.
+// It returns the PostgreSQL repositories and a function to close the pool.
+func setupPostgres(cfg *config.Config, lg *slog.Logger) (*repository.Store, func(ctx context.Context) error) {
+	ctx := context.Background()
+
+	db, err := postgres.GetDB(ctx, cfg.Database)
+	if err != nil {
+		lg.Error("Error initializing database", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if err := postgres.Migrate(ctx, db); err != nil {
+		lg.Error("Error migrating database", slog.String("error", err.Error()))
+		os.Exit(1)
 	}
+	return repository.NewPostgresStore(db), func(context.Context) error { return db.Close() }
 }
 
 // setupRouter initializes and returns a new Gin router configured with middleware and routes.
-func setupRouter(cfg *config.Config, lg *slog.Logger) *gin.Engine {
+func setupRouter(cfg *config.Config, cfgHolder *config.Holder, lg *slog.Logger, hctxHealth *health.HealthServiceContext, m *metrics.Metrics) *gin.Engine {
 	// Create a new router
 	router := gin.New()
+	// X-Forwarded-For учитывается только от доверенных прокси, иначе клиент может подменить свой IP
+	if err := router.SetTrustedProxies(cfg.ClientConnection.TrustedProxies); err != nil {
+		lg.Error("Invalid trusted proxies", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
 	// Apply global middleware
 	router.Use(gin.Recovery()) // Recovery middleware от Gin
-	router.Use(gin.Logger())   // Logging middleware от Gin
-	router.Use(middleware.CORSMiddleware(*cfg, lg))
+	router.Use(middleware.RequestID())
+	router.Use(otelgin.Middleware(serviceName(cfg)))
+
+	// Probes are registered before the CORS and logging middleware:
+	// orchestrators and load balancers send no Origin header.
+	router.GET("/healthz", hctxHealth.LivenessHandler)
+	router.GET("/readyz", hctxHealth.ReadinessHandler)
+
+	router.Use(middleware.AccessLog(cfgHolder, lg))
+	router.Use(m.HTTPMiddleware())
+	router.Use(middleware.ErrorAnnotations())
+	router.Use(middleware.CORSMiddleware(cfgHolder, lg))
 	router.Use(middleware.TrustProxyHeader())
-	router.Use(middleware.LogHeaders())
 	// Adding custom middleware to recover from a panic
 	router.Use(middleware.RecoveryMiddleware(lg))
 
 	return router
 }
 
-// startServer starts the HTTP server using the provided configuration and router,
-// and handles graceful shutdown on receiving quit signals.
-func startServer(cfg *config.Config, router *gin.Engine, lg *slog.Logger) {
+// refreshTokenLifetime is how long retired signing keys keep verifying tokens.
+func refreshTokenLifetime(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.Authentication.RefreshTokenExpiryDays) * 24 * time.Hour
+}
+
+// serviceName returns the service name reported in traces.
+func serviceName(cfg *config.Config) string {
+	if cfg.Tracing.ServiceName != "" {
+		return cfg.Tracing.ServiceName
+	}
+	return tracing.DefaultServiceName
+}
+
+// newServer creates the HTTP server for the given router using the configured port.
+func newServer(cfg *config.Config, router *gin.Engine) *http.Server {
 	serverAddr := fmt.Sprintf(":%s", cfg.ClientConnection.Port)
-	srv := &http.Server{
+	return &http.Server{
 		Addr:    serverAddr,
 		Handler: router,
 	}
-
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			lg.Error("Error running server", slog.String("error", err.Error()))
-			os.Exit(1)
-		}
-	}()
-
-	gracefulShutdown(srv, lg)
 }
-func gracefulShutdown(srv *http.Server, lg *slog.Logger) {
-	quit := make(chan os.Signal, 1)
-	// signal.Notify(quit, os.Interrupt) // Uncomment this line if you want to listen to OS interrupt signals
 
-	<-quit
-	lg.Info("Shutting down server...")
+// setupAdminRouter returns the router of the internal admin server.
+func setupAdminRouter(m *metrics.Metrics, signingKeys *keys.Manager, adminClients []string, hctxAuditLog *auditlog.AuditLogServiceContext, hctxUsers *users.UsersServiceContext, hctxRoles *roles.RolesServiceContext) *gin.Engine {
+	router := gin.New()
+	// The admin API is reached directly; its audit records use the peer address
+	_ = router.SetTrustedProxies(nil)
+	router.Use(gin.Recovery())
+	router.GET("/metrics", gin.WrapH(m.Handler()))
+
+	// API администрирования доступно пользователям с ролью admin или по разрешенному клиентскому сертификату (mTLS)
+	admin := router.Group("/admin/v1", middleware.AdminAuth(signingKeys, hctxUsers.Users, adminClients)...)
+	admin.GET("/audit-records", hctxAuditLog.QueryHandler)
+	admin.GET("/audit-records/export", hctxAuditLog.ExportHandler)
+
+	adminUsers := admin.Group("/users")
+	adminUsers.GET("", hctxUsers.SearchHandler)
+	adminUsers.GET("/:userId", hctxUsers.GetUserHandler)
+	adminUsers.POST("/:userId/verify", hctxUsers.VerifyHandler)
+	adminUsers.POST("/:userId/disable", hctxUsers.DisableHandler)
+	adminUsers.POST("/:userId/enable", hctxUsers.EnableHandler)
+	adminUsers.POST("/:userId/reset-attempts", hctxUsers.ResetAttemptsHandler)
+	adminUsers.POST("/:userId/logout", hctxUsers.LogoutHandler)
+	adminUsers.POST("/:userId/resend-code", hctxUsers.ResendCodeHandler)
+	adminUsers.GET("/:userId/roles", hctxRoles.GetRolesHandler)
+	adminUsers.PUT("/:userId/roles", hctxRoles.SetRolesHandler)
+	return router
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		lg.Error("Server forced to shutdown:", slog.String("error", err.Error()))
-		os.Exit(1)
+// newAdminServer creates the HTTP server of the internal admin port. With TLS
+// enabled, client certificates signed by the configured CA are requested and
+// verified, but not required, so that admins may use access tokens instead.
+func newAdminServer(cfg *config.Config, router *gin.Engine) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:    net.JoinHostPort(cfg.AdminConnection.Host, cfg.AdminConnection.Port),
+		Handler: router,
+	}
+	adminTLS := cfg.AdminConnection.TLS
+	if !adminTLS.Enabled {
+		return srv, nil
 	}
 
-	lg.Info("Server exiting")
+	cert, err := tls.LoadX509KeyPair(adminTLS.CertFile, adminTLS.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading certificate: %w", err)
+	}
+	srv.TLSConfig = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if adminTLS.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(adminTLS.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("client CA file contains no valid certificates")
+		}
+		srv.TLSConfig.ClientCAs = pool
+		srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return srv, nil
 }
 
+// serve runs the HTTP server until it is shut down. Shutdown through
+// http.Server.Shutdown is not reported as an error.
+func serve(srv *http.Server, lg *slog.Logger) error {
+	lg.Info("Rest Server starting", slog.String("addr", srv.Addr))
+	var err error
+	if srv.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -1,12 +1,14 @@
 /*
 Package mongo provides a streamlined interface for connecting to a MongoDB database
-within the app-update-api project. Key functionalities include initializing MongoDB
-client instances and constructing database connection strings.
+within the kidneysmart-auth project. Key functionalities include initializing MongoDB
+client instances and building client options from the database configuration.
 
 Key Functions:
-  - GetDB: Establishes and returns a MongoDB client based on given configuration and context.
-  - buildConnString: Generates a connection string for MongoDB using environment variables
-    and application configuration for secure credential management.
+  - GetDB: Establishes a MongoDB client based on the given configuration and verifies
+    the connection with a bounded number of pings.
+  - buildClientOptions: Translates the database configuration (URI, hosts, credentials,
+    replica set, TLS, pool limits and timeouts) into driver options. Credentials are
+    passed separately from the URI so that special characters need no escaping.
 
 This package simplifies database interaction by abstracting connection details,
 offering a straightforward approach to establish database connections for various
@@ -16,8 +18,8 @@ Example Usage:
 
 	func main() {
 		ctx := context.Background()
-		cfg := config.LoadConfig()
-		dbClient, err := mongo.GetDB(ctx, cfg)
+		cfg, _ := config.LoadConfig("../config", "config.yaml")
+		dbClient, err := mongo.GetDB(ctx, cfg.Database, slog.Default())
 		if err != nil {
 			log.Fatalf("Failed to connect to MongoDB: %v", err)
 		}
@@ -28,34 +30,191 @@ package mongo
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
 
-
-
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"golang.org/x/exp/slog"
 )
 
-// GetDB initializes and returns a new MongoDB client using provided context and configuration.
-// It ensures the establishment of a connection to the MongoDB database, returning an error
-// if the connection setup fails. This function is key for accessing the database in various parts of the application.
-func GetDB(ctx context.Context, dbUser string, dbPassword string, dbHost string, dbPort string) (*mongo.Client, error) {
-
+const (
+	defaultConnectRetries = 5
+	maxRetryDelay         = 10 * time.Second
+)
 
-	connString := fmt.Sprintf(
-		"mongodb://%s:%s@%s:%s/",
-		dbUser, dbPassword, dbHost, dbPort)
+// GetDB initializes and returns a new MongoDB client using provided context and configuration.
+// The connection is verified with a ping that is retried with exponential backoff up to
+// cfg.ConnectRetries times. Log lines and errors only mention the hosts, never the credentials.
+// Additional options, such as command monitors, are applied on top of the configuration.
+func GetDB(ctx context.Context, cfg config.DatabaseConfig, lg *slog.Logger, opts ...*options.ClientOptions) (*mongo.Client, error) {
+	clientOptions, err := buildClientOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	hosts := strings.Join(clientOptions.Hosts, ",")
 
-	clientOptions := options.Client().ApplyURI(connString)
-	client, err := mongo.Connect(ctx, clientOptions)
+	client, err := mongo.Connect(ctx, append([]*options.ClientOptions{clientOptions}, opts...)...)
 	if err != nil {
 		return nil, fmt.Errorf("error opening database: %w", err)
 	}
 
-	// Проверка подключения
-	if err != nil {
-		return nil, fmt.Errorf("error connecting to MongoDB using connection string %s: %w", connString, err)
+	if err := pingWithRetry(ctx, client, cfg, hosts, lg); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, fmt.Errorf("error connecting to MongoDB at %s: %w", hosts, err)
 	}
 
 	return client, nil
 }
+
+// buildClientOptions converts the database configuration into MongoDB client options.
+func buildClientOptions(cfg config.DatabaseConfig) (*options.ClientOptions, error) {
+	clientOptions := options.Client()
+
+	if cfg.URI != "" {
+		clientOptions.ApplyURI(cfg.URI)
+	} else {
+		clientOptions.SetHosts(buildHosts(cfg.Host, cfg.Port))
+	}
+
+	if cfg.User != "" {
+		clientOptions.SetAuth(options.Credential{
+			Username:   cfg.User,
+			Password:   cfg.Password,
+			AuthSource: cfg.AuthSource,
+		})
+	} else if cfg.AuthSource != "" && clientOptions.Auth != nil {
+		clientOptions.Auth.AuthSource = cfg.AuthSource
+	}
+
+	if cfg.ReplicaSet != "" {
+		clientOptions.SetReplicaSet(cfg.ReplicaSet)
+	}
+	if cfg.MaxPoolSize > 0 {
+		clientOptions.SetMaxPoolSize(uint64(cfg.MaxPoolSize))
+	}
+	if cfg.MinPoolSize > 0 {
+		clientOptions.SetMinPoolSize(uint64(cfg.MinPoolSize))
+	}
+	if cfg.ConnectionTimeout > 0 {
+		timeout := time.Duration(cfg.ConnectionTimeout) * time.Second
+		clientOptions.SetConnectTimeout(timeout)
+		clientOptions.SetServerSelectionTimeout(timeout)
+	}
+
+	if cfg.TLS.Enabled {
+		tlsConfig, err := buildTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+
+	if err := clientOptions.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid MongoDB connection settings: %w", err)
+	}
+	return clientOptions, nil
+}
+
+// buildHosts splits a comma separated host list and appends the default port
+// to every entry that does not specify one.
+func buildHosts(hostList, port string) []string {
+	var hosts []string
+	for _, host := range strings.Split(hostList, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil && port != "" {
+			host = net.JoinHostPort(host, port)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// buildTLSConfig loads the CA bundle and the client certificate referenced by the configuration.
+func buildTLSConfig(cfg config.DatabaseTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("CA file contains no valid certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertificateKeyFile != "" {
+		certPEM, err := os.ReadFile(cfg.CertificateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading certificate key file: %w", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, certPEM)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate key file: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// pingWithRetry pings the primary until it answers or the retry budget is exhausted.
+func pingWithRetry(ctx context.Context, client *mongo.Client, cfg config.DatabaseConfig, hosts string, lg *slog.Logger) error {
+	attempts := cfg.ConnectRetries
+	if attempts <= 0 {
+		attempts = defaultConnectRetries
+	}
+	timeout := time.Duration(cfg.ConnectionTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	delay := time.Second
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = client.Ping(pingCtx, readpref.Primary())
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+
+		lg.Warn("MongoDB is not reachable yet, retrying",
+			slog.String("hosts", hosts),
+			slog.Int("attempt", attempt),
+			slog.Int("maxAttempts", attempts),
+			slog.Duration("retryIn", delay),
+			slog.String("error", err.Error()))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+	return err
+}
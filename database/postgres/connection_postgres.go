@@ -0,0 +1,93 @@
+/*
+Package postgres provides the PostgreSQL counterpart of the mongo package.
+It opens a database/sql connection pool using the pgx driver and applies
+the embedded SQL migrations that create the schema used by the repositories.
+
+Key Functions:
+  - GetDB: Opens and verifies a connection pool based on the database configuration.
+  - Migrate: Applies all pending migrations from the migrations directory.
+
+Example Usage:
+
+	func main() {
+		ctx := context.Background()
+		cfg, _ := config.LoadConfig("../config", "config.yaml")
+		db, err := postgres.GetDB(ctx, cfg.Database)
+		if err != nil {
+			log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+		}
+		if err := postgres.Migrate(ctx, db); err != nil {
+			log.Fatalf("Failed to migrate PostgreSQL: %v", err)
+		}
+	}
+*/
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+
+	// Registers the "pgx" driver for database/sql.
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// GetDB opens a PostgreSQL connection pool using the provided configuration
+// and verifies that the server is reachable.
+func GetDB(ctx context.Context, cfg config.DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open("pgx", buildConnString(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+
+	if cfg.MaxPoolSize > 0 {
+		db.SetMaxOpenConns(cfg.MaxPoolSize)
+	}
+
+	pingCtx := ctx
+	if cfg.ConnectionTimeout > 0 {
+		var cancel context.CancelFunc
+		pingCtx, cancel = context.WithTimeout(ctx, time.Duration(cfg.ConnectionTimeout)*time.Second)
+		defer cancel()
+	}
+
+	if err := db.PingContext(pingCtx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error connecting to PostgreSQL at %s: %w", net.JoinHostPort(cfg.Host, cfg.Port), err)
+	}
+
+	return db, nil
+}
+
+// buildConnString builds a postgres:// URL with properly escaped credentials.
+// A configured URI is used as is.
+func buildConnString(cfg config.DatabaseConfig) string {
+	if cfg.URI != "" {
+		return cfg.URI
+	}
+
+	query := url.Values{}
+	if cfg.SSLMode != "" {
+		query.Set("sslmode", cfg.SSLMode)
+	}
+	if cfg.TLS.CAFile != "" {
+		query.Set("sslrootcert", cfg.TLS.CAFile)
+	}
+	if cfg.ConnectionTimeout > 0 {
+		query.Set("connect_timeout", fmt.Sprint(cfg.ConnectionTimeout))
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:     "/" + cfg.Name,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
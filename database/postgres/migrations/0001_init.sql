@@ -0,0 +1,21 @@
+-- Initial schema for users and refresh tokens.
+CREATE TABLE IF NOT EXISTS auth_users (
+    id                CHAR(24)    PRIMARY KEY,
+    email             TEXT        NOT NULL UNIQUE,
+    code              TEXT        NOT NULL DEFAULT '',
+    email_verified    BOOLEAN     NOT NULL DEFAULT FALSE,
+    attempt_count     INTEGER     NOT NULL DEFAULT 0,
+    last_attempt_time TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01 00:00:00+00',
+    password          TEXT        NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS auth_tokens (
+    token          TEXT        PRIMARY KEY,
+    user_id        CHAR(24)    NOT NULL REFERENCES auth_users (id) ON DELETE CASCADE,
+    device_info_id CHAR(24)    NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL,
+    expires_at     TIMESTAMPTZ NOT NULL,
+    is_active      BOOLEAN     NOT NULL DEFAULT TRUE
+);
+
+CREATE INDEX IF NOT EXISTS auth_tokens_user_id_idx ON auth_tokens (user_id);
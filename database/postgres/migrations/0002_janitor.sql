@@ -0,0 +1,22 @@
+-- Creation time of users, device records and leader election leases used by the janitor.
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS auth_users_unverified_created_at_idx ON auth_users (created_at) WHERE NOT email_verified;
+
+CREATE INDEX IF NOT EXISTS auth_tokens_expires_at_idx ON auth_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS auth_devices (
+    id           CHAR(24)    PRIMARY KEY,
+    user_id      CHAR(24)    NOT NULL REFERENCES auth_users (id) ON DELETE CASCADE,
+    platform     TEXT        NOT NULL DEFAULT '',
+    model        TEXT        NOT NULL DEFAULT '',
+    app_version  TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS leases (
+    name       TEXT        PRIMARY KEY,
+    holder     TEXT        NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
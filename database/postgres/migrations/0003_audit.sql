@@ -0,0 +1,19 @@
+-- Append-only security audit log. Records are removed by the janitor once the retention period has passed.
+CREATE TABLE IF NOT EXISTS auth_audit (
+    id         CHAR(24)    PRIMARY KEY,
+    action     TEXT        NOT NULL,
+    outcome    TEXT        NOT NULL,
+    reason     TEXT        NOT NULL DEFAULT '',
+    actor_id   TEXT        NOT NULL DEFAULT '',
+    user_id    TEXT        NOT NULL DEFAULT '',
+    email      TEXT        NOT NULL DEFAULT '',
+    ip         TEXT        NOT NULL DEFAULT '',
+    user_agent TEXT        NOT NULL DEFAULT '',
+    request_id TEXT        NOT NULL DEFAULT '',
+    details    JSONB       NOT NULL DEFAULT 'null',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS auth_audit_created_at_idx ON auth_audit (created_at);
+CREATE INDEX IF NOT EXISTS auth_audit_user_id_created_at_idx ON auth_audit (user_id, created_at) WHERE user_id <> '';
+CREATE INDEX IF NOT EXISTS auth_audit_email_created_at_idx ON auth_audit (email, created_at) WHERE email <> '';
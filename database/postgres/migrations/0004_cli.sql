@@ -0,0 +1,16 @@
+-- Accounts can be disabled by operators; disabled users cannot log in.
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Listing and revoking the active sessions of a user only touches active tokens.
+CREATE INDEX IF NOT EXISTS auth_tokens_active_user_id_idx ON auth_tokens (user_id) WHERE is_active;
+
+-- Asymmetric token signing keys. The newest key without retired_at signs new tokens,
+-- retired keys are kept to verify tokens issued before the rotation.
+CREATE TABLE IF NOT EXISTS signing_keys (
+    kid         TEXT        PRIMARY KEY,
+    algorithm   TEXT        NOT NULL,
+    private_key TEXT        NOT NULL,
+    public_key  TEXT        NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    retired_at  TIMESTAMPTZ
+);
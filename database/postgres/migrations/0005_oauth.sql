@@ -0,0 +1,41 @@
+-- OAuth 2.0 authorization code flow: registered clients, authorization requests and user consents.
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id             TEXT        PRIMARY KEY,
+    name           TEXT        NOT NULL,
+    type           TEXT        NOT NULL,
+    secret_hash    TEXT        NOT NULL DEFAULT '',
+    redirect_uris  JSONB       NOT NULL DEFAULT '[]',
+    allowed_scopes JSONB       NOT NULL DEFAULT '[]',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Authorization requests live until expires_at; the janitor removes them afterwards.
+CREATE TABLE IF NOT EXISTS oauth_authorizations (
+    id                    TEXT        PRIMARY KEY,
+    client_id             TEXT        NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    redirect_uri          TEXT        NOT NULL,
+    scopes                JSONB       NOT NULL DEFAULT '[]',
+    state                 TEXT        NOT NULL DEFAULT '',
+    code_challenge        TEXT        NOT NULL,
+    code_challenge_method TEXT        NOT NULL,
+    email                 TEXT        NOT NULL DEFAULT '',
+    login_code            TEXT        NOT NULL DEFAULT '',
+    attempt_count         INTEGER     NOT NULL DEFAULT 0,
+    user_id               CHAR(24)    REFERENCES auth_users (id) ON DELETE CASCADE,
+    code_hash             TEXT        UNIQUE,
+    code_expires_at       TIMESTAMPTZ,
+    consumed              BOOLEAN     NOT NULL DEFAULT FALSE,
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at            TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS oauth_authorizations_expires_at_idx ON oauth_authorizations (expires_at);
+
+CREATE TABLE IF NOT EXISTS oauth_consents (
+    user_id    CHAR(24)    NOT NULL REFERENCES auth_users (id) ON DELETE CASCADE,
+    client_id  TEXT        NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    scopes     JSONB       NOT NULL DEFAULT '[]',
+    granted_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, client_id)
+);
@@ -0,0 +1,4 @@
+-- OpenID Connect: the nonce of the authorization request and the time the user
+-- signed in are copied into the ID token.
+ALTER TABLE oauth_authorizations ADD COLUMN IF NOT EXISTS nonce TEXT NOT NULL DEFAULT '';
+ALTER TABLE oauth_authorizations ADD COLUMN IF NOT EXISTS auth_time TIMESTAMPTZ;
@@ -0,0 +1,14 @@
+-- Machine clients of the client credentials grant authenticate with a secret or
+-- with a JWT signed by their registered public key (private_key_jwt).
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS auth_method TEXT NOT NULL DEFAULT '';
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS public_key TEXT NOT NULL DEFAULT '';
+
+-- Used private_key_jwt assertions, kept until they expire to reject replays.
+CREATE TABLE IF NOT EXISTS oauth_client_assertions (
+    client_id  TEXT        NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    jti        TEXT        NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (client_id, jti)
+);
+
+CREATE INDEX IF NOT EXISTS oauth_client_assertions_expires_at_idx ON oauth_client_assertions (expires_at);
@@ -0,0 +1,4 @@
+-- Roles (patient, caregiver, clinician, admin) and additional permissions of users.
+-- Users without roles are patients.
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS roles JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS permissions JSONB NOT NULL DEFAULT '[]';
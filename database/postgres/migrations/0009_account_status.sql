@@ -0,0 +1,7 @@
+-- Account status (active, suspended, pending_deletion) replaces the disabled flag.
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01 00:00:00+00';
+
+UPDATE auth_users SET status = 'suspended', status_reason = 'disabled' WHERE disabled;
+ALTER TABLE auth_users DROP COLUMN IF EXISTS disabled;
@@ -0,0 +1,7 @@
+-- Self-service account deletion: re-authentication codes and the scheduled removal of the account.
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS code_sent_at TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01 00:00:00+00';
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMPTZ;
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS deletion_cancel_hash TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS auth_users_deletion_scheduled_at_idx ON auth_users (deletion_scheduled_at) WHERE status = 'pending_deletion';
+CREATE INDEX IF NOT EXISTS auth_audit_actor_id_idx ON auth_audit (actor_id);
@@ -0,0 +1,92 @@
+// Package account enforces the status of user accounts. Suspended accounts and
+// accounts pending deletion cannot sign in, refresh their tokens or use the
+// access tokens issued before the status changed.
+//
+// Accounts whose deletion the user requested stay pending deletion for a grace
+// period, during which the deletion can be cancelled, and are then removed by the
+// Purger.
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/a-dev-mobile/kidneysmart-auth/pkg/authmw"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StatusError returns nil for active accounts, utils.ErrAccountSuspended or
+// utils.ErrAccountPendingDeletion otherwise. utils.TokenErrorStatus maps the
+// errors to the ACCOUNT_SUSPENDED and ACCOUNT_PENDING_DELETION statuses.
+func StatusError(user *db.AuthUser) error {
+	switch user.AccountStatus() {
+	case db.StatusActive:
+		return nil
+	case db.StatusPendingDeletion:
+		return utils.ErrAccountPendingDeletion
+	default:
+		return utils.ErrAccountSuspended
+	}
+}
+
+// Suspend suspends the account and revokes all of its sessions. Access tokens
+// already issued are rejected by the status check of Verifier.
+func Suspend(ctx context.Context, users repository.UserRepository, tokens repository.TokenRepository, user *db.AuthUser, reason string) (int64, error) {
+	if err := users.SetStatus(ctx, user.Email, db.StatusSuspended, reason, time.Now().UTC()); err != nil {
+		return 0, err
+	}
+	return tokens.RevokeByUser(ctx, user.ID)
+}
+
+// Reactivate makes a suspended account active again.
+func Reactivate(ctx context.Context, users repository.UserRepository, user *db.AuthUser, reason string) error {
+	return users.SetStatus(ctx, user.Email, db.StatusActive, reason, time.Now().UTC())
+}
+
+// Verifier is an authmw.Verifier that, after verifying the token, rejects the
+// tokens of users whose account is not active or no longer exists. Tokens of
+// machine clients are not checked.
+type Verifier struct {
+	next  authmw.Verifier
+	users repository.UserRepository
+}
+
+// NewVerifier returns a Verifier checking the accounts of the tokens verified by next.
+func NewVerifier(next authmw.Verifier, users repository.UserRepository) *Verifier {
+	return &Verifier{next: next, users: users}
+}
+
+func (v *Verifier) Verify(ctx context.Context, token string) (*authmw.Claims, error) {
+	claims, err := v.next.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.IsClient() {
+		return claims, nil
+	}
+	if err := CheckUserID(ctx, v.users, claims.UserID); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// CheckUserID checks the account of a token's user. Tokens of deleted users are
+// reported as utils.ErrInvalidToken, storage failures as authmw.ErrVerifierUnavailable.
+func CheckUserID(ctx context.Context, users repository.UserRepository, userID string) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return utils.ErrInvalidToken
+	}
+	user, err := users.FindByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return utils.ErrInvalidToken
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", authmw.ErrVerifierUnavailable, err)
+	}
+	return StatusError(user)
+}
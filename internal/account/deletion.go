@@ -0,0 +1,173 @@
+package account
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/events"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"golang.org/x/exp/slog"
+)
+
+// DeletionReason is the status reason of accounts whose deletion the user requested.
+const DeletionReason = "deletion requested by the user"
+
+// purgeBatchSize limits the number of accounts removed by one run of the janitor.
+const purgeBatchSize = 100
+
+// purgeActor is the actor of the audit records of removed accounts.
+const purgeActor = "system:janitor"
+
+// ErrInvalidCancelToken is returned by CancelDeletion when the account is not
+// pending deletion, the grace period has ended or the token does not match.
+var ErrInvalidCancelToken = errors.New("invalid deletion cancel token")
+
+// ScheduleDeletion revokes all sessions of the account and puts it into
+// db.StatusPendingDeletion for gracePeriod. It returns the token that cancels the
+// deletion, of which only the hash is stored, and the time the account will be removed.
+//
+// The deletion is scheduled by a single update after the sessions are revoked, so a
+// failure never leaves an account pending deletion with active sessions, and the
+// request can simply be repeated.
+func ScheduleDeletion(ctx context.Context, users repository.UserRepository, tokens repository.TokenRepository, user *db.AuthUser, gracePeriod time.Duration) (string, time.Time, error) {
+	cancelToken, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if _, err := tokens.RevokeByUser(ctx, user.ID); err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now().UTC()
+	deleteAt := now.Add(gracePeriod)
+	if err := users.ScheduleDeletion(ctx, user.Email, DeletionReason, utils.HashOpaqueToken(cancelToken), now, deleteAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return cancelToken, deleteAt, nil
+}
+
+// CancelDeletion makes an account pending deletion active again. The sessions
+// revoked by ScheduleDeletion stay revoked.
+func CancelDeletion(ctx context.Context, users repository.UserRepository, user *db.AuthUser, cancelToken string) error {
+	now := time.Now().UTC()
+	if user.AccountStatus() != db.StatusPendingDeletion || user.DeletionCancelHash == "" ||
+		!now.Before(user.DeletionScheduledAt) || !utils.OpaqueTokenMatches(cancelToken, user.DeletionCancelHash) {
+		return ErrInvalidCancelToken
+	}
+	return users.SetStatus(ctx, user.Email, db.StatusActive, "deletion cancelled by the user", now)
+}
+
+// Purger removes the accounts whose deletion grace period has ended. It is run by
+// the janitor.
+type Purger struct {
+	users        repository.UserRepository
+	maintenance  repository.MaintenanceRepository
+	publisher    events.Publisher
+	audit        *audit.Recorder
+	pseudonymKey []byte
+	logger       *slog.Logger
+}
+
+// NewPurger returns a Purger removing accounts from users and maintenance and
+// announcing their removal through publisher. The pseudonyms replacing removed
+// users in the audit log are derived with pseudonymKey.
+func NewPurger(users repository.UserRepository, maintenance repository.MaintenanceRepository, publisher events.Publisher, recorder *audit.Recorder, pseudonymKey string, lg *slog.Logger) *Purger {
+	return &Purger{
+		users:        users,
+		maintenance:  maintenance,
+		publisher:    publisher,
+		audit:        recorder,
+		pseudonymKey: []byte(pseudonymKey),
+		logger:       lg.With(slog.String("component", "account")),
+	}
+}
+
+// PurgeDueAccounts removes the accounts pending deletion whose deletion time is not
+// after now and returns how many were removed. In dry-run mode they are only counted.
+//
+// The account.deleted event is published first, so that an account whose event
+// could not be delivered is kept and retried by the next run. Then the audit
+// records of the user are anonymised and the user is removed with its tokens,
+// devices, codes and OAuth grants.
+func (p *Purger) PurgeDueAccounts(ctx context.Context, now time.Time, dryRun bool) (int64, error) {
+	due, err := p.users.FindDueForDeletion(ctx, now, purgeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	if dryRun {
+		return int64(len(due)), nil
+	}
+
+	var removed int64
+	var errs []error
+	for i := range due {
+		if _, err := p.Purge(ctx, &due[i], audit.ActionAccountDelete, purgeActor); err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", due[i].ID.Hex(), err))
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
+
+// Purge removes the account of user in the same way as PurgeDueAccounts, whatever
+// its status, and records the removal as action by actorID. It returns the
+// pseudonym that replaces the user in the audit log. Operators use it to delete
+// an account at once.
+func (p *Purger) Purge(ctx context.Context, user *db.AuthUser, action, actorID string) (string, error) {
+	userID := user.ID.Hex()
+	occurredAt := user.DeletionScheduledAt
+	if user.AccountStatus() != db.StatusPendingDeletion || occurredAt.IsZero() {
+		occurredAt = time.Now().UTC()
+	}
+	event := events.Event{
+		// The same ID for every attempt lets receivers recognise repeated deliveries
+		ID:         events.TypeAccountDeleted + ":" + userID,
+		Type:       events.TypeAccountDeleted,
+		UserID:     userID,
+		OccurredAt: occurredAt,
+	}
+	if err := p.publisher.Publish(ctx, event); err != nil {
+		return "", fmt.Errorf("publish %s: %w", event.Type, err)
+	}
+
+	pseudonym := p.pseudonym(userID)
+	anonymised, err := p.maintenance.AnonymiseAuditRecords(ctx, userID, user.Email, pseudonym)
+	if err != nil {
+		return "", fmt.Errorf("anonymise audit records: %w", err)
+	}
+	if err := p.maintenance.PurgeUser(ctx, user.ID, user.Email); err != nil {
+		return "", fmt.Errorf("remove account: %w", err)
+	}
+
+	details := map[string]string{"auditRecords": fmt.Sprint(anonymised)}
+	if user.AccountStatus() == db.StatusPendingDeletion {
+		details["requestedAt"] = user.StatusChangedAt.UTC().Format(time.RFC3339)
+	}
+	p.audit.Record(ctx, audit.Event{
+		Action:  action,
+		Outcome: audit.OutcomeSuccess,
+		ActorID: actorID,
+		UserID:  pseudonym,
+		Details: details,
+	})
+	p.logger.InfoContext(ctx, "Account deleted", slog.String("pseudonym", pseudonym), slog.Int64("auditRecords", anonymised))
+	return pseudonym, nil
+}
+
+// pseudonym derives the user ID that replaces userID in the audit log. It is the
+// same for every attempt to remove the account, so the records anonymised by a
+// failed attempt and by its retry still belong together, and it cannot be traced
+// back to the user without the key.
+func (p *Purger) pseudonym(userID string) string {
+	mac := hmac.New(sha256.New, p.pseudonymKey)
+	mac.Write([]byte("audit-pseudonym:" + userID))
+	return "deleted-" + hex.EncodeToString(mac.Sum(nil)[:12])
+}
@@ -0,0 +1,162 @@
+// Package auditlog serves the security audit log on the admin port.
+package auditlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/admin/auditlog/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/middleware"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
+)
+
+const defaultQueryLimit = 1000
+
+type AuditLogServiceContext struct {
+	Audit    repository.AuditRepository
+	Recorder *audit.Recorder
+	Logger   *slog.Logger
+	Config   *config.Config
+}
+
+func NewAuditLogServiceContext(auditRepo repository.AuditRepository, recorder *audit.Recorder, lg *slog.Logger, cfg *config.Config) *AuditLogServiceContext {
+	return &AuditLogServiceContext{
+		Audit:    auditRepo,
+		Recorder: recorder,
+		Logger:   lg,
+		Config:   cfg,
+	}
+}
+
+// QueryHandler returns the audit records of a user and/or a time range as JSON.
+// The number of records is capped by audit.queryLimit.
+func (s *AuditLogServiceContext) QueryHandler(c *gin.Context) {
+	filter, ok := s.bindFilter(c)
+	if !ok {
+		return
+	}
+
+	maxLimit := s.Config.Audit.QueryLimit
+	if maxLimit <= 0 {
+		maxLimit = defaultQueryLimit
+	}
+	if filter.Limit == 0 || filter.Limit > maxLimit {
+		filter.Limit = maxLimit
+	}
+
+	records := []db.AuditRecord{}
+	err := s.Audit.Find(c.Request.Context(), filter, func(record db.AuditRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to query audit log", "error", err.Error())
+		s.record(c, audit.ActionAuditQuery, filter, audit.OutcomeFailure, "AUDIT_QUERY_FAILED", 0)
+		c.JSON(http.StatusInternalServerError, model.ResponseAuditLog{
+			Message: "Failed to read the audit log",
+			Status:  "AUDIT_QUERY_FAILED",
+		})
+		return
+	}
+
+	s.record(c, audit.ActionAuditQuery, filter, audit.OutcomeSuccess, "", len(records))
+	c.JSON(http.StatusOK, model.ResponseAuditLog{
+		Message: "Audit records found",
+		Status:  "OK",
+		Records: records,
+	})
+}
+
+// ExportHandler streams the matching audit records as JSON Lines, one record per line.
+// Unlike QueryHandler the export is not capped unless a limit is given.
+func (s *AuditLogServiceContext) ExportHandler(c *gin.Context) {
+	filter, ok := s.bindFilter(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	exported := 0
+	err := s.Audit.Find(c.Request.Context(), filter, func(record db.AuditRecord) error {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+		exported++
+		return nil
+	})
+	if err != nil {
+		// The status has already been sent, so the client can only notice the
+		// failure through the truncated output.
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to export audit log", "error", err.Error())
+		s.record(c, audit.ActionAuditExport, filter, audit.OutcomeFailure, "AUDIT_EXPORT_FAILED", exported)
+		_ = c.Error(err)
+		return
+	}
+	s.record(c, audit.ActionAuditExport, filter, audit.OutcomeSuccess, "", exported)
+}
+
+// record appends the read access to the audit log together with the filter and
+// the number of records returned, so that exports of personal data can be traced
+// back to the admin who made them.
+func (s *AuditLogServiceContext) record(c *gin.Context, action string, filter repository.AuditFilter, outcome, reason string, records int) {
+	details := map[string]string{"records": fmt.Sprint(records)}
+	if filter.UserID != "" {
+		details["userId"] = filter.UserID
+	}
+	if filter.Email != "" {
+		details["email"] = filter.Email
+	}
+	if !filter.From.IsZero() {
+		details["from"] = filter.From.UTC().Format(time.RFC3339)
+	}
+	if !filter.To.IsZero() {
+		details["to"] = filter.To.UTC().Format(time.RFC3339)
+	}
+	if filter.Limit > 0 {
+		details["limit"] = fmt.Sprint(filter.Limit)
+	}
+	s.Recorder.RecordRequest(c, audit.Event{
+		Action:  audit.AdminPrefix + action,
+		Outcome: outcome,
+		Reason:  reason,
+		ActorID: middleware.AdminActor(c),
+		Details: details,
+	})
+}
+
+func (s *AuditLogServiceContext) bindFilter(c *gin.Context) (repository.AuditFilter, bool) {
+	var req model.RequestAuditLog
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseAuditLog{
+			Message: "Invalid query parameters",
+			Status:  "INVALID_PARAMETERS",
+		})
+		return repository.AuditFilter{}, false
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseAuditLog{
+			Message: err.Error(),
+			Status:  "INVALID_PARAMETERS",
+		})
+		return repository.AuditFilter{}, false
+	}
+
+	return repository.AuditFilter{
+		UserID: req.UserID,
+		Email:  req.Email,
+		From:   req.From,
+		To:     req.To,
+		Limit:  req.Limit,
+	}, true
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// RequestAuditLog holds the query parameters of the audit log endpoints.
+type RequestAuditLog struct {
+	UserID string    `form:"userId" validate:"omitempty,hexadecimal,len=24"`
+	Email  string    `form:"email" validate:"omitempty,email"`
+	From   time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int       `form:"limit" validate:"gte=0"`
+}
+
+func (r *RequestAuditLog) Validate() error {
+	validate := validator.New()
+	if err := validate.Struct(r); err != nil {
+		return err
+	}
+	if !r.From.IsZero() && !r.To.IsZero() && !r.From.Before(r.To) {
+		return errors.New("from must be before to")
+	}
+	return nil
+}
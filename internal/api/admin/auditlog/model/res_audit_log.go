@@ -0,0 +1,18 @@
+package model
+
+import "github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+
+// ResponseAuditLog represents the response payload of an audit log query.
+type ResponseAuditLog struct {
+	// Message provides information about the query outcome.
+	Message string `json:"message"`
+
+	// Status of the query. Possible values are:
+	// - "INVALID_PARAMETERS": The query parameters are invalid.
+	// - "AUDIT_QUERY_FAILED": The audit log could not be read.
+	// - "OK": The records were returned.
+	Status string `json:"status"`
+
+	// Records matching the query, oldest first.
+	Records []db.AuditRecord `json:"records,omitempty"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/rbac"
+	"github.com/go-playground/validator/v10"
+)
+
+// RequestRoles replaces the roles and additional permissions of a user.
+type RequestRoles struct {
+	// @Required
+	Roles       []string `json:"roles" validate:"required,max=8"`
+	Permissions []string `json:"permissions" validate:"max=32"`
+}
+
+func (r *RequestRoles) Validate() error {
+	validate := validator.New()
+	if err := validate.Struct(r); err != nil {
+		return err
+	}
+	for _, role := range r.Roles {
+		if !rbac.ValidRole(role) {
+			return fmt.Errorf("unknown role %q, expected one of %v", role, rbac.Roles())
+		}
+	}
+	for _, permission := range r.Permissions {
+		if !rbac.ValidScope(permission) {
+			return fmt.Errorf("invalid permission %q", permission)
+		}
+	}
+	return nil
+}
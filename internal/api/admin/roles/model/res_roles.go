@@ -0,0 +1,27 @@
+package model
+
+// ResponseRoles represents the roles of a user.
+type ResponseRoles struct {
+	// Message provides information about the request outcome.
+	Message string `json:"message"`
+
+	// Status of the request. Possible values are:
+	// - "INVALID_PARAMETERS": The user ID or the request body is invalid.
+	// - "USER_NOT_FOUND": No user has the given ID.
+	// - "SELF_DEMOTION": An admin tried to remove their own admin role.
+	// - "ROLES_UPDATE_FAILED": The roles could not be read or stored.
+	// - "OK": The roles were returned or updated.
+	Status string `json:"status"`
+
+	// UserID of the user.
+	UserID string `json:"userId,omitempty"`
+
+	// Roles of the user. Users without assigned roles are patients.
+	Roles []string `json:"roles,omitempty"`
+
+	// Permissions granted in addition to the roles.
+	Permissions []string `json:"permissions,omitempty"`
+
+	// Scopes embedded in the access tokens of the user.
+	Scopes []string `json:"scopes,omitempty"`
+}
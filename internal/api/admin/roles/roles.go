@@ -0,0 +1,142 @@
+// Package roles serves the role assignment API on the admin port.
+package roles
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/admin/roles/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/middleware"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/rbac"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/pkg/authmw"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/exp/slog"
+)
+
+type RolesServiceContext struct {
+	Users  repository.UserRepository
+	Audit  *audit.Recorder
+	Logger *slog.Logger
+}
+
+func NewRolesServiceContext(users repository.UserRepository, recorder *audit.Recorder, lg *slog.Logger) *RolesServiceContext {
+	return &RolesServiceContext{
+		Users:  users,
+		Audit:  recorder,
+		Logger: lg,
+	}
+}
+
+// GetRolesHandler returns the roles, additional permissions and resulting scopes of a user.
+func (s *RolesServiceContext) GetRolesHandler(c *gin.Context) {
+	user, ok := s.findUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, response(user, "Roles found"))
+}
+
+// SetRolesHandler replaces the roles and additional permissions of a user. The
+// change takes effect with the next access token of the user, issued at sign-in
+// or on refresh. Every change is recorded in the audit log.
+func (s *RolesServiceContext) SetRolesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req model.RequestRoles
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.Logger.InfoContext(ctx, "Failed to bind JSON", "error", err.Error())
+		c.JSON(http.StatusBadRequest, model.ResponseRoles{Message: "Invalid request body", Status: "INVALID_PARAMETERS"})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseRoles{Message: err.Error(), Status: "INVALID_PARAMETERS"})
+		return
+	}
+
+	user, ok := s.findUser(c)
+	if !ok {
+		return
+	}
+
+	updated := *user
+	updated.Roles = rbac.Normalize(req.Roles)
+	updated.Permissions = rbac.Normalize(req.Permissions)
+
+	// Администратор не может лишить роли admin сам себя, чтобы не остаться без администраторов
+	admin, _ := authmw.ClaimsFromContext(ctx)
+	if admin != nil && admin.UserID == user.ID.Hex() && !rbac.HasRole(&updated, rbac.RoleAdmin) {
+		s.record(c, user, &updated, audit.OutcomeFailure, "SELF_DEMOTION")
+		c.JSON(http.StatusConflict, model.ResponseRoles{
+			Message: "Admins cannot remove their own admin role",
+			Status:  "SELF_DEMOTION",
+		})
+		return
+	}
+
+	err := s.Users.SetRoles(ctx, user.Email, updated.Roles, updated.Permissions)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, model.ResponseRoles{Message: "User not found", Status: "USER_NOT_FOUND"})
+		return
+	} else if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to update roles", "userID", user.ID.Hex(), "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseRoles{Message: "Failed to update roles", Status: "ROLES_UPDATE_FAILED"})
+		return
+	}
+
+	s.record(c, user, &updated, audit.OutcomeSuccess, "")
+	c.JSON(http.StatusOK, response(&updated, "Roles updated"))
+}
+
+// findUser loads the user named by the userId path parameter. On failure the
+// error response has been written and ok is false.
+func (s *RolesServiceContext) findUser(c *gin.Context) (*db.AuthUser, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseRoles{Message: "Invalid user ID", Status: "INVALID_PARAMETERS"})
+		return nil, false
+	}
+	user, err := s.Users.FindByID(c.Request.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, model.ResponseRoles{Message: "User not found", Status: "USER_NOT_FOUND"})
+		return nil, false
+	} else if err != nil {
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to retrieve user", "userID", id.Hex(), "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseRoles{Message: "Failed to read roles", Status: "ROLES_UPDATE_FAILED"})
+		return nil, false
+	}
+	return user, true
+}
+
+// record appends the role change to the audit log with the roles before and after it.
+func (s *RolesServiceContext) record(c *gin.Context, before, after *db.AuthUser, outcome, reason string) {
+	s.Audit.RecordRequest(c, audit.Event{
+		Action:  audit.AdminPrefix + audit.ActionRolesUpdate,
+		Outcome: outcome,
+		Reason:  reason,
+		ActorID: middleware.AdminActor(c),
+		UserID:  before.ID.Hex(),
+		Email:   before.Email,
+		Details: map[string]string{
+			"rolesBefore":       strings.Join(rbac.EffectiveRoles(before), " "),
+			"rolesAfter":        strings.Join(rbac.EffectiveRoles(after), " "),
+			"permissionsBefore": strings.Join(before.Permissions, " "),
+			"permissionsAfter":  strings.Join(after.Permissions, " "),
+		},
+	})
+}
+
+func response(user *db.AuthUser, message string) model.ResponseRoles {
+	return model.ResponseRoles{
+		Message:     message,
+		Status:      "OK",
+		UserID:      user.ID.Hex(),
+		Roles:       rbac.EffectiveRoles(user),
+		Permissions: user.Permissions,
+		Scopes:      rbac.Scopes(user),
+	}
+}
@@ -0,0 +1,29 @@
+package model
+
+import "github.com/go-playground/validator/v10"
+
+// RequestSearchUsers holds the query parameters of the user search. Query is
+// matched against the user ID and, ignoring case, against parts of the email.
+type RequestSearchUsers struct {
+	// @Required
+	Query string `form:"query" validate:"required,max=254"`
+	Limit int    `form:"limit" validate:"gte=0,lte=100"`
+}
+
+func (r *RequestSearchUsers) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+// RequestStatusChange is the optional body of the disable and enable actions.
+// The reason is stored with the account status and recorded in the audit log.
+// CancelDeletion lets enable reactivate an account that is pending deletion.
+type RequestStatusChange struct {
+	Reason         string `json:"reason" validate:"max=500"`
+	CancelDeletion bool   `json:"cancelDeletion"`
+}
+
+func (r *RequestStatusChange) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
@@ -0,0 +1,83 @@
+package model
+
+import "time"
+
+// ResponseUsers represents the result of a user search.
+type ResponseUsers struct {
+	// Message provides information about the request outcome.
+	Message string `json:"message"`
+
+	// Status of the request. Possible values are:
+	// - "INVALID_PARAMETERS": The query parameters are invalid.
+	// - "USER_QUERY_FAILED": The users could not be read.
+	// - "OK": The matching users were returned.
+	Status string `json:"status"`
+
+	// Users matching the query, ordered by email.
+	Users []UserSummary `json:"users,omitempty"`
+}
+
+// ResponseUser represents a single user after a lookup or an action.
+type ResponseUser struct {
+	// Message provides information about the request outcome.
+	Message string `json:"message"`
+
+	// Status of the request. Possible values are:
+	// - "INVALID_PARAMETERS": The user ID is invalid.
+	// - "USER_NOT_FOUND": No user has the given ID.
+	// - "ALREADY_VERIFIED": A code was requested for a verified email.
+	// - "ACCOUNT_PENDING_DELETION": An account scheduled for deletion cannot be suspended.
+	// - "EMAIL_SEND_FAILED": The new code was stored but the email could not be sent.
+	// - "USER_UPDATE_FAILED": The user could not be read or updated.
+	// - "OK": The request succeeded.
+	Status string `json:"status"`
+
+	// User after the request.
+	User *UserDetails `json:"user,omitempty"`
+}
+
+// UserSummary describes a user in search results.
+type UserSummary struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+	// Status of the account: active, suspended or pending_deletion.
+	Status          string     `json:"status"`
+	StatusReason    string     `json:"statusReason,omitempty"`
+	StatusChangedAt *time.Time `json:"statusChangedAt,omitempty"`
+	// Time an account pending deletion will be removed. Enabling the account cancels the deletion.
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt,omitempty"`
+	CreatedAt           time.Time  `json:"createdAt"`
+}
+
+// UserDetails describes the verification, lockout and session state of a user.
+type UserDetails struct {
+	UserSummary
+	Roles []string `json:"roles"`
+
+	// VerificationPending is set while an unused verification code exists.
+	VerificationPending bool `json:"verificationPending"`
+
+	// HasPassword is set once the user has chosen a password.
+	HasPassword bool `json:"hasPassword"`
+
+	Lockout  Lockout   `json:"lockout"`
+	Sessions []Session `json:"sessions"`
+}
+
+// Lockout describes the failed verification attempts of a user.
+type Lockout struct {
+	AttemptCount    int        `json:"attemptCount"`
+	LastAttemptTime *time.Time `json:"lastAttemptTime,omitempty"`
+
+	// Locked is set while further codes are rejected; LockedUntil is when that ends.
+	Locked      bool       `json:"locked"`
+	LockedUntil *time.Time `json:"lockedUntil,omitempty"`
+}
+
+// Session describes an active refresh token without revealing it.
+type Session struct {
+	DeviceInfoID string    `json:"deviceInfoId"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
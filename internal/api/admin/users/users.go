@@ -0,0 +1,358 @@
+// Package users serves the user management API used by support staff on the admin port.
+package users
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/admin/users/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/login"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/verifycode"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/middleware"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/rbac"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/a-dev-mobile/kidneysmart-auth/pkg/emailclient"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/exp/slog"
+)
+
+const defaultSearchLimit = 20
+
+type UsersServiceContext struct {
+	Users       repository.UserRepository
+	Tokens      repository.TokenRepository
+	Audit       *audit.Recorder
+	EmailClient *emailclient.EmailClient
+	Logger      *slog.Logger
+}
+
+func NewUsersServiceContext(users repository.UserRepository, tokens repository.TokenRepository, recorder *audit.Recorder, emailClient *emailclient.EmailClient, lg *slog.Logger) *UsersServiceContext {
+	return &UsersServiceContext{
+		Users:       users,
+		Tokens:      tokens,
+		Audit:       recorder,
+		EmailClient: emailClient,
+		Logger:      lg,
+	}
+}
+
+// SearchHandler finds users by ID or by a part of their email, so that accounts
+// registered with a mistyped address can be found.
+func (s *UsersServiceContext) SearchHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req model.RequestSearchUsers
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseUsers{Message: "Invalid query parameters", Status: "INVALID_PARAMETERS"})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseUsers{Message: err.Error(), Status: "INVALID_PARAMETERS"})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultSearchLimit
+	}
+
+	var found []db.AuthUser
+	var err error
+	if id, idErr := primitive.ObjectIDFromHex(req.Query); idErr == nil {
+		var user *db.AuthUser
+		if user, err = s.Users.FindByID(ctx, id); err == nil {
+			found = append(found, *user)
+		} else if errors.Is(err, repository.ErrNotFound) {
+			err = nil
+		}
+	} else {
+		found, err = s.Users.Search(ctx, req.Query, req.Limit)
+	}
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to search users", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseUsers{Message: "Failed to search users", Status: "USER_QUERY_FAILED"})
+		return
+	}
+
+	s.Audit.RecordRequest(c, audit.Event{
+		Action:  audit.AdminPrefix + audit.ActionUserSearch,
+		Outcome: audit.OutcomeSuccess,
+		ActorID: middleware.AdminActor(c),
+		Details: map[string]string{"query": req.Query, "results": fmt.Sprint(len(found))},
+	})
+
+	users := make([]model.UserSummary, 0, len(found))
+	for i := range found {
+		users = append(users, summary(&found[i]))
+	}
+	c.JSON(http.StatusOK, model.ResponseUsers{Message: "Users found", Status: "OK", Users: users})
+}
+
+// GetUserHandler returns the verification, lockout and session state of a user.
+func (s *UsersServiceContext) GetUserHandler(c *gin.Context) {
+	user, ok := s.findUser(c)
+	if !ok {
+		return
+	}
+	s.record(c, audit.ActionUserView, user, nil)
+	s.respond(c, user, "User found")
+}
+
+// VerifyHandler marks the email of the user as verified without a code.
+func (s *UsersServiceContext) VerifyHandler(c *gin.Context) {
+	user, ok := s.findUser(c)
+	if !ok {
+		return
+	}
+	if err := s.Users.SetEmailVerified(c.Request.Context(), user.Email); err != nil {
+		s.updateFailed(c, user, err)
+		return
+	}
+	s.record(c, audit.ActionUserVerify, user, nil)
+	s.respondUpdated(c, user, "Email verified")
+}
+
+// DisableHandler suspends the account for the given reason and ends all of its
+// sessions. Access tokens already issued are rejected from then on.
+func (s *UsersServiceContext) DisableHandler(c *gin.Context) {
+	var req model.RequestStatusChange
+	if !s.bindStatusChange(c, &req, true) {
+		return
+	}
+	user, ok := s.findUser(c)
+	if !ok {
+		return
+	}
+	if user.AccountStatus() == db.StatusPendingDeletion {
+		c.JSON(http.StatusConflict, model.ResponseUser{Message: "The account is scheduled for deletion", Status: "ACCOUNT_PENDING_DELETION"})
+		return
+	}
+	revoked, err := account.Suspend(c.Request.Context(), s.Users, s.Tokens, user, req.Reason)
+	if err != nil {
+		s.updateFailed(c, user, err)
+		return
+	}
+	s.record(c, audit.ActionUserDisable, user, map[string]string{"reason": req.Reason, "revokedSessions": fmt.Sprint(revoked)})
+	s.respondUpdated(c, user, "User suspended")
+}
+
+// EnableHandler makes a suspended account active again. The deletion of an
+// account pending deletion is only cancelled when the request asks for it.
+func (s *UsersServiceContext) EnableHandler(c *gin.Context) {
+	var req model.RequestStatusChange
+	if !s.bindStatusChange(c, &req, false) {
+		return
+	}
+	user, ok := s.findUser(c)
+	if !ok {
+		return
+	}
+	if user.AccountStatus() == db.StatusPendingDeletion && !req.CancelDeletion {
+		c.JSON(http.StatusConflict, model.ResponseUser{Message: "The account is scheduled for deletion, set cancelDeletion to cancel it", Status: "ACCOUNT_PENDING_DELETION"})
+		return
+	}
+	if err := account.Reactivate(c.Request.Context(), s.Users, user, req.Reason); err != nil {
+		s.updateFailed(c, user, err)
+		return
+	}
+	s.record(c, audit.ActionUserEnable, user, map[string]string{"reason": req.Reason, "previousStatus": user.AccountStatus()})
+	s.respondUpdated(c, user, "User enabled")
+}
+
+// bindStatusChange reads the optional JSON body of a status change; with
+// reasonRequired the body and its reason must be present.
+func (s *UsersServiceContext) bindStatusChange(c *gin.Context, req *model.RequestStatusChange, reasonRequired bool) bool {
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(req); err != nil {
+			c.JSON(http.StatusBadRequest, model.ResponseUser{Message: "Invalid request body", Status: "INVALID_PARAMETERS"})
+			return false
+		}
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseUser{Message: err.Error(), Status: "INVALID_PARAMETERS"})
+		return false
+	}
+	if reasonRequired && req.Reason == "" {
+		c.JSON(http.StatusBadRequest, model.ResponseUser{Message: "reason is required", Status: "INVALID_PARAMETERS"})
+		return false
+	}
+	return true
+}
+
+// ResetAttemptsHandler clears the failed verification attempts, lifting a lockout.
+func (s *UsersServiceContext) ResetAttemptsHandler(c *gin.Context) {
+	user, ok := s.findUser(c)
+	if !ok {
+		return
+	}
+	if err := s.Users.SetAttemptCount(c.Request.Context(), user.Email, 0, time.Time{}); err != nil {
+		s.updateFailed(c, user, err)
+		return
+	}
+	s.record(c, audit.ActionAttemptsReset, user, map[string]string{"attemptCount": fmt.Sprint(user.AttemptCount)})
+	s.respondUpdated(c, user, "Attempts reset")
+}
+
+// LogoutHandler revokes every refresh token of the user. Access tokens stay
+// valid until they expire.
+func (s *UsersServiceContext) LogoutHandler(c *gin.Context) {
+	user, ok := s.findUser(c)
+	if !ok {
+		return
+	}
+	revoked, err := s.Tokens.RevokeByUser(c.Request.Context(), user.ID)
+	if err != nil {
+		s.updateFailed(c, user, err)
+		return
+	}
+	s.record(c, audit.ActionSessionsRevoke, user, map[string]string{"revokedSessions": fmt.Sprint(revoked)})
+	s.respondUpdated(c, user, fmt.Sprintf("Revoked %d sessions", revoked))
+}
+
+// ResendCodeHandler replaces the verification code of an unverified user, resets
+// the attempt counter and emails the new code.
+func (s *UsersServiceContext) ResendCodeHandler(c *gin.Context) {
+	user, ok := s.findUser(c)
+	if !ok {
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusConflict, model.ResponseUser{Message: "The email is already verified", Status: "ALREADY_VERIFIED"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	code := utils.GenerateRandomCode()
+	if err := s.Users.SetCode(ctx, user.Email, code, time.Now().UTC()); err != nil {
+		s.updateFailed(c, user, err)
+		return
+	}
+	if err := login.SendConfirmationEmail(ctx, s.EmailClient, user.Email, code); err != nil {
+		s.Logger.WarnContext(ctx, "Failed to send email", "userID", user.ID.Hex(), "error", err.Error())
+		s.recordOutcome(c, audit.ActionCodeResend, user, audit.OutcomeFailure, "EMAIL_SEND_FAILED", nil)
+		c.JSON(http.StatusBadGateway, model.ResponseUser{Message: "The code was replaced but the email could not be sent", Status: "EMAIL_SEND_FAILED"})
+		return
+	}
+	s.record(c, audit.ActionCodeResend, user, nil)
+	s.respondUpdated(c, user, "Verification code sent")
+}
+
+// findUser loads the user named by the userId path parameter. On failure the
+// error response has been written and ok is false.
+func (s *UsersServiceContext) findUser(c *gin.Context) (*db.AuthUser, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseUser{Message: "Invalid user ID", Status: "INVALID_PARAMETERS"})
+		return nil, false
+	}
+	user, err := s.Users.FindByID(c.Request.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, model.ResponseUser{Message: "User not found", Status: "USER_NOT_FOUND"})
+		return nil, false
+	} else if err != nil {
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to retrieve user", "userID", id.Hex(), "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseUser{Message: "Failed to read the user", Status: "USER_UPDATE_FAILED"})
+		return nil, false
+	}
+	return user, true
+}
+
+func (s *UsersServiceContext) updateFailed(c *gin.Context, user *db.AuthUser, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, model.ResponseUser{Message: "User not found", Status: "USER_NOT_FOUND"})
+		return
+	}
+	s.Logger.ErrorContext(c.Request.Context(), "Failed to update user", "userID", user.ID.Hex(), "error", err.Error())
+	c.JSON(http.StatusInternalServerError, model.ResponseUser{Message: "Failed to update the user", Status: "USER_UPDATE_FAILED"})
+}
+
+// respondUpdated reloads the user after an action and responds with its new state.
+func (s *UsersServiceContext) respondUpdated(c *gin.Context, user *db.AuthUser, message string) {
+	updated, err := s.Users.FindByID(c.Request.Context(), user.ID)
+	if err != nil {
+		s.updateFailed(c, user, err)
+		return
+	}
+	s.respond(c, updated, message)
+}
+
+func (s *UsersServiceContext) respond(c *gin.Context, user *db.AuthUser, message string) {
+	ctx := c.Request.Context()
+	tokens, err := s.Tokens.FindActiveByUser(ctx, user.ID, time.Now())
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to retrieve sessions", "userID", user.ID.Hex(), "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseUser{Message: "Failed to read the sessions", Status: "USER_UPDATE_FAILED"})
+		return
+	}
+	c.JSON(http.StatusOK, model.ResponseUser{Message: message, Status: "OK", User: details(user, tokens)})
+}
+
+// record appends an admin action on user to the audit log.
+func (s *UsersServiceContext) record(c *gin.Context, action string, user *db.AuthUser, details map[string]string) {
+	s.recordOutcome(c, action, user, audit.OutcomeSuccess, "", details)
+}
+
+func (s *UsersServiceContext) recordOutcome(c *gin.Context, action string, user *db.AuthUser, outcome, reason string, details map[string]string) {
+	s.Audit.RecordRequest(c, audit.Event{
+		Action:  audit.AdminPrefix + action,
+		Outcome: outcome,
+		Reason:  reason,
+		ActorID: middleware.AdminActor(c),
+		UserID:  user.ID.Hex(),
+		Email:   user.Email,
+		Details: details,
+	})
+}
+
+func summary(user *db.AuthUser) model.UserSummary {
+	return model.UserSummary{
+		ID:                  user.ID.Hex(),
+		Email:               user.Email,
+		EmailVerified:       user.EmailVerified,
+		Status:              user.AccountStatus(),
+		StatusReason:        user.StatusReason,
+		StatusChangedAt:     timeOrNil(user.StatusChangedAt),
+		DeletionScheduledAt: timeOrNil(user.DeletionScheduledAt),
+		CreatedAt:           user.CreatedAt,
+	}
+}
+
+func details(user *db.AuthUser, tokens []db.AuthToken) *model.UserDetails {
+	result := &model.UserDetails{
+		UserSummary:         summary(user),
+		Roles:               rbac.EffectiveRoles(user),
+		VerificationPending: !user.EmailVerified && user.Code != "",
+		HasPassword:         user.Password != "",
+		Lockout:             model.Lockout{AttemptCount: user.AttemptCount},
+		Sessions:            make([]model.Session, 0, len(tokens)),
+	}
+	if lastAttempt := timeOrNil(user.LastAttemptTime); lastAttempt != nil {
+		result.Lockout.LastAttemptTime = lastAttempt
+		// Та же проверка, что и в verifycode.VerifyCodeHandler
+		if lockedUntil := lastAttempt.Add(verifycode.LockoutDuration); user.AttemptCount >= verifycode.MaxAttempts && time.Now().Before(lockedUntil) {
+			result.Lockout.Locked = true
+			result.Lockout.LockedUntil = &lockedUntil
+		}
+	}
+	for _, token := range tokens {
+		result.Sessions = append(result.Sessions, model.Session{
+			DeviceInfoID: token.DeviceInfoID.Hex(),
+			CreatedAt:    token.CreatedAt,
+			ExpiresAt:    token.ExpiresAt,
+		})
+	}
+	return result
+}
+
+// timeOrNil returns nil for the zero time, so that it is omitted from the response.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
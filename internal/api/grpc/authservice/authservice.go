@@ -0,0 +1,161 @@
+// Package authservice implements the gRPC AuthService defined in proto/auth.proto
+// on top of the same repositories, signing keys and audit log as the HTTP API.
+package authservice
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/grpcserver"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/keys"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/a-dev-mobile/kidneysmart-auth/pkg/authmw"
+	"github.com/a-dev-mobile/kidneysmart-auth/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type AuthServiceContext struct {
+	proto.UnimplementedAuthServiceServer
+
+	Users  repository.UserRepository
+	Tokens repository.TokenRepository
+	Audit  *audit.Recorder
+	Keys   *keys.Manager
+	Logger *slog.Logger
+	Config *config.Config
+}
+
+func NewAuthServiceContext(users repository.UserRepository, tokens repository.TokenRepository, recorder *audit.Recorder, signingKeys *keys.Manager, lg *slog.Logger, cfg *config.Config) *AuthServiceContext {
+	return &AuthServiceContext{
+		Users:  users,
+		Tokens: tokens,
+		Audit:  recorder,
+		Keys:   signingKeys,
+		Logger: lg,
+		Config: cfg,
+	}
+}
+
+// ValidateToken checks a user access token and the account it was issued to.
+// Invalid tokens are reported in the response with the same status codes as the
+// HTTP AuthMiddleware, e.g. ACCOUNT_SUSPENDED.
+func (s *AuthServiceContext) ValidateToken(ctx context.Context, req *proto.ValidateTokenRequest) (*proto.ValidateTokenResponse, error) {
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "access_token is required")
+	}
+
+	userID, err := utils.ParseToken(req.GetAccessToken(), s.Keys, "access")
+	if err != nil {
+		code, message := utils.TokenErrorStatus(err)
+		return &proto.ValidateTokenResponse{Valid: false, Status: code, Message: message}, nil
+	}
+	if err := account.CheckUserID(ctx, s.Users, userID); errors.Is(err, authmw.ErrVerifierUnavailable) {
+		s.Logger.ErrorContext(ctx, "Failed to check account status", "userID", userID, "error", err.Error())
+		return nil, status.Error(codes.Internal, "failed to retrieve user")
+	} else if err != nil {
+		code, message := utils.TokenErrorStatus(err)
+		return &proto.ValidateTokenResponse{Valid: false, Status: code, Message: message}, nil
+	}
+	return &proto.ValidateTokenResponse{Valid: true, UserId: userID, Status: "VALID", Message: "Token is valid"}, nil
+}
+
+// GetUser returns the public part of an account.
+func (s *AuthServiceContext) GetUser(ctx context.Context, req *proto.GetUserRequest) (*proto.GetUserResponse, error) {
+	user, err := s.findUser(ctx, req.GetUserId(), req.GetEmail())
+	if err != nil {
+		return nil, err
+	}
+	return &proto.GetUserResponse{User: toProtoUser(user)}, nil
+}
+
+// RevokeSessions deactivates every refresh token of a user and records it in the audit log.
+func (s *AuthServiceContext) RevokeSessions(ctx context.Context, req *proto.RevokeSessionsRequest) (*proto.RevokeSessionsResponse, error) {
+	user, err := s.findUser(ctx, req.GetUserId(), req.GetEmail())
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.Tokens.RevokeByUser(ctx, user.ID)
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to revoke sessions", "userID", user.ID.Hex(), "error", err.Error())
+		return nil, status.Error(codes.Internal, "failed to revoke sessions")
+	}
+
+	service, _ := grpcserver.ServiceFromContext(ctx)
+	s.Audit.Record(ctx, audit.Event{
+		Action:  audit.AdminPrefix + audit.ActionSessionsRevoke,
+		Outcome: audit.OutcomeSuccess,
+		Reason:  req.GetReason(),
+		ActorID: "service:" + service,
+		UserID:  user.ID.Hex(),
+		Email:   user.Email,
+		Details: map[string]string{"revokedSessions": strconv.FormatInt(revoked, 10)},
+	})
+	return &proto.RevokeSessionsResponse{Revoked: revoked}, nil
+}
+
+// IssueServiceToken returns a short-lived token for the service that presented its credentials.
+func (s *AuthServiceContext) IssueServiceToken(ctx context.Context, _ *proto.IssueServiceTokenRequest) (*proto.IssueServiceTokenResponse, error) {
+	service, ok := grpcserver.ServiceFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "service credentials are required")
+	}
+
+	ttl := time.Duration(s.Config.GrpcConnection.ServiceTokenTTLMinutes) * time.Minute
+	expiresAt := time.Now().UTC().Add(ttl)
+	token, err := utils.GenerateServiceToken(service, s.Keys, expiresAt)
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to generate service token", "service", service, "error", err.Error())
+		return nil, status.Error(codes.Internal, "failed to generate service token")
+	}
+	return &proto.IssueServiceTokenResponse{AccessToken: token, ExpiresAt: timestamppb.New(expiresAt)}, nil
+}
+
+// findUser looks a user up by ID or email and maps the repository errors to gRPC status codes.
+func (s *AuthServiceContext) findUser(ctx context.Context, userID, email string) (*db.AuthUser, error) {
+	var user *db.AuthUser
+	var err error
+	switch {
+	case userID != "":
+		id, idErr := primitive.ObjectIDFromHex(userID)
+		if idErr != nil {
+			return nil, status.Error(codes.InvalidArgument, "user_id is not a valid ID")
+		}
+		user, err = s.Users.FindByID(ctx, id)
+	case email != "":
+		user, err = s.Users.FindByEmail(ctx, email)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "user_id or email is required")
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to retrieve user", "error", err.Error())
+		return nil, status.Error(codes.Internal, "failed to retrieve user")
+	}
+	return user, nil
+}
+
+func toProtoUser(user *db.AuthUser) *proto.User {
+	return &proto.User{
+		Id:            user.ID.Hex(),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		PasswordSet:   user.Password != "",
+		Disabled:      user.AccountStatus() != db.StatusActive,
+		CreatedAt:     timestamppb.New(user.CreatedAt),
+	}
+}
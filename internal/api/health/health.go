@@ -0,0 +1,160 @@
+// Package health serves the liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+const defaultCheckTimeout = 2 * time.Second
+
+// Check verifies a single dependency and returns an error if it is unavailable.
+type Check func(ctx context.Context) error
+
+// ResponseHealth is the body returned by the probe endpoints.
+type ResponseHealth struct {
+	// Status is "OK" for liveness, "READY", "NOT_READY" or "SHUTTING_DOWN" for readiness.
+	Status string `json:"status"`
+	// Checks holds the status of every dependency, keyed by its name.
+	Checks map[string]DependencyStatus `json:"checks,omitempty"`
+}
+
+// DependencyStatus describes the state of a single dependency. The reason a
+// dependency is down is only logged, as the probe is served publicly.
+type DependencyStatus struct {
+	// Status is "UP" or "DOWN".
+	Status string `json:"status"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type HealthServiceContext struct {
+	Logger       *slog.Logger
+	Ready        func() bool
+	ShuttingDown func() bool
+	CheckTimeout time.Duration
+
+	checks []namedCheck
+}
+
+// NewHealthServiceContext returns the probe handlers. ready reports whether the
+// instance has finished starting, shuttingDown whether shutdown has begun.
+func NewHealthServiceContext(lg *slog.Logger, ready, shuttingDown func() bool, checkTimeout time.Duration) *HealthServiceContext {
+	if checkTimeout <= 0 {
+		checkTimeout = defaultCheckTimeout
+	}
+	return &HealthServiceContext{
+		Logger:       lg,
+		Ready:        ready,
+		ShuttingDown: shuttingDown,
+		CheckTimeout: checkTimeout,
+	}
+}
+
+// AddCheck registers a dependency check that is run by the readiness probe.
+func (s *HealthServiceContext) AddCheck(name string, check Check) {
+	s.checks = append(s.checks, namedCheck{name: name, check: check})
+}
+
+// LivenessHandler reports that the process is alive and able to serve requests.
+// @Summary Liveness probe
+// @Tags health
+// @Produce json
+// @Success 200 {object} ResponseHealth
+// @Router /healthz [get]
+func (s *HealthServiceContext) LivenessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, ResponseHealth{Status: "OK"})
+}
+
+// ReadinessHandler reports whether the instance can receive traffic. It fails as
+// soon as shutdown begins, and otherwise runs every dependency check concurrently.
+// @Summary Readiness probe
+// @Tags health
+// @Produce json
+// @Success 200 {object} ResponseHealth
+// @Failure 503 {object} ResponseHealth
+// @Router /readyz [get]
+func (s *HealthServiceContext) ReadinessHandler(c *gin.Context) {
+	if s.ShuttingDown() {
+		c.JSON(http.StatusServiceUnavailable, ResponseHealth{Status: "SHUTTING_DOWN"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.CheckTimeout)
+	defer cancel()
+
+	results := make(map[string]DependencyStatus, len(s.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range s.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+			status := DependencyStatus{Status: "UP"}
+			if err := nc.check(ctx); err != nil {
+				status = DependencyStatus{Status: "DOWN"}
+				s.Logger.Warn("Readiness check failed", slog.String("dependency", nc.name), slog.String("error", err.Error()))
+			}
+			mu.Lock()
+			results[nc.name] = status
+			mu.Unlock()
+		}(nc)
+	}
+	wg.Wait()
+
+	ready := s.Ready()
+	for _, status := range results {
+		if status.Status != "UP" {
+			ready = false
+		}
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, ResponseHealth{Status: "NOT_READY", Checks: results})
+		return
+	}
+	c.JSON(http.StatusOK, ResponseHealth{Status: "READY", Checks: results})
+}
+
+// GRPCConnCheck reports a gRPC client connection as down while it is failing or closed.
+// An idle connection is asked to reconnect and counted as up.
+func GRPCConnCheck(conn *grpc.ClientConn) Check {
+	return func(ctx context.Context) error {
+		switch state := conn.GetState(); state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Idle:
+			conn.Connect()
+			return nil
+		case connectivity.Shutdown:
+			return errors.New("connection is closed")
+		default:
+			// Give a connecting channel the rest of the timeout to become ready.
+			if conn.WaitForStateChange(ctx, state) && conn.GetState() == connectivity.Ready {
+				return nil
+			}
+			return errors.New("connection is " + conn.GetState().String())
+		}
+	}
+}
+
+// SigningKeyCheck reports the signing keys as down when none is configured.
+func SigningKeyCheck(loaded func() bool) Check {
+	return func(context.Context) error {
+		if !loaded() {
+			return errors.New("no signing key loaded")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,295 @@
+package accountdeletion
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/accountdeletion/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/verifycode"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/a-dev-mobile/kidneysmart-auth/pkg/authmw"
+	"github.com/a-dev-mobile/kidneysmart-auth/pkg/emailclient"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/exp/slog"
+)
+
+type AccountDeletionServiceContext struct {
+	Users       repository.UserRepository
+	Tokens      repository.TokenRepository
+	Audit       *audit.Recorder
+	EmailClient *emailclient.EmailClient
+	Logger      *slog.Logger
+	Config      *config.Config
+}
+
+func NewAccountDeletionServiceContext(users repository.UserRepository, tokens repository.TokenRepository, recorder *audit.Recorder, emailClient *emailclient.EmailClient, lg *slog.Logger, cfg *config.Config) *AccountDeletionServiceContext {
+	return &AccountDeletionServiceContext{
+		Users:       users,
+		Tokens:      tokens,
+		Audit:       recorder,
+		EmailClient: emailClient,
+		Logger:      lg,
+		Config:      cfg,
+	}
+}
+
+// ReauthenticateHandler sends a code confirming the deletion to the email of the account.
+// @Summary Request a re-authentication code
+// @Description Sends a code to the email of the account. The code confirms DELETE /account
+// @Description and is valid for account.reauthMaxAgeMinutes.
+// @Tags account
+// @Produce json
+// @Param Authorization header string true "Bearer access token"
+// @Success 200 {object} model.ResponseAccountDeletion "Code sent"
+// @Failure 401 {object} authmw.ErrorResponse "Missing or invalid token"
+// @Failure 403 {object} model.ResponseAccountDeletion "The token does not represent the user or the account is not active"
+// @Failure 429 {object} model.ResponseAccountDeletion "Too many wrong codes, please try again later"
+// @Failure 502 {object} model.ResponseAccountDeletion "The email could not be sent"
+// @Router /account/reauthenticate [post]
+func (s *AccountDeletionServiceContext) ReauthenticateHandler(c *gin.Context) {
+	user, ok := s.findUser(c)
+	if !ok {
+		return
+	}
+	// A new code resets the attempt counter, so it is not sent during a lockout
+	if lockedOut(user) {
+		c.JSON(http.StatusTooManyRequests, model.ResponseAccountDeletion{Message: "Too many attempts, please try again later", Status: "TOO_MANY_ATTEMPTS"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	code := utils.GenerateRandomCode()
+	if err := s.Users.SetCode(ctx, user.Email, code, time.Now().UTC()); err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to store re-authentication code", "userID", user.ID.Hex(), "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAccountDeletion{Message: "Failed to create the code", Status: "INTERNAL_ERROR"})
+		return
+	}
+	if err := s.sendReauthenticationEmail(ctx, user.Email, code); err != nil {
+		s.Logger.WarnContext(ctx, "Failed to send email", "userID", user.ID.Hex(), "error", err.Error())
+		s.record(c, audit.ActionReauthentication, user, audit.OutcomeFailure, "EMAIL_SEND_FAILED", nil)
+		c.JSON(http.StatusBadGateway, model.ResponseAccountDeletion{Message: "The code could not be sent", Status: "EMAIL_SEND_FAILED"})
+		return
+	}
+	s.record(c, audit.ActionReauthentication, user, audit.OutcomeSuccess, "", nil)
+	c.JSON(http.StatusOK, model.ResponseAccountDeletion{Message: "Code sent to the email of the account", Status: "REAUTHENTICATION_CODE_SENT"})
+}
+
+// DeleteAccountHandler schedules the deletion of the account.
+// @Summary Delete the account
+// @Description Confirms the deletion with the code from /account/reauthenticate. The account is
+// @Description pending deletion for account.deletionGracePeriodHours and all sessions are revoked.
+// @Description Until then the deletion can be cancelled with the returned token, which is also sent
+// @Description by email. Afterwards the account and its data are removed and downstream services are
+// @Description notified with the account.deleted event.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer access token"
+// @Param RequestDeleteAccount body model.RequestDeleteAccount true "Re-authentication code"
+// @Success 202 {object} model.ResponseAccountDeletion "Deletion scheduled"
+// @Failure 400 {object} model.ResponseAccountDeletion "Invalid request body or parameters"
+// @Failure 401 {object} model.ResponseAccountDeletion "Re-authentication required or invalid code"
+// @Failure 403 {object} model.ResponseAccountDeletion "The token does not represent the user or the account is not active"
+// @Failure 429 {object} model.ResponseAccountDeletion "Too many wrong codes, please try again later"
+// @Failure 500 {object} model.ResponseAccountDeletion "Internal server error"
+// @Router /account [delete]
+func (s *AccountDeletionServiceContext) DeleteAccountHandler(c *gin.Context) {
+	var req model.RequestDeleteAccount
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseAccountDeletion{Message: "Invalid request body", Status: "INVALID_REQUEST_BODY"})
+		return
+	}
+	if err := req.Validate(); err != nil || !utils.ValidateCode(req.Code) {
+		c.JSON(http.StatusBadRequest, model.ResponseAccountDeletion{Message: "Invalid request parameters", Status: "INVALID_PARAMETERS"})
+		return
+	}
+
+	user, ok := s.findUser(c)
+	if !ok {
+		return
+	}
+	if lockedOut(user) {
+		s.record(c, audit.ActionAccountDeletionRequest, user, audit.OutcomeFailure, "TOO_MANY_ATTEMPTS", nil)
+		c.JSON(http.StatusTooManyRequests, model.ResponseAccountDeletion{Message: "Too many attempts, please try again later", Status: "TOO_MANY_ATTEMPTS"})
+		return
+	}
+	maxAge := time.Duration(s.Config.Account.ReauthMaxAgeMinutes) * time.Minute
+	if user.Code == "" || user.CodeSentAt.IsZero() || time.Since(user.CodeSentAt) > maxAge {
+		c.JSON(http.StatusUnauthorized, model.ResponseAccountDeletion{Message: "Request a re-authentication code first", Status: "REAUTHENTICATION_REQUIRED"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	// Every submitted code uses up an attempt before it is compared
+	if err := s.Users.CountAttempt(ctx, user.Email, verifycode.MaxAttempts, verifycode.LockoutDuration, time.Now()); errors.Is(err, repository.ErrTooManyAttempts) {
+		s.record(c, audit.ActionAccountDeletionRequest, user, audit.OutcomeFailure, "TOO_MANY_ATTEMPTS", nil)
+		c.JSON(http.StatusTooManyRequests, model.ResponseAccountDeletion{Message: "Too many attempts, please try again later", Status: "TOO_MANY_ATTEMPTS"})
+		return
+	} else if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to count attempt", "userID", user.ID.Hex(), "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAccountDeletion{Message: "Failed to verify the code", Status: "INTERNAL_ERROR"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(user.Code), []byte(req.Code)) != 1 {
+		s.record(c, audit.ActionAccountDeletionRequest, user, audit.OutcomeFailure, "INVALID_CODE", nil)
+		c.JSON(http.StatusUnauthorized, model.ResponseAccountDeletion{Message: "Invalid code", Status: "INVALID_CODE"})
+		return
+	}
+
+	gracePeriod := time.Duration(s.Config.Account.DeletionGracePeriodHours) * time.Hour
+	cancelToken, deleteAt, err := account.ScheduleDeletion(ctx, s.Users, s.Tokens, user, gracePeriod)
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to schedule account deletion", "userID", user.ID.Hex(), "error", err.Error())
+		s.record(c, audit.ActionAccountDeletionRequest, user, audit.OutcomeFailure, "INTERNAL_ERROR", nil)
+		c.JSON(http.StatusInternalServerError, model.ResponseAccountDeletion{Message: "Failed to schedule the deletion", Status: "INTERNAL_ERROR"})
+		return
+	}
+	s.record(c, audit.ActionAccountDeletionRequest, user, audit.OutcomeSuccess, "", map[string]string{
+		"deletionScheduledAt": deleteAt.Format(time.RFC3339),
+	})
+
+	// The app may lose the token, so it is sent by email as well
+	if err := s.sendDeletionEmail(ctx, user.Email, cancelToken, deleteAt); err != nil {
+		s.Logger.WarnContext(ctx, "Failed to send email", "userID", user.ID.Hex(), "error", err.Error())
+	}
+
+	c.JSON(http.StatusAccepted, model.ResponseAccountDeletion{
+		Message:             "The account will be deleted at the end of the grace period",
+		Status:              "DELETION_SCHEDULED",
+		DeletionScheduledAt: &deleteAt,
+		CancelToken:         cancelToken,
+	})
+}
+
+// CancelDeletionHandler cancels a pending deletion of the account.
+// @Summary Cancel the deletion of the account
+// @Description Makes an account pending deletion active again. The sessions revoked by the
+// @Description deletion request stay revoked.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param RequestCancelDeletion body model.RequestCancelDeletion true "Email and cancel token"
+// @Success 200 {object} model.ResponseAccountDeletion "Deletion cancelled"
+// @Failure 400 {object} model.ResponseAccountDeletion "Invalid request, unknown account or invalid cancel token"
+// @Failure 500 {object} model.ResponseAccountDeletion "Internal server error"
+// @Router /account/deletion/cancel [post]
+func (s *AccountDeletionServiceContext) CancelDeletionHandler(c *gin.Context) {
+	var req model.RequestCancelDeletion
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseAccountDeletion{Message: "Invalid request body", Status: "INVALID_REQUEST_BODY"})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseAccountDeletion{Message: "Invalid request parameters", Status: "INVALID_PARAMETERS"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	invalid := model.ResponseAccountDeletion{Message: "The deletion cannot be cancelled with this token", Status: "INVALID_CANCEL_TOKEN"}
+	user, err := s.Users.FindByEmail(ctx, req.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Same response as a wrong token, so that the endpoint does not reveal accounts
+		c.JSON(http.StatusBadRequest, invalid)
+		return
+	} else if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to retrieve user", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAccountDeletion{Message: "Failed to cancel the deletion", Status: "INTERNAL_ERROR"})
+		return
+	}
+
+	err = account.CancelDeletion(ctx, s.Users, user, req.CancelToken)
+	if errors.Is(err, account.ErrInvalidCancelToken) {
+		s.record(c, audit.ActionAccountDeletionCancel, user, audit.OutcomeFailure, "INVALID_CANCEL_TOKEN", nil)
+		c.JSON(http.StatusBadRequest, invalid)
+		return
+	} else if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to cancel account deletion", "userID", user.ID.Hex(), "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAccountDeletion{Message: "Failed to cancel the deletion", Status: "INTERNAL_ERROR"})
+		return
+	}
+	s.record(c, audit.ActionAccountDeletionCancel, user, audit.OutcomeSuccess, "", nil)
+	c.JSON(http.StatusOK, model.ResponseAccountDeletion{Message: "The deletion was cancelled, please sign in again", Status: "DELETION_CANCELLED"})
+}
+
+// findUser loads the active user of the access token. Only tokens issued to the
+// KidneySmart apps are accepted: machine clients do not represent a user and
+// third-party clients must not delete accounts. On failure the error response
+// has been written and ok is false.
+func (s *AccountDeletionServiceContext) findUser(c *gin.Context) (*db.AuthUser, bool) {
+	claims, _ := authmw.ClaimsFromContext(c.Request.Context())
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, authmw.ErrorResponse{Status: "AUTHORIZATION_REQUIRED", Message: "Authorization header is required"})
+		return nil, false
+	}
+	if claims.IsClient() {
+		c.JSON(http.StatusForbidden, model.ResponseAccountDeletion{Message: "Tokens of machine clients do not represent a user", Status: "USER_TOKEN_REQUIRED"})
+		return nil, false
+	}
+	if claims.ClientID != "" {
+		c.JSON(http.StatusForbidden, model.ResponseAccountDeletion{Message: "The account can only be deleted from the KidneySmart apps", Status: "FIRST_PARTY_TOKEN_REQUIRED"})
+		return nil, false
+	}
+
+	ctx := c.Request.Context()
+	id, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, authmw.ErrorResponse{Status: "INVALID_TOKEN", Message: "The provided token is invalid. Check the token and try again."})
+		return nil, false
+	}
+	user, err := s.Users.FindByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, model.ResponseAccountDeletion{Message: "User not found", Status: "USER_NOT_FOUND"})
+		return nil, false
+	} else if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to retrieve user", "userID", claims.UserID, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAccountDeletion{Message: "Failed to get user details", Status: "INTERNAL_ERROR"})
+		return nil, false
+	}
+	if err := account.StatusError(user); err != nil {
+		status, message := utils.TokenErrorStatus(err)
+		c.JSON(http.StatusForbidden, model.ResponseAccountDeletion{Message: message, Status: status})
+		return nil, false
+	}
+	return user, true
+}
+
+func (s *AccountDeletionServiceContext) record(c *gin.Context, action string, user *db.AuthUser, outcome, reason string, details map[string]string) {
+	s.Audit.RecordRequest(c, audit.Event{
+		Action:  action,
+		Outcome: outcome,
+		Reason:  reason,
+		UserID:  user.ID.Hex(),
+		Email:   user.Email,
+		Details: details,
+	})
+}
+
+// lockedOut reports whether the user entered too many wrong codes recently.
+func lockedOut(user *db.AuthUser) bool {
+	return user.AttemptCount >= verifycode.MaxAttempts && time.Since(user.LastAttemptTime) < verifycode.LockoutDuration
+}
+
+func (s *AccountDeletionServiceContext) sendReauthenticationEmail(ctx context.Context, email, code string) error {
+	subject := fmt.Sprintf("Your confirmation code is: %s", code)
+	body := fmt.Sprintf("%s \nPlease use this code to confirm the deletion of your KidneySmart account. "+
+		"If you did not request it, ignore this email.", code)
+	return s.EmailClient.SendEmail(ctx, email, subject, "KidneySmart", "hello@wayofdt.com", body)
+}
+
+func (s *AccountDeletionServiceContext) sendDeletionEmail(ctx context.Context, email, cancelToken string, deleteAt time.Time) error {
+	subject := "Your KidneySmart account will be deleted"
+	body := fmt.Sprintf("Your account and its data will be deleted on %s.\n"+
+		"To keep the account, cancel the deletion before then with this token:\n%s",
+		deleteAt.Format("2 January 2006 15:04 MST"), cancelToken)
+	return s.EmailClient.SendEmail(ctx, email, subject, "KidneySmart", "hello@wayofdt.com", body)
+}
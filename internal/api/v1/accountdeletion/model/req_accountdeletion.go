@@ -0,0 +1,29 @@
+package model
+
+import "github.com/go-playground/validator/v10"
+
+// RequestDeleteAccount confirms the deletion of the account with the code sent by
+// the reauthenticate endpoint.
+type RequestDeleteAccount struct {
+	// @Required
+	Code string `json:"code" validate:"required"`
+}
+
+func (r *RequestDeleteAccount) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+// RequestCancelDeletion cancels a pending deletion with the token returned by the
+// deletion request and sent to the email of the account.
+type RequestCancelDeletion struct {
+	// @Required
+	Email string `json:"email" validate:"required,email"`
+	// @Required
+	CancelToken string `json:"cancelToken" validate:"required,max=128"`
+}
+
+func (r *RequestCancelDeletion) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// ResponseAccountDeletion is returned by the account deletion endpoints.
+type ResponseAccountDeletion struct {
+	Message string `json:"message"`
+	// Status is one of:
+	// - "INVALID_REQUEST_BODY", "INVALID_PARAMETERS"
+	// - "USER_TOKEN_REQUIRED" for tokens of machine clients
+	// - "FIRST_PARTY_TOKEN_REQUIRED" for tokens issued to third-party OAuth clients
+	// - "USER_NOT_FOUND"
+	// - "ACCOUNT_SUSPENDED", "ACCOUNT_PENDING_DELETION"
+	// - "REAUTHENTICATION_CODE_SENT"
+	// - "REAUTHENTICATION_REQUIRED" if no code was requested or it has expired
+	// - "INVALID_CODE"
+	// - "TOO_MANY_ATTEMPTS"
+	// - "DELETION_SCHEDULED"
+	// - "INVALID_CANCEL_TOKEN"
+	// - "DELETION_CANCELLED"
+	// - "EMAIL_SEND_FAILED"
+	// - "INTERNAL_ERROR"
+	Status string `json:"status"`
+	// DeletionScheduledAt is the time the account will be removed, after which the
+	// deletion can no longer be cancelled.
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt,omitempty"`
+	// CancelToken cancels the deletion until DeletionScheduledAt. It is also sent to
+	// the email of the account.
+	CancelToken string `json:"cancelToken,omitempty"`
+}
@@ -0,0 +1,72 @@
+package introspect
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/introspect/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/keys"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/a-dev-mobile/kidneysmart-auth/pkg/authmw"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
+)
+
+type IntrospectServiceContext struct {
+	Users  repository.UserRepository
+	Keys   *keys.Manager
+	Logger *slog.Logger
+
+	verifier authmw.Verifier
+}
+
+func NewIntrospectServiceContext(users repository.UserRepository, signingKeys *keys.Manager, lg *slog.Logger) *IntrospectServiceContext {
+	return &IntrospectServiceContext{
+		Users:    users,
+		Keys:     signingKeys,
+		Logger:   lg,
+		verifier: account.NewVerifier(authmw.NewKeyVerifier(signingKeys), users),
+	}
+}
+
+// IntrospectHandler reports whether an access token is active and returns its claims.
+// @Summary Introspect Access Token
+// @Description Validates an access token as described in RFC 7662. Used by services that cannot verify tokens locally.
+// @Tags token
+// @Accept x-www-form-urlencoded,json
+// @Produce json
+// @Param token formData string true "Access token"
+// @Success 200 {object} model.ResponseIntrospect "Token state; active is false for invalid or expired tokens"
+// @Failure 400 {object} model.ResponseIntrospect "Invalid request body"
+// @Router /introspect [post]
+func (s *IntrospectServiceContext) IntrospectHandler(c *gin.Context) {
+	var req model.RequestIntrospect
+	if err := c.ShouldBind(&req); err != nil || req.Validate() != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseIntrospect{Status: "INVALID_REQUEST_BODY", Message: "token is required"})
+		return
+	}
+
+	// Токены пользователей с неактивной учетной записью не считаются активными
+	claims, err := s.verifier.Verify(c.Request.Context(), req.Token)
+	if errors.Is(err, authmw.ErrVerifierUnavailable) {
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to check account status", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseIntrospect{Status: "INTERNAL_ERROR", Message: "Token could not be verified"})
+		return
+	} else if err != nil {
+		status, message := utils.TokenErrorStatus(err)
+		c.JSON(http.StatusOK, model.ResponseIntrospect{Active: false, Status: status, Message: message})
+		return
+	}
+	c.JSON(http.StatusOK, model.ResponseIntrospect{
+		Active:    true,
+		Sub:       claims.UserID,
+		ClientID:  claims.ClientID,
+		TokenType: claims.TokenType,
+		Exp:       claims.ExpiresAt.Unix(),
+		Scope:     strings.Join(claims.Scopes, " "),
+		Roles:     claims.Roles,
+	})
+}
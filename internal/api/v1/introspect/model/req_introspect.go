@@ -0,0 +1,17 @@
+package model
+
+import (
+	"github.com/go-playground/validator/v10"
+)
+
+// RequestIntrospect is the token introspection request of RFC 7662. The token is
+// accepted as a form field or in a JSON body.
+type RequestIntrospect struct {
+	// @Required
+	Token string `json:"token" form:"token" validate:"required"`
+}
+
+func (a *RequestIntrospect) Validate() error {
+	validate := validator.New()
+	return validate.Struct(a)
+}
@@ -0,0 +1,15 @@
+package model
+
+// ResponseIntrospect follows RFC 7662. For inactive tokens only active, status and
+// message are set; status holds the same code the AuthMiddleware responds with.
+type ResponseIntrospect struct {
+	Active    bool     `json:"active"`
+	Sub       string   `json:"sub,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Status    string   `json:"status,omitempty"`
+	Message   string   `json:"message,omitempty"`
+}
@@ -2,31 +2,35 @@ package login
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/login/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
 	"github.com/a-dev-mobile/kidneysmart-auth/pkg/emailclient"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/exp/slog"
 )
 
 type LoginServiceContext struct {
-	DB          *mongo.Client
+	Users       repository.UserRepository
+	Audit       *audit.Recorder
 	Logger      *slog.Logger
 	Config      *config.Config
 	EmailClient *emailclient.EmailClient
 }
 
-func NewLoginServiceContext(db *mongo.Client, lg *slog.Logger, cfg *config.Config, emailClient *emailclient.EmailClient) *LoginServiceContext {
+func NewLoginServiceContext(users repository.UserRepository, recorder *audit.Recorder, lg *slog.Logger, cfg *config.Config, emailClient *emailclient.EmailClient) *LoginServiceContext {
 	return &LoginServiceContext{
-		DB:          db,
+		Users:       users,
+		Audit:       recorder,
 		Config:      cfg,
 		Logger:      lg,
 		EmailClient: emailClient,
@@ -46,13 +50,14 @@ func NewLoginServiceContext(db *mongo.Client, lg *slog.Logger, cfg *config.Confi
 // @Success 200 {object} model.ResponseLogin "User registered successfully, verification code sent"
 // @Success 401 {object} model.ResponseLogin "Unauthorized - Email not verified or Password entry required"
 // @Failure 400 {object} model.ResponseLogin "Invalid request body or parameters"
+// @Failure 403 {object} model.ResponseLogin "Account is disabled"
 // @Failure 500 {object} model.ResponseLogin "Internal server error"
 // @Router /login [post]
 func (s *LoginServiceContext) LoginUserHandler(c *gin.Context) {
 	var reqLogin model.RequestLogin
 
 	if err := c.ShouldBindJSON(&reqLogin); err != nil {
-		s.Logger.Error("Failed to bind JSON", "error", err.Error())
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to bind JSON", "error", err.Error())
 		c.JSON(http.StatusBadRequest, model.ResponseLogin{
 			Message: "Invalid request body",
 			Status:  "INVALID_REQUEST_BODY",
@@ -76,14 +81,11 @@ func (s *LoginServiceContext) LoginUserHandler(c *gin.Context) {
 		return
 	}
 
-	authUserCollection := s.Config.Database.Collections.AuthUser
-	collection := s.DB.Database(s.Config.Database.Name).Collection(authUserCollection)
-
 	ctx := c.Request.Context()
 
-	userDetails, err := getUserDetails(ctx, collection, reqLogin.Email)
+	userDetails, err := s.getUserDetails(ctx, reqLogin.Email)
 	if err != nil {
-		s.Logger.Error("Failed to get user details", "email", reqLogin.Email, "error", err.Error())
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to get user details", "email", reqLogin.Email, "error", err.Error())
 		c.JSON(http.StatusInternalServerError, model.ResponseLogin{
 			Message: "Failed to get user details",
 			Status:  "INTERNAL_ERROR",
@@ -92,7 +94,14 @@ func (s *LoginServiceContext) LoginUserHandler(c *gin.Context) {
 	}
 
 	if userDetails != nil {
-		if !userDetails.EmailVerified {
+		if err := account.StatusError(userDetails); err != nil {
+			status, message := utils.TokenErrorStatus(err)
+			c.JSON(http.StatusForbidden, model.ResponseLogin{
+				Message: message,
+				Status:  status,
+			})
+			return
+		} else if !userDetails.EmailVerified {
 			c.JSON(http.StatusUnauthorized, model.ResponseLogin{
 				Message: "Email not verified. Please verify your email.",
 				Status:  "EMAIL_VERIFICATION_REQUIRED",
@@ -114,8 +123,14 @@ func (s *LoginServiceContext) LoginUserHandler(c *gin.Context) {
 	}
 
 	code := utils.GenerateRandomCode()
-	if err := createUser(ctx, collection, reqLogin.Email, code); err != nil {
-		s.Logger.Error("Failed to create user", "email", reqLogin.Email, "error", err.Error())
+	if err := s.Users.Create(ctx, reqLogin.Email, code); err != nil {
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to create user", "email", reqLogin.Email, "error", err.Error())
+		s.Audit.RecordRequest(c, audit.Event{
+			Action:  audit.ActionRegistration,
+			Outcome: audit.OutcomeFailure,
+			Reason:  "USER_CREATION_FAILED",
+			Email:   reqLogin.Email,
+		})
 		c.JSON(http.StatusInternalServerError, model.ResponseLogin{
 			Message: "Failed to create user",
 			Status:  "USER_CREATION_FAILED",
@@ -123,8 +138,14 @@ func (s *LoginServiceContext) LoginUserHandler(c *gin.Context) {
 		return
 	}
 
-	if err := sendConfirmationEmail(s.EmailClient, reqLogin.Email, code); err != nil {
-		s.Logger.Warn("Failed to send email", "email", reqLogin.Email, "error", err.Error())
+	if err := SendConfirmationEmail(ctx, s.EmailClient, reqLogin.Email, code); err != nil {
+		s.Logger.WarnContext(c.Request.Context(), "Failed to send email", "email", reqLogin.Email, "error", err.Error())
+		s.Audit.RecordRequest(c, audit.Event{
+			Action:  audit.ActionRegistration,
+			Outcome: audit.OutcomeFailure,
+			Reason:  "EMAIL_SEND_FAILED",
+			Email:   reqLogin.Email,
+		})
 		c.JSON(http.StatusInternalServerError, model.ResponseLogin{
 			Message: "User registered but failed to send confirmation email",
 			Status:  "EMAIL_SEND_FAILED",
@@ -132,36 +153,31 @@ func (s *LoginServiceContext) LoginUserHandler(c *gin.Context) {
 		return
 	}
 
+	s.Audit.RecordRequest(c, audit.Event{
+		Action:  audit.ActionRegistration,
+		Outcome: audit.OutcomeSuccess,
+		Email:   reqLogin.Email,
+	})
 	c.JSON(http.StatusOK, model.ResponseLogin{
 		Message: "User registered successfully, verification code sent",
 		Status:  "REGISTRATION_SUCCESSFUL",
 	})
 }
 
-func getUserDetails(ctx context.Context, collection *mongo.Collection, email string) (*db.AuthUser, error) {
-	filter := bson.M{"email": email}
-	var existingUser db.AuthUser
-	err := collection.FindOne(ctx, filter).Decode(&existingUser)
-	if err == mongo.ErrNoDocuments {
+func (s *LoginServiceContext) getUserDetails(ctx context.Context, email string) (*db.AuthUser, error) {
+	existingUser, err := s.Users.FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &existingUser, nil
-}
-
-func createUser(ctx context.Context, collection *mongo.Collection, email, code string) error {
-	newUser := bson.M{
-		"email": email,
-		"code":  code,
-	}
-	_, err := collection.InsertOne(ctx, newUser)
-	return err
+	return existingUser, nil
 }
 
-func sendConfirmationEmail(client *emailclient.EmailClient, email string, code string) error {
+// SendConfirmationEmail отправляет пользователю письмо с кодом подтверждения.
+func SendConfirmationEmail(ctx context.Context, client *emailclient.EmailClient, email string, code string) error {
 	subject := fmt.Sprintf("Your verification code is: %s", code)
 	body := fmt.Sprintf("%s \nPlease use this code to complete your registration.", code)
-	return client.SendEmail(email, subject, "KidneySmart", "hello@wayofdt.com", body)
+	return client.SendEmail(ctx, email, subject, "KidneySmart", "hello@wayofdt.com", body)
 }
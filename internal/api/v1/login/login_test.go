@@ -0,0 +1,192 @@
+package login
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/login/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/pkg/emailclient"
+	pb "github.com/a-dev-mobile/kidneysmart-auth/proto"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeEmailSender records the emails sent through the email-sender API.
+type fakeEmailSender struct {
+	pb.UnimplementedEmailSenderApiServer
+
+	mu   sync.Mutex
+	sent []*pb.EmailSenderRequest
+	fail bool
+}
+
+func (f *fakeEmailSender) SendEmail(_ context.Context, req *pb.EmailSenderRequest) (*pb.EmailSenderResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return nil, errors.New("email-sender is unavailable")
+	}
+	f.sent = append(f.sent, req)
+	return &pb.EmailSenderResponse{}, nil
+}
+
+func newEmailClient(t *testing.T, sender *fakeEmailSender, lg *slog.Logger) *emailclient.EmailClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterEmailSenderApiServer(server, sender)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial email-sender: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return emailclient.NewEmailClient(conn, lg)
+}
+
+func TestLoginUserHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(t *testing.T, users repository.UserRepository)
+		emailFails bool
+		wantCode   int
+		wantStatus string
+		wantEmail  bool
+	}{
+		{
+			name:       "malformed body",
+			body:       `{"email":`,
+			wantCode:   http.StatusBadRequest,
+			wantStatus: "INVALID_REQUEST_BODY",
+		},
+		{
+			name:       "invalid email",
+			body:       `{"email":"not-an-email"}`,
+			wantCode:   http.StatusBadRequest,
+			wantStatus: "INVALID_PARAMETERS",
+		},
+		{
+			name:       "new user is registered",
+			body:       `{"email":"new@example.com"}`,
+			wantCode:   http.StatusOK,
+			wantStatus: "REGISTRATION_SUCCESSFUL",
+			wantEmail:  true,
+		},
+		{
+			name:       "email send failure",
+			body:       `{"email":"new@example.com"}`,
+			emailFails: true,
+			wantCode:   http.StatusInternalServerError,
+			wantStatus: "EMAIL_SEND_FAILED",
+		},
+		{
+			name: "unverified user",
+			body: `{"email":"user@example.com"}`,
+			setup: func(t *testing.T, users repository.UserRepository) {
+				mustCreate(t, users, "user@example.com")
+			},
+			wantCode:   http.StatusUnauthorized,
+			wantStatus: "EMAIL_VERIFICATION_REQUIRED",
+		},
+		{
+			name: "verified user without password",
+			body: `{"email":"user@example.com"}`,
+			setup: func(t *testing.T, users repository.UserRepository) {
+				mustCreate(t, users, "user@example.com")
+				if err := users.SetEmailVerified(ctx, "user@example.com"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantCode:   http.StatusUnauthorized,
+			wantStatus: "PASSWORD_SET_REQUIRED",
+		},
+		{
+			name: "suspended user",
+			body: `{"email":"user@example.com"}`,
+			setup: func(t *testing.T, users repository.UserRepository) {
+				mustCreate(t, users, "user@example.com")
+				if err := users.SetStatus(ctx, "user@example.com", db.StatusSuspended, "test", time.Now()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantCode:   http.StatusForbidden,
+			wantStatus: "ACCOUNT_SUSPENDED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lg := slog.New(slog.NewTextHandler(io.Discard, nil))
+			store := repository.NewMemoryStore()
+			if tt.setup != nil {
+				tt.setup(t, store.Users)
+			}
+			sender := &fakeEmailSender{fail: tt.emailFails}
+			cfg := &config.Config{}
+			cfg.ApplyDefaults()
+			s := NewLoginServiceContext(store.Users, audit.NewRecorder(store.Audit, lg), lg, cfg, newEmailClient(t, sender, lg))
+
+			router := gin.New()
+			router.POST("/login", s.LoginUserHandler)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d; body %s", w.Code, tt.wantCode, w.Body)
+			}
+			var res model.ResponseLogin
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", res.Status, tt.wantStatus)
+			}
+
+			if !tt.wantEmail {
+				if len(sender.sent) != 0 {
+					t.Errorf("%d emails sent, want none", len(sender.sent))
+				}
+				return
+			}
+			user, err := store.Users.FindByEmail(ctx, "new@example.com")
+			if err != nil {
+				t.Fatalf("registered user: %v", err)
+			}
+			if len(sender.sent) != 1 || sender.sent[0].RecipientEmail != user.Email ||
+				!strings.Contains(sender.sent[0].Body, user.Code) {
+				t.Errorf("sent %v, want one email with code %s to %s", sender.sent, user.Code, user.Email)
+			}
+		})
+	}
+}
+
+func mustCreate(t *testing.T, users repository.UserRepository, email string) {
+	t.Helper()
+	if err := users.Create(context.Background(), email, "1234"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -17,6 +17,8 @@ type ResponseLogin struct {
     // - "INVALID_PARAMETERS": The request parameters are invalid.
     // - "INVALID_EMAIL_FORMAT": The provided email format is invalid.
     // - "INTERNAL_ERROR": An internal error occurred.
+    // - "ACCOUNT_SUSPENDED": The account is suspended.
+    // - "ACCOUNT_PENDING_DELETION": The account is scheduled for deletion.
     // - "EMAIL_VERIFICATION_REQUIRED": Email verification is required.
     // - "PASSWORD_SET_REQUIRED": Setting a password is required.
     // - "PASSWORD_ENTRY_REQUIRED": Password entry is required.
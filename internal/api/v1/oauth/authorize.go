@@ -0,0 +1,416 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/oauth/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// AuthorizeHandler starts the authorization code flow.
+// @Summary OAuth 2.0 Authorization Endpoint
+// @Description Validates the authorization request of a registered client and redirects the browser to the sign-in page with a request_id.
+// @Description Without a configured sign-in page the request is returned as JSON. PKCE with S256 is required.
+// @Description Errors are reported to the client's redirect_uri once the client and redirect_uri have been verified.
+// @Tags oauth
+// @Produce json
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "One of the client's registered redirect URIs"
+// @Param scope query string false "Space separated scopes, e.g. openid email profile; defaults to openid"
+// @Param state query string false "Opaque value returned to the client"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Param nonce query string false "OpenID Connect nonce, returned in the ID token"
+// @Success 200 {object} model.ResponseAuthorize "Authorization request created"
+// @Success 302 "Redirect to the sign-in page or, on error, to the client"
+// @Failure 400 {object} model.ResponseOAuthError "Unknown client or redirect_uri"
+// @Router /oauth/authorize [get]
+func (s *OAuthServiceContext) AuthorizeHandler(c *gin.Context) {
+	var req model.RequestAuthorize
+	if err := c.ShouldBindQuery(&req); err != nil || req.Validate() != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseOAuthError{Error: errInvalidRequest, ErrorDescription: "client_id and redirect_uri are required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	client, err := s.Clients.FindByID(ctx, req.ClientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, model.ResponseOAuthError{Error: errInvalidClient, ErrorDescription: "unknown client_id"})
+		return
+	} else if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to retrieve OAuth client", "clientID", req.ClientID, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseOAuthError{Error: errServerError})
+		return
+	}
+	// An unverified redirect_uri must never receive a redirect; machine clients have none
+	if client.Type == db.ClientTypeMachine || !contains(client.RedirectURIs, req.RedirectURI) {
+		c.JSON(http.StatusBadRequest, model.ResponseOAuthError{Error: errInvalidRequest, ErrorDescription: "redirect_uri is not registered for this client"})
+		return
+	}
+
+	fail := func(code, description string) {
+		c.Redirect(http.StatusFound, errorRedirect(req.RedirectURI, code, description, req.State))
+	}
+	if req.ResponseType != "code" {
+		fail(errUnsupportedResponseType, "response_type must be code")
+		return
+	}
+	if req.CodeChallengeMethod != CodeChallengeMethodS256 || !validCodeChallenge(req.CodeChallenge) {
+		fail(errInvalidRequest, "a code_challenge with code_challenge_method S256 is required")
+		return
+	}
+	scopes, ok := parseScopes(req.Scope, client)
+	if !ok {
+		fail(errInvalidScope, "the requested scope is not allowed for this client")
+		return
+	}
+
+	id, err := utils.GenerateOpaqueToken(24)
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to generate authorization request ID", "error", err.Error())
+		fail(errServerError, "authorization request could not be created")
+		return
+	}
+	now := time.Now()
+	authorization := db.OAuthAuthorization{
+		ID:                  id,
+		ClientID:            client.ID,
+		RedirectURI:         req.RedirectURI,
+		Scopes:              scopes,
+		State:               req.State,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		CreatedAt:           now,
+		ExpiresAt:           now.Add(time.Duration(s.Config.OAuth.AuthorizationTTLMinutes) * time.Minute),
+	}
+	if err := s.Authorizations.Create(ctx, authorization); err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to store authorization request", "clientID", client.ID, "error", err.Error())
+		fail(errServerError, "authorization request could not be created")
+		return
+	}
+
+	if loginURL := s.Config.OAuth.LoginURL; loginURL != "" {
+		c.Redirect(http.StatusFound, redirectWith(loginURL, url.Values{"request_id": {id}}, ""))
+		return
+	}
+	c.JSON(http.StatusOK, describe(&authorization, client, "LOGIN_REQUIRED", "Sign in with the code sent by email"))
+}
+
+// AuthorizationRequestHandler returns the client and scopes of an authorization request for the sign-in page.
+// @Summary Get Authorization Request
+// @Description Returns the client name and requested scopes of a pending authorization request.
+// @Tags oauth
+// @Produce json
+// @Param requestId path string true "request_id passed to the sign-in page"
+// @Success 200 {object} model.ResponseAuthorize "Pending authorization request"
+// @Failure 404 {object} model.ResponseAuthorize "Unknown, expired or finished authorization request"
+// @Router /oauth/authorize/requests/{requestId} [get]
+func (s *OAuthServiceContext) AuthorizationRequestHandler(c *gin.Context) {
+	authorization, client, ok := s.loadPending(c, c.Param("requestId"))
+	if !ok {
+		return
+	}
+	status, message := "LOGIN_REQUIRED", "Sign in with the code sent by email"
+	if !authorization.UserID.IsZero() {
+		status, message = "CONSENT_REQUIRED", "Approve the requested access"
+	}
+	c.JSON(http.StatusOK, describe(authorization, client, status, message))
+}
+
+// AuthorizeLoginHandler sends the email code that authenticates the user of an authorization request.
+// @Summary Send Authorization Login Code
+// @Description Sends a verification code to the email address. Unknown addresses are registered as with the app login.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param RequestAuthorizeLogin body model.RequestAuthorizeLogin true "Authorization request and email"
+// @Success 200 {object} model.ResponseAuthorize "Code sent"
+// @Failure 400 {object} model.ResponseAuthorize "Invalid request body"
+// @Failure 403 {object} model.ResponseAuthorize "Account is disabled"
+// @Failure 404 {object} model.ResponseAuthorize "Unknown, expired or finished authorization request"
+// @Failure 429 {object} model.ResponseAuthorize "Too many attempts"
+// @Failure 500 {object} model.ResponseAuthorize "Internal server error"
+// @Router /oauth/authorize/login [post]
+func (s *OAuthServiceContext) AuthorizeLoginHandler(c *gin.Context) {
+	var req model.RequestAuthorizeLogin
+	if err := c.ShouldBindJSON(&req); err != nil || req.Validate() != nil || !utils.ValidateEmail(req.Email) {
+		c.JSON(http.StatusBadRequest, model.ResponseAuthorize{Status: "INVALID_REQUEST_BODY", Message: "requestId and a valid email are required"})
+		return
+	}
+	authorization, _, ok := s.loadPending(c, req.RequestID)
+	if !ok {
+		return
+	}
+	if authorization.AttemptCount >= MaxLoginAttempts {
+		c.JSON(http.StatusTooManyRequests, model.ResponseAuthorize{Status: "TOO_MANY_ATTEMPTS", Message: "Too many attempts, please start over"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	code := utils.GenerateRandomCode()
+	user, err := s.Users.FindByEmail(ctx, req.Email)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		// First sign-in: the account is registered just like by the app login
+		if err := s.Users.Create(ctx, req.Email, code); err != nil {
+			s.Logger.ErrorContext(ctx, "Failed to create user", "email", req.Email, "error", err.Error())
+			c.JSON(http.StatusInternalServerError, model.ResponseAuthorize{Status: "USER_CREATION_FAILED", Message: "Failed to create user"})
+			return
+		}
+		s.Audit.RecordRequest(c, audit.Event{
+			Action:  audit.ActionRegistration,
+			Outcome: audit.OutcomeSuccess,
+			Email:   req.Email,
+			Details: map[string]string{"clientId": authorization.ClientID},
+		})
+	case err != nil:
+		s.Logger.ErrorContext(ctx, "Failed to retrieve user", "email", req.Email, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAuthorize{Status: "INTERNAL_ERROR", Message: "Failed to get user details"})
+		return
+	case account.StatusError(user) != nil:
+		status, message := utils.TokenErrorStatus(account.StatusError(user))
+		c.JSON(http.StatusForbidden, model.ResponseAuthorize{Status: status, Message: message})
+		return
+	}
+
+	if err := s.Authorizations.SetLogin(ctx, authorization.ID, req.Email, code); err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to store login code", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAuthorize{Status: "INTERNAL_ERROR", Message: "Failed to start the login"})
+		return
+	}
+	if err := s.sendLoginCode(ctx, req.Email, code); err != nil {
+		s.Logger.WarnContext(ctx, "Failed to send email", "email", req.Email, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAuthorize{Status: "EMAIL_SEND_FAILED", Message: "Failed to send the verification code"})
+		return
+	}
+	c.JSON(http.StatusOK, model.ResponseAuthorize{Status: "CODE_SENT", Message: "Verification code sent", RequestID: authorization.ID})
+}
+
+// AuthorizeVerifyHandler checks the email code and completes the authorization when consent was given before.
+// @Summary Verify Authorization Login Code
+// @Description Authenticates the user of an authorization request. If the user has already consented to the requested scopes
+// @Description the response holds the redirectUri with the authorization code, otherwise the status is CONSENT_REQUIRED.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param RequestAuthorizeVerify body model.RequestAuthorizeVerify true "Authorization request and code"
+// @Success 200 {object} model.ResponseAuthorize "AUTHORIZED with redirectUri, or CONSENT_REQUIRED"
+// @Failure 400 {object} model.ResponseAuthorize "Invalid request body or login not started"
+// @Failure 401 {object} model.ResponseAuthorize "Invalid code"
+// @Failure 403 {object} model.ResponseAuthorize "Account is disabled"
+// @Failure 404 {object} model.ResponseAuthorize "Unknown, expired or finished authorization request"
+// @Failure 429 {object} model.ResponseAuthorize "Too many attempts"
+// @Failure 500 {object} model.ResponseAuthorize "Internal server error"
+// @Router /oauth/authorize/verify [post]
+func (s *OAuthServiceContext) AuthorizeVerifyHandler(c *gin.Context) {
+	var req model.RequestAuthorizeVerify
+	if err := c.ShouldBindJSON(&req); err != nil || req.Validate() != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseAuthorize{Status: "INVALID_REQUEST_BODY", Message: "requestId and code are required"})
+		return
+	}
+	authorization, client, ok := s.loadPending(c, req.RequestID)
+	if !ok {
+		return
+	}
+	if authorization.LoginCode == "" {
+		c.JSON(http.StatusBadRequest, model.ResponseAuthorize{Status: "LOGIN_REQUIRED", Message: "Request a verification code first"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	// Every submitted code uses up an attempt before it is compared
+	if err := s.Authorizations.CountAttempt(ctx, authorization.ID, MaxLoginAttempts); errors.Is(err, repository.ErrTooManyAttempts) {
+		c.JSON(http.StatusTooManyRequests, model.ResponseAuthorize{Status: "TOO_MANY_ATTEMPTS", Message: "Too many attempts, please start over"})
+		return
+	} else if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to count login attempt", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAuthorize{Status: "INTERNAL_ERROR", Message: "Failed to verify the code"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(authorization.LoginCode), []byte(req.Code)) != 1 {
+		s.Audit.RecordRequest(c, audit.Event{
+			Action:  audit.ActionOAuthLogin,
+			Outcome: audit.OutcomeFailure,
+			Reason:  "INVALID_CODE",
+			Email:   authorization.Email,
+			Details: map[string]string{"clientId": client.ID},
+		})
+		c.JSON(http.StatusUnauthorized, model.ResponseAuthorize{Status: "INVALID_CODE", Message: "Invalid code"})
+		return
+	}
+
+	user, err := s.Users.FindByEmail(ctx, authorization.Email)
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to retrieve user", "email", authorization.Email, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAuthorize{Status: "INTERNAL_ERROR", Message: "Failed to get user details"})
+		return
+	}
+	if err := account.StatusError(user); err != nil {
+		status, message := utils.TokenErrorStatus(err)
+		c.JSON(http.StatusForbidden, model.ResponseAuthorize{Status: status, Message: message})
+		return
+	}
+	// The code proves access to the mailbox just like the app's verification step
+	if !user.EmailVerified {
+		if err := s.Users.SetEmailVerified(ctx, user.Email); err != nil {
+			s.Logger.ErrorContext(ctx, "Failed to verify email", "email", user.Email, "error", err.Error())
+			c.JSON(http.StatusInternalServerError, model.ResponseAuthorize{Status: "INTERNAL_ERROR", Message: "Failed to verify email"})
+			return
+		}
+	}
+	authTime := time.Now().UTC()
+	if err := s.Authorizations.SetUser(ctx, authorization.ID, user.ID, authTime); err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to store authenticated user", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAuthorize{Status: "INTERNAL_ERROR", Message: "Failed to complete the login"})
+		return
+	}
+	authorization.UserID, authorization.AuthTime = user.ID, authTime
+	s.Audit.RecordRequest(c, audit.Event{
+		Action:  audit.ActionOAuthLogin,
+		Outcome: audit.OutcomeSuccess,
+		UserID:  user.ID.Hex(),
+		Email:   user.Email,
+		Details: map[string]string{"clientId": client.ID},
+	})
+
+	consent, err := s.Consents.Find(ctx, user.ID, client.ID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		s.Logger.ErrorContext(ctx, "Failed to retrieve consent", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAuthorize{Status: "INTERNAL_ERROR", Message: "Failed to retrieve consent"})
+		return
+	}
+	if consent == nil || !covers(consent.Scopes, authorization.Scopes) {
+		c.JSON(http.StatusOK, describe(authorization, client, "CONSENT_REQUIRED", "Approve the requested access"))
+		return
+	}
+	s.respondAuthorized(c, authorization, client)
+}
+
+// AuthorizeConsentHandler records the user's decision and completes the authorization.
+// @Summary Consent to Authorization Request
+// @Description Grants or denies the requested scopes. Both outcomes return the redirectUri the browser must be sent to.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param RequestAuthorizeConsent body model.RequestAuthorizeConsent true "Authorization request and decision"
+// @Success 200 {object} model.ResponseAuthorize "AUTHORIZED or ACCESS_DENIED with redirectUri"
+// @Failure 400 {object} model.ResponseAuthorize "Invalid request body or user not signed in"
+// @Failure 404 {object} model.ResponseAuthorize "Unknown, expired or finished authorization request"
+// @Failure 500 {object} model.ResponseAuthorize "Internal server error"
+// @Router /oauth/authorize/consent [post]
+func (s *OAuthServiceContext) AuthorizeConsentHandler(c *gin.Context) {
+	var req model.RequestAuthorizeConsent
+	if err := c.ShouldBindJSON(&req); err != nil || req.Validate() != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseAuthorize{Status: "INVALID_REQUEST_BODY", Message: "requestId is required"})
+		return
+	}
+	authorization, client, ok := s.loadPending(c, req.RequestID)
+	if !ok {
+		return
+	}
+	if authorization.UserID.IsZero() {
+		c.JSON(http.StatusBadRequest, model.ResponseAuthorize{Status: "LOGIN_REQUIRED", Message: "Sign in before giving consent"})
+		return
+	}
+
+	event := audit.Event{
+		Action:  audit.ActionOAuthConsent,
+		Outcome: audit.OutcomeSuccess,
+		UserID:  authorization.UserID.Hex(),
+		Email:   authorization.Email,
+		Details: map[string]string{"clientId": client.ID, "scope": strings.Join(authorization.Scopes, " ")},
+	}
+	if !req.Approve {
+		event.Outcome, event.Reason = audit.OutcomeFailure, "ACCESS_DENIED"
+		s.Audit.RecordRequest(c, event)
+		c.JSON(http.StatusOK, model.ResponseAuthorize{
+			Status:      "ACCESS_DENIED",
+			Message:     "Access was denied",
+			RedirectURI: errorRedirect(authorization.RedirectURI, errAccessDenied, "the user denied the request", authorization.State),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := s.Consents.Grant(ctx, authorization.UserID, client.ID, authorization.Scopes, time.Now()); err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to store consent", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAuthorize{Status: "INTERNAL_ERROR", Message: "Failed to store consent"})
+		return
+	}
+	s.Audit.RecordRequest(c, event)
+	s.respondAuthorized(c, authorization, client)
+}
+
+// respondAuthorized issues the authorization code and returns the redirect URI carrying it.
+func (s *OAuthServiceContext) respondAuthorized(c *gin.Context, authorization *db.OAuthAuthorization, client *db.OAuthClient) {
+	redirectURI, err := s.issueCode(c.Request.Context(), authorization)
+	if err != nil {
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to issue authorization code", "clientID", client.ID, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseAuthorize{Status: "INTERNAL_ERROR", Message: "Failed to issue the authorization code"})
+		return
+	}
+	c.JSON(http.StatusOK, model.ResponseAuthorize{
+		Status:      "AUTHORIZED",
+		Message:     "Authorization granted",
+		ClientID:    client.ID,
+		ClientName:  client.Name,
+		Scopes:      authorization.Scopes,
+		RedirectURI: redirectURI,
+	})
+}
+
+// loadPending returns a pending authorization request and its client. If there is
+// none, the error response has been written and ok is false.
+func (s *OAuthServiceContext) loadPending(c *gin.Context, id string) (*db.OAuthAuthorization, *db.OAuthClient, bool) {
+	ctx := c.Request.Context()
+	authorization, err := s.pendingAuthorization(ctx, id)
+	if err == nil {
+		var client *db.OAuthClient
+		client, err = s.Clients.FindByID(ctx, authorization.ClientID)
+		if err == nil {
+			return authorization, client, true
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			// The client was deleted while the user was signing in
+			err = errAuthorizationNotFound
+		}
+	}
+	if errors.Is(err, errAuthorizationNotFound) {
+		c.JSON(http.StatusNotFound, model.ResponseAuthorize{Status: "AUTHORIZATION_NOT_FOUND", Message: "Authorization request not found or expired"})
+		return nil, nil, false
+	}
+	s.Logger.ErrorContext(ctx, "Failed to retrieve authorization request", "error", err.Error())
+	c.JSON(http.StatusInternalServerError, model.ResponseAuthorize{Status: "INTERNAL_ERROR", Message: "Failed to retrieve the authorization request"})
+	return nil, nil, false
+}
+
+func (s *OAuthServiceContext) sendLoginCode(ctx context.Context, email, code string) error {
+	subject := fmt.Sprintf("Your sign-in code is: %s", code)
+	body := fmt.Sprintf("%s \nPlease use this code to sign in with your KidneySmart account.", code)
+	return s.EmailClient.SendEmail(ctx, email, subject, "KidneySmart", "hello@wayofdt.com", body)
+}
+
+func describe(authorization *db.OAuthAuthorization, client *db.OAuthClient, status, message string) model.ResponseAuthorize {
+	return model.ResponseAuthorize{
+		Status:     status,
+		Message:    message,
+		RequestID:  authorization.ID,
+		ClientID:   client.ID,
+		ClientName: client.Name,
+		Scopes:     authorization.Scopes,
+	}
+}
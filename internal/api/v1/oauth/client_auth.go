@@ -0,0 +1,195 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/oauth/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClientAssertionType is the client_assertion_type of private_key_jwt (RFC 7523, section 2.2).
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// maxAssertionLifetime limits how far in the future a client assertion may expire,
+// which bounds the time its jti has to be remembered.
+const maxAssertionLifetime = 5 * time.Minute
+
+// assertionLeeway tolerates clock skew between the client and the service.
+const assertionLeeway = 30 * time.Second
+
+// errInvalidAssertion is returned for client assertions that fail verification.
+var errInvalidAssertion = errors.New("invalid client assertion")
+
+// ParseClientPublicKey parses the PEM encoded public key of a private_key_jwt client.
+// P-256 ECDSA keys (ES256) and RSA keys of at least 2048 bits (RS256) are accepted.
+func ParseClientPublicKey(data string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("ECDSA public key must use the P-256 curve")
+		}
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA public key must have at least 2048 bits")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+	return key, nil
+}
+
+// authenticateClient identifies the client of a token request. Confidential and
+// machine clients must present their secret, with HTTP Basic or in the form, or a
+// client assertion signed with their registered key. On failure the error
+// response has been written and ok is false.
+func (s *OAuthServiceContext) authenticateClient(c *gin.Context, req *model.RequestToken) (*db.OAuthClient, bool) {
+	clientID, secret, basic := c.Request.BasicAuth()
+	if !basic {
+		clientID, secret = req.ClientID, req.ClientSecret
+	}
+	unauthorized := func(description string) {
+		if basic {
+			c.Header("WWW-Authenticate", `Basic realm="kidneysmart-auth"`)
+		}
+		c.JSON(http.StatusUnauthorized, model.ResponseOAuthError{Error: errInvalidClient, ErrorDescription: description})
+	}
+
+	assertion := req.ClientAssertionType != "" || req.ClientAssertion != ""
+	if assertion {
+		if basic || secret != "" || req.ClientAssertionType != ClientAssertionType || req.ClientAssertion == "" {
+			unauthorized("use exactly one client authentication method")
+			return nil, false
+		}
+		// The client is named by the subject of the assertion; client_id is optional
+		if clientID == "" {
+			clientID = assertionSubject(req.ClientAssertion)
+		}
+	}
+	if clientID == "" {
+		unauthorized("client authentication is required")
+		return nil, false
+	}
+
+	ctx := c.Request.Context()
+	client, err := s.Clients.FindByID(ctx, clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		unauthorized("unknown client")
+		return nil, false
+	} else if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to retrieve OAuth client", "clientID", clientID, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseOAuthError{Error: errServerError})
+		return nil, false
+	}
+
+	switch {
+	case client.Type == db.ClientTypePublic:
+		// Public clients cannot keep a secret; PKCE protects their codes instead
+	case client.AuthMethod == db.AuthMethodPrivateKeyJWT:
+		if !assertion {
+			unauthorized("the client must authenticate with private_key_jwt")
+			return nil, false
+		}
+		if err := s.verifyClientAssertion(ctx, client, req.ClientAssertion); errors.Is(err, errInvalidAssertion) {
+			s.Logger.InfoContext(ctx, "Rejected client assertion", "clientID", client.ID, "error", err.Error())
+			unauthorized("invalid client assertion")
+			return nil, false
+		} else if err != nil {
+			s.Logger.ErrorContext(ctx, "Failed to verify client assertion", "clientID", client.ID, "error", err.Error())
+			c.JSON(http.StatusInternalServerError, model.ResponseOAuthError{Error: errServerError})
+			return nil, false
+		}
+	default:
+		if assertion || !utils.OpaqueTokenMatches(secret, client.SecretHash) {
+			unauthorized("invalid client credentials")
+			return nil, false
+		}
+	}
+	return client, true
+}
+
+// verifyClientAssertion checks a private_key_jwt assertion: the signature with the
+// client's registered key, iss and sub equal to the client_id, the token endpoint
+// or the issuer as audience, a short lifetime and a jti that was not used before.
+func (s *OAuthServiceContext) verifyClientAssertion(ctx context.Context, client *db.OAuthClient, assertion string) error {
+	publicKey, err := ParseClientPublicKey(client.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: registered key: %v", errInvalidAssertion, err)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+		switch publicKey.(type) {
+		case *ecdsa.PublicKey:
+			if token.Method != jwt.SigningMethodES256 {
+				return nil, utils.ErrTokenSignatureInvalid
+			}
+		case *rsa.PublicKey:
+			if token.Method != jwt.SigningMethodRS256 {
+				return nil, utils.ErrTokenSignatureInvalid
+			}
+		}
+		return publicKey, nil
+	},
+		jwt.WithIssuer(client.ID),
+		jwt.WithSubject(client.ID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(assertionLeeway),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidAssertion, err)
+	}
+
+	audience, _ := claims.GetAudience()
+	tokenEndpoint := s.Config.OAuth.Issuer + "/v1/oauth/token"
+	if !contains(audience, tokenEndpoint) && !contains(audience, s.Config.OAuth.Issuer) {
+		return fmt.Errorf("%w: audience must be %s", errInvalidAssertion, tokenEndpoint)
+	}
+	exp, _ := claims.GetExpirationTime()
+	if time.Until(exp.Time) > maxAssertionLifetime {
+		return fmt.Errorf("%w: expires more than %s in the future", errInvalidAssertion, maxAssertionLifetime)
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return fmt.Errorf("%w: jti is required", errInvalidAssertion)
+	}
+
+	if err := s.Clients.UseAssertion(ctx, client.ID, jti, exp.Time); errors.Is(err, repository.ErrAssertionReplayed) {
+		return fmt.Errorf("%w: jti has already been used", errInvalidAssertion)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// assertionSubject returns the unverified sub claim of a client assertion, used
+// only to look up the client whose key then verifies the assertion.
+func assertionSubject(assertion string) string {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, claims); err != nil {
+		return ""
+	}
+	sub, _ := claims.GetSubject()
+	return sub
+}
@@ -0,0 +1,23 @@
+package model
+
+import "github.com/go-playground/validator/v10"
+
+// RequestAuthorize holds the query parameters of the authorization request
+// (RFC 6749, section 4.1.1, with PKCE from RFC 7636 and the OpenID Connect nonce).
+type RequestAuthorize struct {
+	ResponseType string `form:"response_type"`
+	// @Required
+	ClientID string `form:"client_id" validate:"required"`
+	// @Required
+	RedirectURI         string `form:"redirect_uri" validate:"required"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+	Nonce               string `form:"nonce"`
+}
+
+func (a *RequestAuthorize) Validate() error {
+	validate := validator.New()
+	return validate.Struct(a)
+}
@@ -0,0 +1,15 @@
+package model
+
+import "github.com/go-playground/validator/v10"
+
+// RequestAuthorizeConsent carries the user's decision on the requested scopes.
+type RequestAuthorizeConsent struct {
+	// @Required
+	RequestID string `json:"requestId" validate:"required"`
+	Approve   bool   `json:"approve"`
+}
+
+func (a *RequestAuthorizeConsent) Validate() error {
+	validate := validator.New()
+	return validate.Struct(a)
+}
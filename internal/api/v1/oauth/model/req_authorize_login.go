@@ -0,0 +1,16 @@
+package model
+
+import "github.com/go-playground/validator/v10"
+
+// RequestAuthorizeLogin sends the email code that authenticates the user of an authorization request.
+type RequestAuthorizeLogin struct {
+	// @Required
+	RequestID string `json:"requestId" validate:"required"`
+	// @Required
+	Email string `json:"email" validate:"required,email"`
+}
+
+func (a *RequestAuthorizeLogin) Validate() error {
+	validate := validator.New()
+	return validate.Struct(a)
+}
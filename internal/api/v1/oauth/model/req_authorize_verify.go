@@ -0,0 +1,16 @@
+package model
+
+import "github.com/go-playground/validator/v10"
+
+// RequestAuthorizeVerify checks the email code of an authorization request.
+type RequestAuthorizeVerify struct {
+	// @Required
+	RequestID string `json:"requestId" validate:"required"`
+	// @Required
+	Code string `json:"code" validate:"required"`
+}
+
+func (a *RequestAuthorizeVerify) Validate() error {
+	validate := validator.New()
+	return validate.Struct(a)
+}
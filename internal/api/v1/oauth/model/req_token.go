@@ -0,0 +1,25 @@
+package model
+
+import "github.com/go-playground/validator/v10"
+
+// RequestToken is the form encoded access token request of the authorization code
+// (RFC 6749, section 4.1.3) and client credentials (section 4.4.2) grants.
+// Clients may send their secret with HTTP Basic authentication instead, or
+// authenticate with a private_key_jwt client assertion (RFC 7523, section 2.2).
+type RequestToken struct {
+	// @Required
+	GrantType           string `form:"grant_type" validate:"required"`
+	Code                string `form:"code"`
+	RedirectURI         string `form:"redirect_uri"`
+	CodeVerifier        string `form:"code_verifier"`
+	Scope               string `form:"scope"`
+	ClientID            string `form:"client_id"`
+	ClientSecret        string `form:"client_secret"`
+	ClientAssertionType string `form:"client_assertion_type"`
+	ClientAssertion     string `form:"client_assertion"`
+}
+
+func (a *RequestToken) Validate() error {
+	validate := validator.New()
+	return validate.Struct(a)
+}
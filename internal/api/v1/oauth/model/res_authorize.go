@@ -0,0 +1,14 @@
+package model
+
+// ResponseAuthorize describes an authorization request to the sign-in page. It is
+// returned by the authorization steps together with their status. Once the flow is
+// finished, redirectUri holds the address the browser must be sent to.
+type ResponseAuthorize struct {
+	Status      string   `json:"status"`
+	Message     string   `json:"message"`
+	RequestID   string   `json:"requestId,omitempty"`
+	ClientID    string   `json:"clientId,omitempty"`
+	ClientName  string   `json:"clientName,omitempty"`
+	Scopes      []string `json:"scopes,omitempty"`
+	RedirectURI string   `json:"redirectUri,omitempty"`
+}
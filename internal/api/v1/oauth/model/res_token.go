@@ -0,0 +1,17 @@
+package model
+
+// ResponseToken is the successful access token response (RFC 6749, section 5.1).
+// IDToken is returned when the openid scope was granted.
+type ResponseToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// ResponseOAuthError is the error response of the OAuth endpoints (RFC 6749, section 5.2).
+type ResponseOAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
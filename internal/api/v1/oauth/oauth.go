@@ -0,0 +1,165 @@
+// Package oauth implements the OAuth 2.0 authorization code flow with PKCE that lets
+// third-party clients sign users in with their KidneySmart account.
+//
+// /oauth/authorize checks the client's request and hands it to the sign-in page,
+// which authenticates the user with the same email code as the app login and asks
+// for consent through the /oauth/authorize/* endpoints. The single-use authorization
+// code returned to the client is exchanged for an access token at /oauth/token,
+// together with an OpenID Connect ID token when the openid scope was granted.
+//
+// Machine clients, such as backend jobs, use the client credentials grant at
+// /oauth/token to get tokens that name the client instead of a user.
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/keys"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/oidc"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/a-dev-mobile/kidneysmart-auth/pkg/emailclient"
+	"golang.org/x/exp/slog"
+)
+
+// MaxLoginAttempts is the number of email codes that can be submitted for an authorization request.
+const MaxLoginAttempts = 5
+
+// Errors of the authorization code grant (RFC 6749, sections 4.1.2.1 and 5.2).
+const (
+	errInvalidRequest          = "invalid_request"
+	errInvalidClient           = "invalid_client"
+	errInvalidGrant            = "invalid_grant"
+	errInvalidScope            = "invalid_scope"
+	errUnauthorizedClient      = "unauthorized_client"
+	errUnsupportedGrantType    = "unsupported_grant_type"
+	errUnsupportedResponseType = "unsupported_response_type"
+	errAccessDenied            = "access_denied"
+	errServerError             = "server_error"
+)
+
+// errAuthorizationNotFound is returned for unknown, expired and finished authorization requests.
+var errAuthorizationNotFound = errors.New("authorization request not found")
+
+type OAuthServiceContext struct {
+	Users          repository.UserRepository
+	Clients        repository.ClientRepository
+	Authorizations repository.AuthorizationRepository
+	Consents       repository.ConsentRepository
+	Audit          *audit.Recorder
+	Keys           *keys.Manager
+	Logger         *slog.Logger
+	Config         *config.Config
+	EmailClient    *emailclient.EmailClient
+}
+
+func NewOAuthServiceContext(store *repository.Store, recorder *audit.Recorder, signingKeys *keys.Manager, lg *slog.Logger, cfg *config.Config, emailClient *emailclient.EmailClient) *OAuthServiceContext {
+	return &OAuthServiceContext{
+		Users:          store.Users,
+		Clients:        store.Clients,
+		Authorizations: store.Authorizations,
+		Consents:       store.Consents,
+		Audit:          recorder,
+		Keys:           signingKeys,
+		Logger:         lg,
+		Config:         cfg,
+		EmailClient:    emailClient,
+	}
+}
+
+// pendingAuthorization returns an authorization request that can still be completed:
+// it has not expired and no authorization code has been issued for it.
+func (s *OAuthServiceContext) pendingAuthorization(ctx context.Context, id string) (*db.OAuthAuthorization, error) {
+	authorization, err := s.Authorizations.Find(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errAuthorizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(authorization.ExpiresAt) || authorization.CodeHash != "" || authorization.Consumed {
+		return nil, errAuthorizationNotFound
+	}
+	return authorization, nil
+}
+
+// issueCode creates the authorization code of a completed request and returns the
+// redirect URI that delivers it to the client.
+func (s *OAuthServiceContext) issueCode(ctx context.Context, authorization *db.OAuthAuthorization) (string, error) {
+	code, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(time.Duration(s.Config.OAuth.CodeTTLSeconds) * time.Second)
+	if err := s.Authorizations.IssueCode(ctx, authorization.ID, utils.HashOpaqueToken(code), expiresAt); err != nil {
+		return "", err
+	}
+	return redirectWith(authorization.RedirectURI, url.Values{"code": {code}}, authorization.State), nil
+}
+
+// redirectWith adds params and state to the query of the client's redirect URI.
+func redirectWith(redirectURI string, params url.Values, state string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// errorRedirect returns the redirect URI that reports an authorization error to the client.
+func errorRedirect(redirectURI, code, description, state string) string {
+	return redirectWith(redirectURI, url.Values{"error": {code}, "error_description": {description}}, state)
+}
+
+// parseScopes splits the space separated scope parameter. An empty parameter
+// requests only openid, so that a client never receives scopes it did not ask for.
+func parseScopes(scope string, client *db.OAuthClient) ([]string, bool) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		requested = []string{oidc.ScopeOpenID}
+	}
+	var scopes []string
+	for _, s := range requested {
+		if !contains(client.AllowedScopes, s) {
+			return nil, false
+		}
+		if !contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, true
+}
+
+// covers reports whether granted includes every scope of requested.
+func covers(granted, requested []string) bool {
+	for _, scope := range requested {
+		if !contains(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package oauth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/oauth/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/oidc"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Grant types accepted at the token endpoint.
+const (
+	grantAuthorizationCode = "authorization_code"
+	grantClientCredentials = "client_credentials"
+)
+
+// TokenHandler issues access tokens for the authorization code and client credentials grants.
+// @Summary OAuth 2.0 Token Endpoint
+// @Description grant_type=authorization_code exchanges a single-use authorization code for an access token.
+// @Description The code_verifier must match the PKCE code_challenge of the authorization request.
+// @Description With the openid scope the response also holds an OpenID Connect ID token.
+// @Description grant_type=client_credentials issues a token with the client_id as subject to machine clients.
+// @Description Clients authenticate with HTTP Basic, client_secret or a private_key_jwt client assertion; public clients send only client_id.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code or client_credentials"
+// @Param code formData string false "Authorization code (authorization_code)"
+// @Param redirect_uri formData string false "redirect_uri of the authorization request (authorization_code)"
+// @Param code_verifier formData string false "PKCE code verifier (authorization_code)"
+// @Param scope formData string false "Space separated scopes (client_credentials); defaults to all scopes of the client"
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic or a client assertion"
+// @Param client_secret formData string false "Client secret, unless sent with HTTP Basic"
+// @Param client_assertion_type formData string false "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+// @Param client_assertion formData string false "JWT signed with the client's registered key"
+// @Success 200 {object} model.ResponseToken "Access token"
+// @Failure 400 {object} model.ResponseOAuthError "Invalid request, grant or scope"
+// @Failure 401 {object} model.ResponseOAuthError "Client authentication failed"
+// @Failure 500 {object} model.ResponseOAuthError "Internal server error"
+// @Router /oauth/token [post]
+func (s *OAuthServiceContext) TokenHandler(c *gin.Context) {
+	// Token responses must not be cached (RFC 6749, section 5.1)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req model.RequestToken
+	if err := c.ShouldBind(&req); err != nil || req.Validate() != nil {
+		c.JSON(http.StatusBadRequest, model.ResponseOAuthError{Error: errInvalidRequest, ErrorDescription: "grant_type is required"})
+		return
+	}
+	if req.GrantType != grantAuthorizationCode && req.GrantType != grantClientCredentials {
+		c.JSON(http.StatusBadRequest, model.ResponseOAuthError{Error: errUnsupportedGrantType, ErrorDescription: "grant_type must be authorization_code or client_credentials"})
+		return
+	}
+
+	client, ok := s.authenticateClient(c, &req)
+	if !ok {
+		return
+	}
+	// Machine clients act for themselves and never for a user
+	if (req.GrantType == grantClientCredentials) != (client.Type == db.ClientTypeMachine) {
+		s.recordToken(c, req.GrantType, nil, client, audit.OutcomeFailure, "UNAUTHORIZED_CLIENT")
+		c.JSON(http.StatusBadRequest, model.ResponseOAuthError{Error: errUnauthorizedClient, ErrorDescription: "the client may not use this grant type"})
+		return
+	}
+	if req.GrantType == grantClientCredentials {
+		s.clientCredentials(c, &req, client)
+		return
+	}
+	s.exchangeCode(c, &req, client)
+}
+
+// exchangeCode completes the authorization code grant.
+func (s *OAuthServiceContext) exchangeCode(c *gin.Context, req *model.RequestToken, client *db.OAuthClient) {
+	if req.Code == "" || req.RedirectURI == "" || req.CodeVerifier == "" {
+		c.JSON(http.StatusBadRequest, model.ResponseOAuthError{Error: errInvalidRequest, ErrorDescription: "code, redirect_uri and code_verifier are required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	// The code is consumed before any other check, so a failed exchange cannot be retried
+	authorization, err := s.Authorizations.ConsumeCode(ctx, utils.HashOpaqueToken(req.Code), time.Now())
+	if errors.Is(err, repository.ErrCodeConsumed) {
+		s.recordToken(c, grantAuthorizationCode, nil, client, audit.OutcomeFailure, "INVALID_CODE")
+		c.JSON(http.StatusBadRequest, model.ResponseOAuthError{Error: errInvalidGrant, ErrorDescription: "authorization code is invalid, expired or already used"})
+		return
+	} else if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to consume authorization code", "clientID", client.ID, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseOAuthError{Error: errServerError})
+		return
+	}
+
+	var reason string
+	switch {
+	case authorization.ClientID != client.ID:
+		reason = "CLIENT_MISMATCH"
+	case authorization.RedirectURI != req.RedirectURI:
+		reason = "REDIRECT_URI_MISMATCH"
+	case !verifyCodeChallenge(req.CodeVerifier, authorization.CodeChallenge):
+		reason = "CODE_VERIFIER_MISMATCH"
+	}
+	if reason != "" {
+		s.recordToken(c, grantAuthorizationCode, authorization, client, audit.OutcomeFailure, reason)
+		c.JSON(http.StatusBadRequest, model.ResponseOAuthError{Error: errInvalidGrant, ErrorDescription: "authorization code does not match the request"})
+		return
+	}
+
+	user, err := s.Users.FindByID(ctx, authorization.UserID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && account.StatusError(user) != nil) {
+		s.recordToken(c, grantAuthorizationCode, authorization, client, audit.OutcomeFailure, "USER_UNAVAILABLE")
+		c.JSON(http.StatusBadRequest, model.ResponseOAuthError{Error: errInvalidGrant, ErrorDescription: "the account is no longer available"})
+		return
+	} else if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to retrieve user", "userID", authorization.UserID.Hex(), "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseOAuthError{Error: errServerError})
+		return
+	}
+
+	ttl := time.Duration(s.Config.OAuth.AccessTokenTTLMinutes) * time.Minute
+	expiresAt := time.Now().Add(ttl)
+	res := model.ResponseToken{
+		TokenType: "Bearer",
+		ExpiresIn: int64(ttl.Seconds()),
+		Scope:     strings.Join(authorization.Scopes, " "),
+	}
+	res.AccessToken, err = utils.GenerateOAuthAccessToken(user.ID.Hex(), client.ID, authorization.Scopes, s.Keys, expiresAt)
+	if err == nil && contains(authorization.Scopes, oidc.ScopeOpenID) {
+		res.IDToken, err = utils.GenerateIDToken(s.idTokenClaims(authorization, user), s.Keys, expiresAt)
+	}
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to generate tokens", "clientID", client.ID, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseOAuthError{Error: errServerError})
+		return
+	}
+	s.recordToken(c, grantAuthorizationCode, authorization, client, audit.OutcomeSuccess, "")
+
+	c.JSON(http.StatusOK, res)
+}
+
+// idTokenClaims describes the user signed in by authorization for the OpenID Connect ID token.
+func (s *OAuthServiceContext) idTokenClaims(authorization *db.OAuthAuthorization, user *db.AuthUser) utils.IDTokenClaims {
+	return utils.IDTokenClaims{
+		Issuer:        s.Config.OAuth.Issuer,
+		Subject:       user.ID.Hex(),
+		Audience:      authorization.ClientID,
+		Nonce:         authorization.Nonce,
+		AuthTime:      authorization.AuthTime,
+		AMR:           []string{oidc.AMROneTimeCode},
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		IncludeEmail:  contains(authorization.Scopes, oidc.ScopeEmail),
+	}
+}
+
+// clientCredentials issues a machine client a token for itself (RFC 6749, section 4.4).
+func (s *OAuthServiceContext) clientCredentials(c *gin.Context, req *model.RequestToken, client *db.OAuthClient) {
+	scopes, ok := parseScopes(req.Scope, client)
+	if !ok {
+		s.recordToken(c, grantClientCredentials, nil, client, audit.OutcomeFailure, "INVALID_SCOPE")
+		c.JSON(http.StatusBadRequest, model.ResponseOAuthError{Error: errInvalidScope, ErrorDescription: "the requested scope is not allowed for this client"})
+		return
+	}
+
+	ttl := time.Duration(s.Config.OAuth.AccessTokenTTLMinutes) * time.Minute
+	accessToken, err := utils.GenerateClientAccessToken(client.ID, scopes, s.Keys, time.Now().Add(ttl))
+	if err != nil {
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to generate access token", "clientID", client.ID, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponseOAuthError{Error: errServerError})
+		return
+	}
+	s.recordToken(c, grantClientCredentials, nil, client, audit.OutcomeSuccess, "")
+
+	c.JSON(http.StatusOK, model.ResponseToken{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttl.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
+
+func (s *OAuthServiceContext) recordToken(c *gin.Context, grantType string, authorization *db.OAuthAuthorization, client *db.OAuthClient, outcome, reason string) {
+	event := audit.Event{
+		Action:  audit.ActionOAuthToken,
+		Outcome: outcome,
+		Reason:  reason,
+		ActorID: "client:" + client.ID,
+		Details: map[string]string{"clientId": client.ID, "grantType": grantType},
+	}
+	if authorization != nil {
+		event.UserID = authorization.UserID.Hex()
+		event.Email = authorization.Email
+	}
+	s.Audit.RecordRequest(c, event)
+}
@@ -6,7 +6,7 @@ import (
 
 type RequestPassword struct {
     // @Required
-    Password string `json:"password" validate:"required"`
+    Password string `json:"password" validate:"required,min=8"`
 }
 
 func (a *RequestPassword) Validate() error {
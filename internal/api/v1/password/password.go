@@ -1,29 +1,38 @@
 package password
 
 import (
-
-
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/password/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
-
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/exp/slog"
 )
 
+// maxPasswordBytes - bcrypt не принимает пароли длиннее 72 байт.
+const maxPasswordBytes = 72
+
 type PasswordServiceContext struct {
-	DB          *mongo.Client
+	Users       repository.UserRepository
+	Audit       *audit.Recorder
 	Logger      *slog.Logger
 	Config      *config.Config
 
 }
 
-func NewPasswordServiceContext(db *mongo.Client, lg *slog.Logger, cfg *config.Config, ) *PasswordServiceContext {
+func NewPasswordServiceContext(users repository.UserRepository, recorder *audit.Recorder, lg *slog.Logger, cfg *config.Config, ) *PasswordServiceContext {
 	return &PasswordServiceContext{
-		DB:          db,
+		Users:       users,
+		Audit:       recorder,
 		Config:      cfg,
 		Logger:      lg,
 	
@@ -31,29 +40,68 @@ func NewPasswordServiceContext(db *mongo.Client, lg *slog.Logger, cfg *config.Co
 }
 
 
+// PasswordHandler stores a bcrypt hash of the password of the authenticated user.
 func (s *PasswordServiceContext) PasswordHandler(c *gin.Context) {
 	var reqPassword model.RequestPassword
-    userID, exists := c.Get("userID")
-	s.Logger.Debug("userID", "debug", userID)
-	
-    if !exists {
-        // Обработка ошибки, если userID не найден
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-        return
-    }
+	userID, exists := c.Get("userID")
+	if !exists {
+		// Обработка ошибки, если userID не найден
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
 
 	if err := c.ShouldBindJSON(&reqPassword); err != nil {
-		s.Logger.Error("Failed to bind JSON", "error", err.Error())
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to bind JSON", "error", err.Error())
 		c.JSON(http.StatusBadRequest, model.ResponsePassword{Message: "Invalid request body"})
 		return
 	}
 
-	if err := reqPassword.Validate(); err != nil {
+	if err := reqPassword.Validate(); err != nil || len(reqPassword.Password) > maxPasswordBytes {
 		c.JSON(http.StatusBadRequest, model.ResponsePassword{Message: "Invalid request parameters"})
 		return
 	}
 
+	ctx := c.Request.Context()
+	user, err := s.findUser(ctx, fmt.Sprint(userID))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, model.ResponsePassword{Message: "User not found"})
+		return
+	} else if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to retrieve user", "userID", userID, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, model.ResponsePassword{Message: "Failed to set password"})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(reqPassword.Password), bcrypt.DefaultCost)
+	if err == nil {
+		err = s.Users.SetPassword(ctx, user.Email, string(hash))
+	}
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to set password", "userID", userID, "error", err.Error())
+		s.record(c, user, audit.OutcomeFailure, "PASSWORD_UPDATE_FAILED")
+		c.JSON(http.StatusInternalServerError, model.ResponsePassword{Message: "Failed to set password"})
+		return
+	}
 
+	s.record(c, user, audit.OutcomeSuccess, "")
+	c.JSON(http.StatusOK, model.ResponsePassword{Message: "Password set successfully"})
+}
+
+// findUser возвращает пользователя по ID из токена; некорректный ID считается ненайденным.
+func (s *PasswordServiceContext) findUser(ctx context.Context, userID string) (*db.AuthUser, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, repository.ErrNotFound
+	}
+	return s.Users.FindByID(ctx, id)
+}
 
-	c.JSON(http.StatusOK, model.ResponsePassword{Message: "User registered successfully"})
+func (s *PasswordServiceContext) record(c *gin.Context, user *db.AuthUser, outcome, reason string) {
+	s.Audit.RecordRequest(c, audit.Event{
+		Action:  audit.ActionPasswordSet,
+		Outcome: outcome,
+		Reason:  reason,
+		UserID:  user.ID.Hex(),
+		Email:   user.Email,
+	})
 }
@@ -6,27 +6,41 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/refresh_token/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/keys"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/rbac"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
 
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/exp/slog"
 )
 
+var (
+	errRefreshTokenNotFound = errors.New("refresh token not found")
+	errRefreshTokenInactive = errors.New("refresh token is not active")
+)
+
 type RefreshTokenServiceContext struct {
-	DB     *mongo.Client
+	Users  repository.UserRepository
+	Tokens repository.TokenRepository
+	Audit  *audit.Recorder
+	Keys   *keys.Manager
 	Logger *slog.Logger
 	Config *config.Config
 }
 
-func NewRefreshTokenServiceContext(db *mongo.Client, lg *slog.Logger, cfg *config.Config) *RefreshTokenServiceContext {
+func NewRefreshTokenServiceContext(users repository.UserRepository, tokens repository.TokenRepository, recorder *audit.Recorder, signingKeys *keys.Manager, lg *slog.Logger, cfg *config.Config) *RefreshTokenServiceContext {
 	return &RefreshTokenServiceContext{
-		DB:     db,
+		Users:  users,
+		Tokens: tokens,
+		Audit:  recorder,
+		Keys:   signingKeys,
 		Config: cfg,
 		Logger: lg,
 	}
@@ -36,39 +50,69 @@ func (s *RefreshTokenServiceContext) RefreshTokenHandler(c *gin.Context) {
 
 	var reqRefreshToken model.RequestRefreshToken
 	if err := c.ShouldBindJSON(&reqRefreshToken); err != nil {
-		s.Logger.Error("Failed to bind JSON", "error", err.Error(), "request", c.Request)
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to bind JSON", "error", err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request body"})
 		return
 	}
 
 	if err := reqRefreshToken.Validate(); err != nil {
-		s.Logger.Error("Validation error", "error", err.Error())
+		s.Logger.ErrorContext(c.Request.Context(), "Validation error", "error", err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request parameters"})
 		return
 	}
-	userID, err := utils.ParseToken(reqRefreshToken.RefreshToken, s.Config.Authentication.JWTSecret, "refresh")
+	userID, err := utils.ParseToken(reqRefreshToken.RefreshToken, s.Keys, "refresh")
 	if err != nil {
-		s.Logger.Error("Token validation error", "error", err.Error())
+		s.Logger.ErrorContext(c.Request.Context(), "Token validation error", "error", err.Error())
+		s.recordRefresh(c, "", audit.OutcomeFailure, "INVALID_TOKEN")
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token"})
+		return
+	}
+
+	// Роли и scope нового access токена берутся из текущей учетной записи,
+	// поэтому изменения ролей вступают в силу при следующем обновлении
+	user, err := s.findUser(c.Request.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		s.Logger.InfoContext(c.Request.Context(), "User of refresh token not found", "userID", userID)
+		s.recordRefresh(c, userID, audit.OutcomeFailure, "USER_NOT_FOUND")
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token"})
 		return
+	} else if err != nil {
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to retrieve user", "userID", userID, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to refresh token"})
+		return
+	}
+	if err := account.StatusError(user); err != nil {
+		status, message := utils.TokenErrorStatus(err)
+		s.recordRefresh(c, userID, audit.OutcomeFailure, status)
+		c.JSON(http.StatusForbidden, gin.H{"message": message, "status": status})
+		return
 	}
 
 	// Найти, проверить и обновить существующий refresh токен
 	newRefreshToken, err := s.validateAndUpdateRefreshToken(c.Request.Context(), reqRefreshToken.RefreshToken)
-	if err != nil {
-		s.Logger.Error("Refresh token validation/update error", "error", err.Error())
-		c.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+	if errors.Is(err, errRefreshTokenNotFound) || errors.Is(err, errRefreshTokenInactive) {
+		s.Logger.InfoContext(c.Request.Context(), "Refresh token rejected", "userID", userID, "reason", err.Error())
+		s.recordRefresh(c, userID, audit.OutcomeFailure, "INVALID_REFRESH_TOKEN")
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token", "status": "INVALID_REFRESH_TOKEN"})
+		return
+	} else if err != nil {
+		s.Logger.ErrorContext(c.Request.Context(), "Refresh token validation/update error", "error", err.Error())
+		s.recordRefresh(c, userID, audit.OutcomeFailure, "REFRESH_TOKEN_UPDATE_FAILED")
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to refresh token"})
 		return
 	}
 
 	// Генерация нового access токена
-	newAccessToken, err := utils.GenerateAccessToken(userID, s.Config.Authentication.JWTSecret, s.Config.Authentication.AccessTokenExpiryHours)
+	newAccessToken, err := utils.GenerateAccessToken(userID, rbac.EffectiveRoles(user), rbac.Scopes(user), s.Keys, s.Config.Authentication.AccessTokenExpiryHours)
 	if err != nil {
-		s.Logger.Error("Failed to generate access token", "error", err.Error())
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to generate access token", "error", err.Error())
+		s.recordRefresh(c, userID, audit.OutcomeFailure, "ACCESS_TOKEN_GENERATION_FAILED")
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to generate access token"})
 		return
 	}
 
+	s.recordRefresh(c, userID, audit.OutcomeSuccess, "")
+
 	// Отправка новых токенов в ответе
 	expiresIn := utils.CalculateAccessTokenExpiryTime(s.Config.Authentication.AccessTokenExpiryHours)
 	c.JSON(http.StatusOK, model.ResponseRefreshToken{
@@ -79,41 +123,52 @@ func (s *RefreshTokenServiceContext) RefreshTokenHandler(c *gin.Context) {
 	})
 }
 
-func (s *RefreshTokenServiceContext) validateAndUpdateRefreshToken(ctx context.Context, oldRefreshToken string) (string, error) {
+func (s *RefreshTokenServiceContext) recordRefresh(c *gin.Context, userID, outcome, reason string) {
+	s.Audit.RecordRequest(c, audit.Event{
+		Action:  audit.ActionTokenRefresh,
+		Outcome: outcome,
+		Reason:  reason,
+		UserID:  userID,
+	})
+}
 
-	tokenCollectionName := s.Config.Database.Collections.AuthToken
-	collection := s.DB.Database(s.Config.Database.Name).Collection(tokenCollectionName)
+// findUser возвращает пользователя по ID из токена; некорректный ID считается ненайденным.
+func (s *RefreshTokenServiceContext) findUser(ctx context.Context, userID string) (*db.AuthUser, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, repository.ErrNotFound
+	}
+	return s.Users.FindByID(ctx, id)
+}
+
+func (s *RefreshTokenServiceContext) validateAndUpdateRefreshToken(ctx context.Context, oldRefreshToken string) (string, error) {
 	// Поиск существующего токена
-	var existingToken db.AuthToken
-	err := collection.FindOne(ctx, bson.M{"token": oldRefreshToken}).Decode(&existingToken)
+	existingToken, err := s.Tokens.FindByToken(ctx, oldRefreshToken)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return "", errors.New("refresh token not found")
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", errRefreshTokenNotFound
 		}
 		return "", err
 	}
 
 	// Проверка, активен ли токен
 	if !existingToken.IsActive {
-		return "", errors.New("refresh token is not active")
+		return "", errRefreshTokenInactive
 	}
 
 	// Генерация нового refresh токена
-	newRefreshToken, err := utils.GenerateRefreshToken(existingToken.UserID.Hex(), s.Config.Authentication.JWTSecret, s.Config.Authentication.RefreshTokenExpiryDays)
+	newRefreshToken, err := utils.GenerateRefreshToken(existingToken.UserID.Hex(), s.Keys, s.Config.Authentication.RefreshTokenExpiryDays)
 	if err != nil {
 		return "", err
 	}
 
 	// Обновление токена в базе данных
-	update := bson.M{
-		"$set": bson.M{
-			"token":     newRefreshToken,
-			"createdAt": time.Now(),
-			"expiresAt": utils.CalculateRefreshTokenExpiryTime(s.Config.Authentication.RefreshTokenExpiryDays),
-		},
-	}
-	_, err = collection.UpdateOne(ctx, bson.M{"token": oldRefreshToken}, update)
-	if err != nil {
+	expiresAt := utils.CalculateRefreshTokenExpiryTime(s.Config.Authentication.RefreshTokenExpiryDays)
+	// Токен мог быть отозван после проверки выше; Rotate обновляет только активный токен
+	err = s.Tokens.Rotate(ctx, oldRefreshToken, newRefreshToken, time.Now(), expiresAt)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", errRefreshTokenInactive
+	} else if err != nil {
 		return "", err
 	}
 
@@ -0,0 +1,212 @@
+package refreshtoken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/keys"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/exp/slog"
+)
+
+const testEmail = "user@example.com"
+
+type testEnv struct {
+	router *gin.Engine
+	store  *repository.Store
+	keys   *keys.Manager
+	user   *db.AuthUser
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	lg := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := repository.NewMemoryStore()
+	if err := store.Users.Create(ctx, testEmail, "1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Users.SetEmailVerified(ctx, testEmail); err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.Users.FindByEmail(ctx, testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.ApplyDefaults()
+	signingKeys := keys.NewManager(store.Keys, "test-secret", time.Hour, lg)
+	s := NewRefreshTokenServiceContext(store.Users, store.Tokens, audit.NewRecorder(store.Audit, lg), signingKeys, lg, cfg)
+
+	router := gin.New()
+	router.POST("/refresh", s.RefreshTokenHandler)
+	return &testEnv{router: router, store: store, keys: signingKeys, user: user}
+}
+
+// issue stores a refresh token of the user. Its lifetime differs from the
+// configured one, so the rotated token is never equal to it.
+func (e *testEnv) issue(t *testing.T, active bool) string {
+	t.Helper()
+	token, err := utils.GenerateRefreshToken(e.user.ID.Hex(), e.keys, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.store.Tokens.Save(context.Background(), db.AuthToken{
+		UserID:       e.user.ID,
+		DeviceInfoID: primitive.NilObjectID,
+		Token:        token,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    utils.CalculateRefreshTokenExpiryTime(1),
+		IsActive:     active,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+type response struct {
+	Message      string `json:"message"`
+	Status       string `json:"status"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (e *testEnv) refresh(token string) (int, response) {
+	body := fmt.Sprintf(`{"refreshToken":%q}`, token)
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(body)))
+	var res response
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	return w.Code, res
+}
+
+func TestRefreshTokenHandler(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		token      func(t *testing.T, e *testEnv) string
+		wantCode   int
+		wantStatus string
+	}{
+		{
+			name:     "not a token",
+			token:    func(*testing.T, *testEnv) string { return "garbage" },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "access token",
+			token: func(t *testing.T, e *testEnv) string {
+				token, err := utils.GenerateAccessToken(e.user.ID.Hex(), nil, nil, e.keys, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown token",
+			token: func(t *testing.T, e *testEnv) string {
+				token, err := utils.GenerateRefreshToken(e.user.ID.Hex(), e.keys, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantCode:   http.StatusUnauthorized,
+			wantStatus: "INVALID_REFRESH_TOKEN",
+		},
+		{
+			name:       "revoked token",
+			token:      func(t *testing.T, e *testEnv) string { return e.issue(t, false) },
+			wantCode:   http.StatusUnauthorized,
+			wantStatus: "INVALID_REFRESH_TOKEN",
+		},
+		{
+			name: "suspended user",
+			token: func(t *testing.T, e *testEnv) string {
+				if err := e.store.Users.SetStatus(ctx, testEmail, db.StatusSuspended, "test", time.Now()); err != nil {
+					t.Fatal(err)
+				}
+				return e.issue(t, true)
+			},
+			wantCode:   http.StatusForbidden,
+			wantStatus: "ACCOUNT_SUSPENDED",
+		},
+		{
+			name:     "active token",
+			token:    func(t *testing.T, e *testEnv) string { return e.issue(t, true) },
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			code, res := e.refresh(tt.token(t, e))
+			if code != tt.wantCode || res.Status != tt.wantStatus {
+				t.Fatalf("got %d %q, want %d %q", code, res.Status, tt.wantCode, tt.wantStatus)
+			}
+			if code != http.StatusOK {
+				if res.AccessToken != "" || res.RefreshToken != "" {
+					t.Error("tokens issued for a rejected refresh")
+				}
+				return
+			}
+			if userID, err := utils.ParseToken(res.AccessToken, e.keys, "access"); err != nil || userID != e.user.ID.Hex() {
+				t.Errorf("access token of %q (%v), want %s", userID, err, e.user.ID.Hex())
+			}
+		})
+	}
+}
+
+func TestRefreshTokenHandlerRotates(t *testing.T) {
+	e := newTestEnv(t)
+	old := e.issue(t, true)
+
+	code, res := e.refresh(old)
+	if code != http.StatusOK {
+		t.Fatalf("got %d %q, want 200", code, res.Status)
+	}
+	if res.RefreshToken == "" || res.RefreshToken == old {
+		t.Fatalf("refresh token %q was not rotated", res.RefreshToken)
+	}
+
+	// The old token has been replaced and cannot be used again
+	if code, res := e.refresh(old); code != http.StatusUnauthorized || res.Status != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("reusing the old token: got %d %q, want 401 INVALID_REFRESH_TOKEN", code, res.Status)
+	}
+	if code, res := e.refresh(res.RefreshToken); code != http.StatusOK {
+		t.Errorf("using the new token: got %d %q, want 200", code, res.Status)
+	}
+}
+
+func TestRefreshTokenHandlerRejectsRevokedSession(t *testing.T) {
+	e := newTestEnv(t)
+	token := e.issue(t, true)
+
+	// A logout or a suspension revokes all sessions of the user
+	if _, err := e.store.Tokens.RevokeByUser(context.Background(), e.user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code, res := e.refresh(token); code != http.StatusUnauthorized || res.Status != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("got %d %q, want 401 INVALID_REFRESH_TOKEN", code, res.Status)
+	}
+}
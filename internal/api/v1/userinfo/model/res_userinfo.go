@@ -0,0 +1,9 @@
+package model
+
+// ResponseUserinfo holds the claims about the signed-in user (OpenID Connect Core, section 5.3.2).
+// Email and EmailVerified are returned when the token was granted the email scope.
+type ResponseUserinfo struct {
+	Sub           string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
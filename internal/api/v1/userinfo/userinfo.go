@@ -0,0 +1,84 @@
+package userinfo
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/userinfo/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/oidc"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/pkg/authmw"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/exp/slog"
+)
+
+type UserinfoServiceContext struct {
+	Users  repository.UserRepository
+	Logger *slog.Logger
+}
+
+func NewUserinfoServiceContext(users repository.UserRepository, lg *slog.Logger) *UserinfoServiceContext {
+	return &UserinfoServiceContext{
+		Users:  users,
+		Logger: lg,
+	}
+}
+
+// UserinfoHandler returns the claims about the user of the access token.
+// @Summary OpenID Connect UserInfo
+// @Description Returns sub and, with the email scope, email and email_verified.
+// @Description Tokens issued to OAuth clients need the openid scope; tokens of the KidneySmart apps get every claim.
+// @Tags oauth
+// @Produce json
+// @Param Authorization header string true "Bearer access token"
+// @Success 200 {object} model.ResponseUserinfo "Claims about the user"
+// @Failure 401 {object} authmw.ErrorResponse "Missing or invalid token, or the account is no longer available"
+// @Failure 403 {object} authmw.ErrorResponse "The token was not granted the openid scope or belongs to a machine client"
+// @Failure 500 {object} authmw.ErrorResponse "Internal server error"
+// @Router /userinfo [get]
+// @Router /userinfo [post]
+func (s *UserinfoServiceContext) UserinfoHandler(c *gin.Context) {
+	claims, _ := authmw.ClaimsFromContext(c.Request.Context())
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, authmw.ErrorResponse{Status: "AUTHORIZATION_REQUIRED", Message: "Authorization header is required"})
+		return
+	}
+	if claims.IsClient() {
+		c.JSON(http.StatusForbidden, authmw.ErrorResponse{Status: "USER_TOKEN_REQUIRED", Message: "Tokens of machine clients do not represent a user."})
+		return
+	}
+	// Tokens of third-party clients are limited to the scopes the user consented to
+	firstParty := claims.ClientID == ""
+	if !firstParty && !claims.HasScope(oidc.ScopeOpenID) {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		c.JSON(http.StatusForbidden, authmw.ErrorResponse{Status: "INSUFFICIENT_SCOPE", Message: "This operation requires the scope openid."})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.JSON(http.StatusUnauthorized, authmw.ErrorResponse{Status: "INVALID_TOKEN", Message: "The provided token is invalid. Check the token and try again."})
+		return
+	}
+	user, err := s.Users.FindByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && account.StatusError(user) != nil) {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.JSON(http.StatusUnauthorized, authmw.ErrorResponse{Status: "USER_NOT_FOUND", Message: "The account is no longer available"})
+		return
+	} else if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to retrieve user", "userID", claims.UserID, "error", err.Error())
+		c.JSON(http.StatusInternalServerError, authmw.ErrorResponse{Status: "INTERNAL_ERROR", Message: "Failed to get user details"})
+		return
+	}
+
+	res := model.ResponseUserinfo{Sub: user.ID.Hex()}
+	if firstParty || claims.HasScope(oidc.ScopeEmail) {
+		verified := user.EmailVerified
+		res.Email, res.EmailVerified = user.Email, &verified
+	}
+	c.JSON(http.StatusOK, res)
+}
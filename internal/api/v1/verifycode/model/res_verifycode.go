@@ -20,12 +20,13 @@ type ResponseVerifyCode struct {
 	// - "INVALID_PARAMETERS" for invalid request parameters.
 	// - "VALIDATION_FAILED" for failed validation of the request data.
 	// - "USER_NOT_FOUND" if the user's email is not found in the database.
+	// - "ACCOUNT_SUSPENDED" if the account is suspended.
+	// - "ACCOUNT_PENDING_DELETION" if the account is scheduled for deletion.
 	// - "EMAIL_ALREADY_VERIFIED" if the user's email is already verified.
 	// - "INVALID_CODE" for incorrect verification codes.
 	// - "UPDATE_VERIFICATION_STATUS_FAILED" if there was an error updating the user's verification status.
 	// - "ACCESS_TOKEN_GENERATION_FAILED" if there was an error generating the access token.
 	// - "REFRESH_TOKEN_GENERATION_FAILED" if there was an error generating the refresh token.
-	// - "REFRESH_TOKEN_SAVING_FAILED" if there was an error saving the refresh token.
 	// - "TOO_MANY_ATTEMPTS"
 	// - "VERIFICATION_SUCCESSFUL"
 	Status string `json:"status"`
@@ -6,28 +6,43 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/verifycode/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/keys"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/rbac"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/exp/slog"
 )
 
+// MaxAttempts - число неверных кодов, после которого проверка блокируется на LockoutDuration.
+const MaxAttempts = 5
+
+// LockoutDuration - время блокировки после MaxAttempts неверных кодов.
+const LockoutDuration = 15 * time.Minute
+
 type VerifyCodeServiceContext struct {
-	DB     *mongo.Client
-	Logger *slog.Logger
-	Config *config.Config
+	Users         repository.UserRepository
+	Verifications repository.VerificationRepository
+	Audit         *audit.Recorder
+	Keys          *keys.Manager
+	Logger        *slog.Logger
+	Config        *config.Config
 }
 
-func NewVerifyCodeServiceContext(db *mongo.Client, lg *slog.Logger, cfg *config.Config) *VerifyCodeServiceContext {
+func NewVerifyCodeServiceContext(users repository.UserRepository, verifications repository.VerificationRepository, recorder *audit.Recorder, signingKeys *keys.Manager, lg *slog.Logger, cfg *config.Config) *VerifyCodeServiceContext {
 	return &VerifyCodeServiceContext{
-		DB:     db,
-		Config: cfg,
-		Logger: lg,
+		Users:         users,
+		Verifications: verifications,
+		Audit:         recorder,
+		Keys:          signingKeys,
+		Config:        cfg,
+		Logger:        lg,
 	}
 }
 
@@ -43,6 +58,7 @@ func NewVerifyCodeServiceContext(db *mongo.Client, lg *slog.Logger, cfg *config.
 // @Success 208 {object} model.ResponseStatusVerifyCode "Email is already verified"
 // @Failure 400 {object} model.ResponseStatusVerifyCode "Invalid request body or parameters"
 // @Failure 401 {object} model.ResponseStatusVerifyCode "Invalid verification code"
+// @Failure 403 {object} model.ResponseStatusVerifyCode "Account is disabled"
 // @Failure 404 {object} model.ResponseStatusVerifyCode "User not found"
 // @Failure 429 {object} model.ResponseStatusVerifyCode "Too many attempts, please try again later"
 // @Failure 500 {object} model.ResponseStatusVerifyCode "Internal server error"
@@ -51,7 +67,7 @@ func (s *VerifyCodeServiceContext) VerifyCodeHandler(c *gin.Context) {
 	var req model.RequestVerifyCode
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		s.Logger.Error("Failed to bind JSON", "error", err.Error())
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to bind JSON", "error", err.Error())
 		c.JSON(http.StatusBadRequest, model.ResponseVerifyCode{
 			Message: "Invalid request body",
 			Status:  "INVALID_REQUEST_BODY",
@@ -68,7 +84,7 @@ func (s *VerifyCodeServiceContext) VerifyCodeHandler(c *gin.Context) {
 	}
 
 	if err := validateRequest(req); err != nil {
-		s.Logger.Info("Validation failed", "error", err.Error())
+		s.Logger.InfoContext(c.Request.Context(), "Validation failed", "error", err.Error())
 		c.JSON(http.StatusBadRequest, model.ResponseVerifyCode{
 			Message: err.Error(),
 			Status:  "VALIDATION_FAILED",
@@ -78,7 +94,7 @@ func (s *VerifyCodeServiceContext) VerifyCodeHandler(c *gin.Context) {
 
 	dbAuthUser, err := s.fetchUser(c.Request.Context(), req.Email)
 
-	if errors.Is(err, mongo.ErrNoDocuments) {
+	if errors.Is(err, repository.ErrNotFound) {
 		c.JSON(http.StatusNotFound, model.ResponseVerifyCode{
 			Message: "User not found",
 			Status:  "USER_NOT_FOUND",
@@ -86,10 +102,19 @@ func (s *VerifyCodeServiceContext) VerifyCodeHandler(c *gin.Context) {
 
 		return
 	} else if err != nil {
-		s.Logger.Error("Failed to retrieve user", "email", req.Email, "error", err.Error())
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to retrieve user", "email", req.Email, "error", err.Error())
 		c.JSON(http.StatusInternalServerError, model.ResponseVerifyCode{Message: "Error retrieving user"})
 		return
 	}
+	if err := account.StatusError(dbAuthUser); err != nil {
+		status, message := utils.TokenErrorStatus(err)
+		s.recordVerification(c, dbAuthUser, audit.OutcomeFailure, status)
+		c.JSON(http.StatusForbidden, model.ResponseVerifyCode{
+			Message: message,
+			Status:  status,
+		})
+		return
+	}
 	// Check if the email is already verified
 	if dbAuthUser.EmailVerified {
 		var statusMessage, statusCode string
@@ -112,8 +137,8 @@ func (s *VerifyCodeServiceContext) VerifyCodeHandler(c *gin.Context) {
 		return
 	}
 	// Check if the user has exceeded the maximum number of attempts
-	const MaxAttempts = 5
-	if dbAuthUser.AttemptCount >= MaxAttempts && time.Since(dbAuthUser.LastAttemptTime).Minutes() < 15 {
+	if dbAuthUser.AttemptCount >= MaxAttempts && time.Since(dbAuthUser.LastAttemptTime) < LockoutDuration {
+		s.recordVerification(c, dbAuthUser, audit.OutcomeFailure, "TOO_MANY_ATTEMPTS")
 
 		c.JSON(http.StatusTooManyRequests, model.ResponseVerifyCode{
 			Message: "Too many attempts, please try again later",
@@ -123,6 +148,16 @@ func (s *VerifyCodeServiceContext) VerifyCodeHandler(c *gin.Context) {
 
 	if dbAuthUser.Code != req.Code {
 		s.incrementAttemptCount(c.Request.Context(), req.Email, dbAuthUser.AttemptCount)
+		s.recordVerification(c, dbAuthUser, audit.OutcomeFailure, "INVALID_CODE")
+		if dbAuthUser.AttemptCount+1 == MaxAttempts {
+			s.Audit.RecordRequest(c, audit.Event{
+				Action:  audit.ActionLockout,
+				Outcome: audit.OutcomeSuccess,
+				Reason:  "TOO_MANY_ATTEMPTS",
+				UserID:  dbAuthUser.ID.Hex(),
+				Email:   dbAuthUser.Email,
+			})
+		}
 
 		c.JSON(http.StatusUnauthorized, model.ResponseVerifyCode{
 			Message: "Invalid code",
@@ -130,23 +165,10 @@ func (s *VerifyCodeServiceContext) VerifyCodeHandler(c *gin.Context) {
 		})
 		return
 	}
-	// Update the user's email verification status in the database
-	if err := s.UpdateEmailVerificationStatus(c.Request.Context(), req.Email); err != nil {
-		s.Logger.Error("Failed to update user email verification status", "email", req.Email, "error", err.Error())
-		c.JSON(http.StatusInternalServerError, model.ResponseVerifyCode{
-			Message: "Error updating user verification status",
-			Status:  "UPDATE_VERIFICATION_STATUS_FAILED",
-		})
-		return
-	}
-
-	// Reset the attempt count on successful verification
-	s.resetAttemptCount(c.Request.Context(), req.Email)
-
 	// Generate a token for the verified user
-	accessToken, err := utils.GenerateAccessToken(dbAuthUser.ID.Hex(), s.Config.Authentication.JWTSecret, s.Config.Authentication.AccessTokenExpiryHours)
+	accessToken, err := utils.GenerateAccessToken(dbAuthUser.ID.Hex(), rbac.EffectiveRoles(dbAuthUser), rbac.Scopes(dbAuthUser), s.Keys, s.Config.Authentication.AccessTokenExpiryHours)
 	if err != nil {
-		s.Logger.Error("Failed to generate access token", "error", err.Error())
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to generate access token", "error", err.Error())
 		c.JSON(http.StatusInternalServerError, model.ResponseVerifyCode{
 			Message: "Failed to generate access token",
 			Status:  "ACCESS_TOKEN_GENERATION_FAILED",
@@ -154,9 +176,9 @@ func (s *VerifyCodeServiceContext) VerifyCodeHandler(c *gin.Context) {
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(dbAuthUser.ID.Hex(), s.Config.Authentication.JWTSecret, s.Config.Authentication.RefreshTokenExpiryDays)
+	refreshToken, err := utils.GenerateRefreshToken(dbAuthUser.ID.Hex(), s.Keys, s.Config.Authentication.RefreshTokenExpiryDays)
 	if err != nil {
-		s.Logger.Error("Failed to generate refresh token", "error", err.Error())
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to generate refresh token", "error", err.Error())
 		c.JSON(http.StatusInternalServerError, model.ResponseVerifyCode{
 			Message: "Failed to generate refresh token",
 			Status:  "REFRESH_TOKEN_GENERATION_FAILED",
@@ -164,15 +186,28 @@ func (s *VerifyCodeServiceContext) VerifyCodeHandler(c *gin.Context) {
 		return
 	}
 
-	// Save the refresh token in the database
-	if err := s.SaveRefreshToken(c.Request.Context(), dbAuthUser.ID, refreshToken); err != nil {
-		s.Logger.Error("Failed to save refresh token", "userID", dbAuthUser.ID.Hex(), "error", err.Error())
+	// Consume the code, mark the email as verified, reset the attempt count and
+	// save the refresh token as one unit of work
+	err = s.completeVerification(c.Request.Context(), req.Email, req.Code, dbAuthUser.ID, refreshToken)
+	if errors.Is(err, repository.ErrCodeConsumed) {
+		// Another request has already used this code
+		s.recordVerification(c, dbAuthUser, audit.OutcomeFailure, "CODE_ALREADY_USED")
+		c.JSON(http.StatusUnauthorized, model.ResponseVerifyCode{
+			Message: "Invalid code",
+			Status:  "INVALID_CODE",
+		})
+		return
+	} else if err != nil {
+		s.Logger.ErrorContext(c.Request.Context(), "Failed to complete verification", "email", req.Email, "error", err.Error())
+		s.recordVerification(c, dbAuthUser, audit.OutcomeFailure, "UPDATE_VERIFICATION_STATUS_FAILED")
 		c.JSON(http.StatusInternalServerError, model.ResponseVerifyCode{
-			Message: "Error saving refresh token",
-			Status:  "REFRESH_TOKEN_SAVING_FAILED",
+			Message: "Error updating user verification status",
+			Status:  "UPDATE_VERIFICATION_STATUS_FAILED",
 		})
 		return
 	}
+	s.recordVerification(c, dbAuthUser, audit.OutcomeSuccess, "")
+
 	// Generate the success response
 	expiresIn := utils.CalculateAccessTokenExpiryTime(s.Config.Authentication.AccessTokenExpiryHours)
 	successResponse := model.ResponseVerifyCode{
@@ -197,40 +232,25 @@ func validateRequest(req model.RequestVerifyCode) error {
 }
 
 func (s *VerifyCodeServiceContext) fetchUser(ctx context.Context, email string) (*db.AuthUser, error) {
-	authUserCollection := s.Config.Database.Collections.AuthUser
-	collection := s.DB.Database(s.Config.Database.Name).Collection(authUserCollection)
-	var dbAuthUser db.AuthUser
-	err := collection.FindOne(ctx, bson.M{"email": email}).Decode(&dbAuthUser)
-	return &dbAuthUser, err
-}
-func (s *VerifyCodeServiceContext) UpdateEmailVerificationStatus(ctx context.Context, email string) error {
-	authUserCollection := s.Config.Database.Collections.AuthUser
-	collection := s.DB.Database(s.Config.Database.Name).Collection(authUserCollection)
-	update := bson.M{"$set": bson.M{"emailVerified": true}}
-	_, err := collection.UpdateOne(ctx, bson.M{"email": email}, update)
-	return err
+	return s.Users.FindByEmail(ctx, email)
 }
 
-func (s *VerifyCodeServiceContext) incrementAttemptCount(ctx context.Context, email string, currentCount int) {
-	authUserCollection := s.Config.Database.Collections.AuthUser
-	collection := s.DB.Database(s.Config.Database.Name).Collection(authUserCollection)
-	update := bson.M{"$set": bson.M{"attemptCount": currentCount + 1, "lastAttemptTime": time.Now()}}
-	_, _ = collection.UpdateOne(ctx, bson.M{"email": email}, update)
+func (s *VerifyCodeServiceContext) recordVerification(c *gin.Context, user *db.AuthUser, outcome, reason string) {
+	s.Audit.RecordRequest(c, audit.Event{
+		Action:  audit.ActionVerification,
+		Outcome: outcome,
+		Reason:  reason,
+		UserID:  user.ID.Hex(),
+		Email:   user.Email,
+	})
 }
 
-func (s *VerifyCodeServiceContext) resetAttemptCount(ctx context.Context, email string) {
-	authUserCollection := s.Config.Database.Collections.AuthUser
-	collection := s.DB.Database(s.Config.Database.Name).Collection(authUserCollection)
-	update := bson.M{"$set": bson.M{"attemptCount": 0, "lastAttemptTime": time.Time{}}}
-	_, _ = collection.UpdateOne(ctx, bson.M{"email": email}, update)
+func (s *VerifyCodeServiceContext) incrementAttemptCount(ctx context.Context, email string, currentCount int) {
+	_ = s.Users.SetAttemptCount(ctx, email, currentCount+1, time.Now())
 }
 
-// SaveRefreshToken сохраняет refresh токен в отдельной коллекции AuthToken.
-func (s *VerifyCodeServiceContext) SaveRefreshToken(ctx context.Context, userID primitive.ObjectID, refreshToken string) error {
-	// Название коллекции токенов
-	tokenCollectionName := s.Config.Database.Collections.AuthToken
-	collection := s.DB.Database(s.Config.Database.Name).Collection(tokenCollectionName)
-
+// completeVerification подтверждает email и сохраняет refresh токен в отдельной коллекции AuthToken.
+func (s *VerifyCodeServiceContext) completeVerification(ctx context.Context, email, code string, userID primitive.ObjectID, refreshToken string) error {
 	// Создание объекта AuthToken
 	authToken := db.AuthToken{
 		UserID:       userID,
@@ -241,7 +261,5 @@ func (s *VerifyCodeServiceContext) SaveRefreshToken(ctx context.Context, userID
 		IsActive:     true,
 	}
 
-	// Вставка объекта AuthToken в коллекцию
-	_, err := collection.InsertOne(ctx, authToken)
-	return err
+	return s.Verifications.CompleteVerification(ctx, email, code, authToken)
 }
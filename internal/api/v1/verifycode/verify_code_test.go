@@ -0,0 +1,239 @@
+package verifycode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/verifycode/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/audit"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/keys"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	testEmail = "user@example.com"
+	testCode  = "1234"
+)
+
+func newTestRouter(t *testing.T) (*gin.Engine, *repository.Store, *keys.Manager) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	lg := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := repository.NewMemoryStore()
+	if err := store.Users.Create(context.Background(), testEmail, testCode); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.ApplyDefaults()
+	signingKeys := keys.NewManager(store.Keys, "test-secret", time.Hour, lg)
+	s := NewVerifyCodeServiceContext(store.Users, store.Verifications, audit.NewRecorder(store.Audit, lg), signingKeys, lg, cfg)
+
+	router := gin.New()
+	router.POST("/verifycode", s.VerifyCodeHandler)
+	return router, store, signingKeys
+}
+
+func verify(router *gin.Engine, body string) (int, model.ResponseVerifyCode) {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/verifycode", strings.NewReader(body)))
+	var res model.ResponseVerifyCode
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	return w.Code, res
+}
+
+func TestVerifyCodeHandler(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(t *testing.T, users repository.UserRepository)
+		wantCode   int
+		wantStatus string
+		wantTokens bool
+	}{
+		{
+			name:       "malformed body",
+			body:       `{"email":`,
+			wantCode:   http.StatusBadRequest,
+			wantStatus: "INVALID_REQUEST_BODY",
+		},
+		{
+			name:       "missing code",
+			body:       `{"email":"user@example.com"}`,
+			wantCode:   http.StatusBadRequest,
+			wantStatus: "INVALID_PARAMETERS",
+		},
+		{
+			name:       "invalid code format",
+			body:       `{"email":"user@example.com","code":"12ab"}`,
+			wantCode:   http.StatusBadRequest,
+			wantStatus: "VALIDATION_FAILED",
+		},
+		{
+			name:       "unknown user",
+			body:       `{"email":"other@example.com","code":"1234"}`,
+			wantCode:   http.StatusNotFound,
+			wantStatus: "USER_NOT_FOUND",
+		},
+		{
+			name:       "wrong code",
+			body:       `{"email":"user@example.com","code":"4321"}`,
+			wantCode:   http.StatusUnauthorized,
+			wantStatus: "INVALID_CODE",
+		},
+		{
+			name: "locked out",
+			body: `{"email":"user@example.com","code":"1234"}`,
+			setup: func(t *testing.T, users repository.UserRepository) {
+				if err := users.SetAttemptCount(ctx, testEmail, MaxAttempts, time.Now()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantCode:   http.StatusTooManyRequests,
+			wantStatus: "TOO_MANY_ATTEMPTS",
+		},
+		{
+			name: "lockout expired",
+			body: `{"email":"user@example.com","code":"1234"}`,
+			setup: func(t *testing.T, users repository.UserRepository) {
+				if err := users.SetAttemptCount(ctx, testEmail, MaxAttempts, time.Now().Add(-LockoutDuration)); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantCode:   http.StatusOK,
+			wantStatus: "VERIFICATION_SUCCESSFUL",
+			wantTokens: true,
+		},
+		{
+			name: "suspended user",
+			body: `{"email":"user@example.com","code":"1234"}`,
+			setup: func(t *testing.T, users repository.UserRepository) {
+				if err := users.SetStatus(ctx, testEmail, db.StatusSuspended, "test", time.Now()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantCode:   http.StatusForbidden,
+			wantStatus: "ACCOUNT_SUSPENDED",
+		},
+		{
+			name: "already verified",
+			body: `{"email":"user@example.com","code":"1234"}`,
+			setup: func(t *testing.T, users repository.UserRepository) {
+				if err := users.SetEmailVerified(ctx, testEmail); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantCode:   http.StatusAlreadyReported,
+			wantStatus: "EMAIL_VERIFIED_PASSWORD_NOT_SET",
+		},
+		{
+			name:       "correct code",
+			body:       `{"email":"user@example.com","code":"1234"}`,
+			wantCode:   http.StatusOK,
+			wantStatus: "VERIFICATION_SUCCESSFUL",
+			wantTokens: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, store, signingKeys := newTestRouter(t)
+			if tt.setup != nil {
+				tt.setup(t, store.Users)
+			}
+
+			code, res := verify(router, tt.body)
+			if code != tt.wantCode || res.Status != tt.wantStatus {
+				t.Fatalf("got %d %q, want %d %q", code, res.Status, tt.wantCode, tt.wantStatus)
+			}
+			if !tt.wantTokens {
+				if res.AccessToken != "" || res.RefreshToken != "" {
+					t.Error("tokens issued for a failed verification")
+				}
+				return
+			}
+
+			user, err := store.Users.FindByEmail(ctx, testEmail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !user.EmailVerified || user.AttemptCount != 0 {
+				t.Errorf("user verified=%v attempts=%d, want verified with no attempts", user.EmailVerified, user.AttemptCount)
+			}
+			if userID, err := utils.ParseToken(res.AccessToken, signingKeys, "access"); err != nil || userID != user.ID.Hex() {
+				t.Errorf("access token of %q (%v), want %s", userID, err, user.ID.Hex())
+			}
+			token, err := store.Tokens.FindByToken(ctx, res.RefreshToken)
+			if err != nil || !token.IsActive || token.UserID != user.ID {
+				t.Errorf("stored refresh token %+v (%v), want an active token of the user", token, err)
+			}
+		})
+	}
+}
+
+func TestVerifyCodeHandlerCountsFailedAttempts(t *testing.T) {
+	router, store, _ := newTestRouter(t)
+
+	for i := 1; i <= MaxAttempts; i++ {
+		if code, res := verify(router, `{"email":"user@example.com","code":"4321"}`); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got %d %q, want 401", i, code, res.Status)
+		}
+	}
+	user, err := store.Users.FindByEmail(context.Background(), testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.AttemptCount != MaxAttempts {
+		t.Errorf("attempt count = %d, want %d", user.AttemptCount, MaxAttempts)
+	}
+
+	// After MaxAttempts wrong codes even the correct code is rejected
+	if code, res := verify(router, `{"email":"user@example.com","code":"1234"}`); code != http.StatusTooManyRequests {
+		t.Errorf("got %d %q, want 429", code, res.Status)
+	}
+}
+
+func TestVerifyCodeHandlerConsumesCodeOnce(t *testing.T) {
+	router, store, _ := newTestRouter(t)
+
+	const requests = 10
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, _ := verify(router, fmt.Sprintf(`{"email":%q,"code":%q}`, testEmail, testCode))
+			codes <- code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	succeeded := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d requests verified the email, want exactly one", succeeded)
+	}
+	if n, err := store.Tokens.CountActive(context.Background(), time.Now()); err != nil || n != 1 {
+		t.Errorf("%d active refresh tokens (%v), want 1", n, err)
+	}
+}
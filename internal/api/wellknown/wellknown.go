@@ -0,0 +1,72 @@
+// Package wellknown serves the documents published under /.well-known.
+package wellknown
+
+import (
+	"net/http"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/wellknown/model"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/keys"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/oidc"
+	"github.com/gin-gonic/gin"
+)
+
+// jwksMaxAge lets clients cache the key set for a short time only, so that a
+// rotated key is picked up quickly.
+const jwksMaxAge = "public, max-age=300"
+
+// discoveryMaxAge allows caching the OpenID Provider metadata, which changes only with the configuration.
+const discoveryMaxAge = "public, max-age=3600"
+
+type WellKnownServiceContext struct {
+	Keys   *keys.Manager
+	Config *config.Config
+}
+
+func NewWellKnownServiceContext(signingKeys *keys.Manager, cfg *config.Config) *WellKnownServiceContext {
+	return &WellKnownServiceContext{
+		Keys:   signingKeys,
+		Config: cfg,
+	}
+}
+
+// JWKSHandler publishes the public keys that verify access tokens.
+// @Summary JSON Web Key Set
+// @Description Public keys of the ES256 signing keys, active and recently retired.
+// @Tags token
+// @Produce json
+// @Success 200 {object} keys.JSONWebKeySet
+// @Router /.well-known/jwks.json [get]
+func (s *WellKnownServiceContext) JWKSHandler(c *gin.Context) {
+	c.Header("Cache-Control", jwksMaxAge)
+	c.JSON(http.StatusOK, s.Keys.JWKS())
+}
+
+// OpenIDConfigurationHandler publishes the OpenID Provider metadata that OIDC client
+// libraries use to find the endpoints and keys of the service.
+// @Summary OpenID Connect Discovery
+// @Description Endpoints, supported scopes (openid email profile), claims and algorithms of the OpenID Provider.
+// @Tags oauth
+// @Produce json
+// @Success 200 {object} model.ResponseOpenIDConfiguration
+// @Router /.well-known/openid-configuration [get]
+func (s *WellKnownServiceContext) OpenIDConfigurationHandler(c *gin.Context) {
+	issuer := s.Config.OAuth.Issuer
+	c.Header("Cache-Control", discoveryMaxAge)
+	c.JSON(http.StatusOK, model.ResponseOpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/v1/oauth/authorize",
+		TokenEndpoint:                     issuer + "/v1/oauth/token",
+		UserinfoEndpoint:                  issuer + "/v1/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   oidc.SupportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"ES256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "none"},
+		TokenEndpointAuthSigningAlgValues: []string{"ES256", "RS256"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   oidc.SupportedClaims,
+	})
+}
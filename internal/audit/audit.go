@@ -0,0 +1,135 @@
+// Package audit records security relevant actions on accounts in the audit log.
+//
+// Handlers describe what happened with an Event; the Recorder adds the client
+// address, user agent, request ID and time and appends the record through the
+// AuditRepository. A failure to write the audit log is logged but does not fail
+// the request that triggered it.
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/requestid"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
+)
+
+// Actions recorded by the self-service flows. Actions performed through the admin
+// API or the CLI are prefixed with AdminPrefix.
+const (
+	ActionRegistration = "registration"
+	ActionVerification = "verification"
+	ActionLockout      = "lockout"
+	ActionTokenRefresh = "token_refresh"
+	ActionPasswordSet  = "password_set"
+	ActionOAuthLogin   = "oauth_login"
+	ActionOAuthConsent = "oauth_consent"
+	ActionOAuthToken   = "oauth_token"
+
+	ActionReauthentication       = "reauthentication"
+	ActionAccountDeletionCancel  = "account_deletion_cancel"
+	ActionAccountDeletionRequest = "account_deletion_request"
+	ActionAccountDelete          = "account_delete" // Removal of the account by the janitor after the grace period
+
+	AdminPrefix = "admin."
+)
+
+// Operator actions, recorded with AdminPrefix.
+const (
+	ActionUserCreate     = "user_create"
+	ActionUserVerify     = "user_verify"
+	ActionUserDisable    = "user_disable"
+	ActionUserEnable     = "user_enable"
+	ActionUserDelete     = "user_delete"
+	ActionSessionsRevoke = "sessions_revoke"
+	ActionKeyRotate      = "key_rotate"
+	ActionClientCreate   = "client_create"
+	ActionClientDelete   = "client_delete"
+	ActionRolesUpdate    = "roles_update"
+	ActionUserSearch     = "user_search"
+	ActionUserView       = "user_view"
+	ActionAttemptsReset  = "attempts_reset"
+	ActionCodeResend     = "code_resend"
+	ActionAuditQuery     = "audit_query"
+	ActionAuditExport    = "audit_export"
+)
+
+// Outcomes of an action.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event describes an action to be recorded.
+type Event struct {
+	Action  string
+	Outcome string
+	Reason  string
+	// ActorID identifies who performed the action. It defaults to the target user.
+	ActorID   string
+	UserID    string
+	Email     string
+	IP        string
+	UserAgent string
+	Details   map[string]string
+}
+
+// Recorder appends events to the audit log.
+type Recorder struct {
+	repo   repository.AuditRepository
+	logger *slog.Logger
+}
+
+// NewRecorder returns a Recorder writing to repo.
+func NewRecorder(repo repository.AuditRepository, lg *slog.Logger) *Recorder {
+	return &Recorder{
+		repo:   repo,
+		logger: lg.With(slog.String("component", "audit")),
+	}
+}
+
+// Record appends ev to the audit log.
+func (r *Recorder) Record(ctx context.Context, ev Event) {
+	record := db.AuditRecord{
+		Action:    ev.Action,
+		Outcome:   ev.Outcome,
+		Reason:    ev.Reason,
+		ActorID:   ev.ActorID,
+		UserID:    ev.UserID,
+		Email:     ev.Email,
+		IP:        ev.IP,
+		UserAgent: ev.UserAgent,
+		RequestID: requestid.FromContext(ctx),
+		Details:   ev.Details,
+		CreatedAt: time.Now().UTC(),
+	}
+	if record.ActorID == "" {
+		record.ActorID = record.UserID
+	}
+	if record.ActorID == "" {
+		record.ActorID = record.Email
+	}
+
+	if err := r.repo.Append(ctx, record); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to write audit record",
+			slog.String("action", ev.Action),
+			slog.String("outcome", ev.Outcome),
+			slog.String("error", err.Error()))
+	}
+}
+
+// RecordRequest appends ev to the audit log, taking the client address and user
+// agent from the HTTP request. The address is taken from X-Forwarded-For only for
+// requests from the trusted proxies configured on the router.
+func (r *Recorder) RecordRequest(c *gin.Context, ev Event) {
+	if ev.IP == "" {
+		ev.IP = c.ClientIP()
+	}
+	if ev.UserAgent == "" {
+		ev.UserAgent = c.Request.UserAgent()
+	}
+	r.Record(c.Request.Context(), ev)
+}
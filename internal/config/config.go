@@ -19,14 +19,34 @@ type Config struct {
 	Environment      Environment          `yaml:"environment"`
 	Logging          LoggingConfig        `yaml:"logging"`
 	ClientConnection ClientConfig         `yaml:"clientConnectionSettings"`
+	AdminConnection  AdminConfig          `yaml:"adminConnectionSettings"`
+	GrpcConnection   GrpcServerConfig     `yaml:"grpcConnectionSettings"`
 	ExternalService  ExternalConfig       `yaml:"externalServiceIntegrations"`
 	Database         DatabaseConfig       `yaml:"database"`
 	Authentication   AuthenticationConfig `yaml:"authentication"`
+	Janitor          JanitorConfig        `yaml:"janitor"`
+	Lifecycle        LifecycleConfig      `yaml:"lifecycle"`
+	Tracing          TracingConfig        `yaml:"tracing"`
+	Audit            AuditConfig          `yaml:"audit"`
+	Reload           ReloadConfig         `yaml:"reload"`
+	OAuth            OAuthConfig          `yaml:"oauth"`
+	Account          AccountConfig        `yaml:"account"`
+	Events           EventsConfig         `yaml:"events"`
 }
 
 type LoggingConfig struct {
-	Level      LogLevel   `yaml:"level"`
-	FileOutput FileConfig `yaml:"fileOutput"`
+	Level      LogLevel        `yaml:"level"`
+	FileOutput FileConfig      `yaml:"fileOutput"`
+	AccessLog  AccessLogConfig `yaml:"accessLog"`
+}
+
+type AccessLogConfig struct {
+	LogHeaders       bool               `yaml:"logHeaders"`
+	LogBody          bool               `yaml:"logBody"`
+	MaxBodyBytes     int                `yaml:"maxBodyBytes"`
+	RedactHeaders    []string           `yaml:"redactHeaders"`
+	RedactBodyFields []string           `yaml:"redactBodyFields"`
+	SampleRates      map[string]float64 `yaml:"sampleRates"`
 }
 
 type FileConfig struct {
@@ -41,6 +61,49 @@ type ClientConfig struct {
 	Port           string   `yaml:"port"`
 	Host           string   `yaml:"host"`
 	AllowedOrigins []string `yaml:"allowedOrigins"`
+	TrustedProxies []string `yaml:"trustedProxies"` // IP addresses or CIDRs of the reverse proxies whose X-Forwarded-For is used
+}
+
+type AdminConfig struct {
+	Port string         `yaml:"port"`
+	Host string         `yaml:"host"`
+	TLS  AdminTLSConfig `yaml:"tls"`
+}
+
+// AdminTLSConfig serves the admin port over TLS. Clients presenting a certificate
+// signed by ClientCAFile whose common name or DNS name is listed in AllowedClientNames
+// are trusted as administrators (mTLS) by the admin API.
+type AdminTLSConfig struct {
+	Enabled            bool     `yaml:"enabled"`
+	CertFile           string   `yaml:"certFile"`           // PEM encoded server certificate
+	KeyFile            string   `yaml:"keyFile"`            // PEM encoded private key of the certificate
+	ClientCAFile       string   `yaml:"clientCAFile"`       // PEM encoded CA bundle of admin client certificates
+	AllowedClientNames []string `yaml:"allowedClientNames"` // CN or DNS SAN of the admin client certificates
+}
+
+// GrpcServerConfig configures the gRPC AuthService for internal microservices.
+type GrpcServerConfig struct {
+	Enabled                bool                `yaml:"enabled"`
+	Port                   string              `yaml:"port"`
+	Host                   string              `yaml:"host"`
+	ServiceTokenTTLMinutes int                 `yaml:"serviceTokenTTLMinutes"`
+	Services               []ServiceCredential `yaml:"services"`
+	TLS                    GrpcTLSConfig       `yaml:"tls"`
+}
+
+// GrpcTLSConfig serves the gRPC AuthService over TLS. Without it service secrets
+// would travel in cleartext, so IssueServiceToken refuses Basic credentials on
+// connections that are not encrypted.
+type GrpcTLSConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"certFile"` // PEM encoded server certificate
+	KeyFile  string `yaml:"keyFile"`  // PEM encoded private key of the certificate
+}
+
+// ServiceCredential lets a microservice obtain service tokens from the AuthService.
+type ServiceCredential struct {
+	Name   string `yaml:"name"`
+	Secret string `yaml:"secret"`
 }
 
 type ExternalConfig struct {
@@ -63,26 +126,140 @@ type AuthenticationConfig struct {
 	RefreshTokenExpiryDays int    `yaml:"refreshTokenExpiryDays"`
 }
 type DatabaseConfig struct {
+	Driver            DatabaseDriver    `yaml:"driver"`
+	URI               string            `yaml:"uri"`
 	User              string            `yaml:"user"`
 	Password          string            `yaml:"password"`
 	Host              string            `yaml:"host"`
 	Port              string            `yaml:"port"`
 	Name              string            `yaml:"name"`
+	AuthSource        string            `yaml:"authSource"`
+	ReplicaSet        string            `yaml:"replicaSet"`
+	TLS               DatabaseTLSConfig `yaml:"tls"`
 	ConnectionTimeout int               `yaml:"connectionTimeoutSeconds"`
+	ConnectRetries    int               `yaml:"connectRetries"`
 	MaxPoolSize       int               `yaml:"maxPoolSize"`
+	MinPoolSize       int               `yaml:"minPoolSize"`
+	SSLMode           string            `yaml:"sslMode"`
 	Collections       CollectionsConfig `yaml:"collections"`
 }
+
+type DatabaseTLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"caFile"`
+	CertificateKeyFile string `yaml:"certificateKeyFile"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
 type CollectionsConfig struct {
-	AuthUser  string `yaml:"authUser"`
-	AuthToken string `yaml:"authToken"`
+	AuthUser           string `yaml:"authUser"`
+	AuthToken          string `yaml:"authToken"`
+	DeviceInfo         string `yaml:"deviceInfo"`
+	Lease              string `yaml:"lease"`
+	Audit              string `yaml:"audit"`
+	SigningKey         string `yaml:"signingKey"`
+	OAuthClient        string `yaml:"oauthClient"`
+	OAuthAuthorization string `yaml:"oauthAuthorization"`
+	OAuthConsent       string `yaml:"oauthConsent"`
+	OAuthAssertion     string `yaml:"oauthAssertion"`
+}
+
+type LifecycleConfig struct {
+	ShutdownTimeoutSeconds       int `yaml:"shutdownTimeoutSeconds"`
+	ReadinessDrainSeconds        int `yaml:"readinessDrainSeconds"`
+	ReadinessCheckTimeoutSeconds int `yaml:"readinessCheckTimeoutSeconds"`
 }
 
-// loadConfig reads and decodes the YAML configuration file.
-// It is a private function, indicated by the lowercase first letter.
-// Takes the file path as input and returns a pointer to the config struct or an error.
+type TracingConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Exporter    TraceExporter `yaml:"exporter"`
+	Endpoint    string        `yaml:"endpoint"`
+	Insecure    bool          `yaml:"insecure"`
+	ServiceName string        `yaml:"serviceName"`
+	SampleRatio float64       `yaml:"sampleRatio"`
+}
+
+type AuditConfig struct {
+	RetentionDays int `yaml:"retentionDays"`
+	QueryLimit    int `yaml:"queryLimit"`
+}
+
+type ReloadConfig struct {
+	PollIntervalSeconds int `yaml:"pollIntervalSeconds"`
+}
+
+// OAuthConfig configures the OAuth 2.0 authorization server used by third-party clients.
+type OAuthConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Issuer is the public base URL of the service, e.g. https://wayofdt.com/kidneysmart-auth.
+	// It is the "iss" of ID tokens and the prefix of the OpenID Connect discovery document.
+	Issuer string `yaml:"issuer"`
+	// LoginURL is the sign-in page that /authorize redirects the browser to with a
+	// request_id. It authenticates the user with the email code and asks for consent.
+	LoginURL                string `yaml:"loginURL"`
+	AuthorizationTTLMinutes int    `yaml:"authorizationTTLMinutes"`
+	CodeTTLSeconds          int    `yaml:"codeTTLSeconds"`
+	AccessTokenTTLMinutes   int    `yaml:"accessTokenTTLMinutes"`
+}
+
+// AccountConfig configures the self-service deletion of accounts.
+type AccountConfig struct {
+	// DeletionGracePeriodHours is the time between the deletion request and the
+	// removal of the account by the janitor, during which the deletion can be cancelled.
+	DeletionGracePeriodHours int `yaml:"deletionGracePeriodHours"`
+	// ReauthMaxAgeMinutes is how long a re-authentication code stays valid for
+	// confirming the deletion.
+	ReauthMaxAgeMinutes int `yaml:"reauthMaxAgeMinutes"`
+	// AuditPseudonymKey keys the HMAC that derives the pseudonyms replacing deleted
+	// users in the audit log. Changing it splits the records of later deletions from
+	// earlier ones, and whoever knows it can link a pseudonym to a user ID.
+	AuditPseudonymKey string `yaml:"auditPseudonymKey"`
+}
+
+// EventsConfig configures the delivery of account events, such as account.deleted,
+// to downstream services.
+type EventsConfig struct {
+	TimeoutSeconds int             `yaml:"timeoutSeconds"`
+	Webhooks       []WebhookConfig `yaml:"webhooks"`
+}
+
+// WebhookConfig is an endpoint receiving events. Requests are signed with an
+// HMAC-SHA256 of the body keyed with Secret.
+type WebhookConfig struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+}
+
+type JanitorConfig struct {
+	Enabled                   bool `yaml:"enabled"`
+	DryRun                    bool `yaml:"dryRun"`
+	IntervalMinutes           int  `yaml:"intervalMinutes"`
+	UnverifiedUserMaxAgeHours int  `yaml:"unverifiedUserMaxAgeHours"`
+	LeaseTTLSeconds           int  `yaml:"leaseTTLSeconds"`
+}
+
+// LoadConfig reads the configuration file configName from the directory configPath.
+// See Load for the processing applied to it.
 func LoadConfig(configPath string, configName string) (*Config, error) {
-	configFile := filepath.Join(configPath, configName)
+	return Load(filepath.Join(configPath, configName))
+}
+
+// Load reads and decodes the YAML configuration file, applies the KSA_ environment
+// overrides, fills in defaults and validates the result. All validation problems
+// are reported together in the returned error.
+func Load(configFile string) (*Config, error) {
+	config, err := Read(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
 
+// Read decodes the configuration file, applies the environment overrides and
+// defaults but does not validate the result.
+func Read(configFile string) (*Config, error) {
 	if _, err := os.Stat(configFile); errors.Is(err, os.ErrNotExist) {
 		// Checks if the file exists. If it does not, returns an error.
 		return nil, fmt.Errorf("config file does not exist: %s", configFile)
@@ -102,6 +279,13 @@ func LoadConfig(configPath string, configName string) (*Config, error) {
 	if err := yaml.Unmarshal(expandedData, &config); err != nil {
 		return nil, fmt.Errorf("error unmarshalling config: %v", err)
 	}
+
+	// Environment overrides take precedence over the file
+	if err := config.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	config.ApplyDefaults()
+
 	// Returns a pointer to the config struct if successful.
 	return &config, nil
 }
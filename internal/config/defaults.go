@@ -0,0 +1,120 @@
+package config
+
+// Default values applied to settings that are missing from the configuration file.
+const (
+	DefaultLogLevel               = LogLevelInfo
+	DefaultAdminPort              = "9090"
+	DefaultGrpcPort               = "9091"
+	DefaultServiceTokenTTL        = 15
+	DefaultAccessTokenExpiryHours = 1
+	DefaultRefreshTokenExpiryDays = 30
+	DefaultMongoPort              = "27017"
+	DefaultPostgresPort           = "5432"
+	DefaultConnectionTimeout      = 10
+	DefaultShutdownTimeout        = 30
+	DefaultReadinessDrain         = 5
+	DefaultReadinessCheckTimeout  = 2
+	DefaultAuditQueryLimit        = 1000
+	DefaultTraceSampleRatio       = 1.0
+	DefaultOAuthAuthorizationTTL  = 10
+	DefaultOAuthCodeTTL           = 60
+	DefaultOAuthAccessTokenTTL    = 15
+	DefaultDeletionGracePeriod    = 30 * 24
+	DefaultReauthMaxAge           = 10
+	DefaultEventTimeout           = 10
+)
+
+// ApplyDefaults fills in the settings that were left empty.
+func (c *Config) ApplyDefaults() {
+	if c.Logging.Level == "" {
+		c.Logging.Level = DefaultLogLevel
+	}
+	if c.AdminConnection.Port == "" {
+		c.AdminConnection.Port = DefaultAdminPort
+	}
+	if c.GrpcConnection.Port == "" {
+		c.GrpcConnection.Port = DefaultGrpcPort
+	}
+	if c.GrpcConnection.ServiceTokenTTLMinutes == 0 {
+		c.GrpcConnection.ServiceTokenTTLMinutes = DefaultServiceTokenTTL
+	}
+
+	if c.Authentication.AccessTokenExpiryHours == 0 {
+		c.Authentication.AccessTokenExpiryHours = DefaultAccessTokenExpiryHours
+	}
+	if c.Authentication.RefreshTokenExpiryDays == 0 {
+		c.Authentication.RefreshTokenExpiryDays = DefaultRefreshTokenExpiryDays
+	}
+
+	db := &c.Database
+	if db.Driver == "" {
+		db.Driver = DriverMongo
+	}
+	if db.Port == "" && db.URI == "" {
+		if db.Driver == DriverPostgres {
+			db.Port = DefaultPostgresPort
+		} else {
+			db.Port = DefaultMongoPort
+		}
+	}
+	if db.ConnectionTimeout == 0 {
+		db.ConnectionTimeout = DefaultConnectionTimeout
+	}
+	setDefault(&db.Collections.AuthUser, "authUser")
+	setDefault(&db.Collections.AuthToken, "authToken")
+	setDefault(&db.Collections.DeviceInfo, "deviceInfo")
+	setDefault(&db.Collections.Lease, "lease")
+	setDefault(&db.Collections.Audit, "authAudit")
+	setDefault(&db.Collections.SigningKey, "signingKey")
+	setDefault(&db.Collections.OAuthClient, "oauthClient")
+	setDefault(&db.Collections.OAuthAuthorization, "oauthAuthorization")
+	setDefault(&db.Collections.OAuthConsent, "oauthConsent")
+	setDefault(&db.Collections.OAuthAssertion, "oauthAssertion")
+
+	if c.Lifecycle.ShutdownTimeoutSeconds == 0 {
+		c.Lifecycle.ShutdownTimeoutSeconds = DefaultShutdownTimeout
+	}
+	if c.Lifecycle.ReadinessDrainSeconds == 0 {
+		c.Lifecycle.ReadinessDrainSeconds = DefaultReadinessDrain
+	}
+	if c.Lifecycle.ReadinessCheckTimeoutSeconds == 0 {
+		c.Lifecycle.ReadinessCheckTimeoutSeconds = DefaultReadinessCheckTimeout
+	}
+
+	if c.Tracing.Exporter == "" {
+		c.Tracing.Exporter = ExporterOTLP
+	}
+	if c.Tracing.SampleRatio == 0 {
+		c.Tracing.SampleRatio = DefaultTraceSampleRatio
+	}
+
+	if c.Audit.QueryLimit == 0 {
+		c.Audit.QueryLimit = DefaultAuditQueryLimit
+	}
+
+	if c.OAuth.AuthorizationTTLMinutes == 0 {
+		c.OAuth.AuthorizationTTLMinutes = DefaultOAuthAuthorizationTTL
+	}
+	if c.OAuth.CodeTTLSeconds == 0 {
+		c.OAuth.CodeTTLSeconds = DefaultOAuthCodeTTL
+	}
+	if c.OAuth.AccessTokenTTLMinutes == 0 {
+		c.OAuth.AccessTokenTTLMinutes = DefaultOAuthAccessTokenTTL
+	}
+
+	if c.Account.DeletionGracePeriodHours == 0 {
+		c.Account.DeletionGracePeriodHours = DefaultDeletionGracePeriod
+	}
+	if c.Account.ReauthMaxAgeMinutes == 0 {
+		c.Account.ReauthMaxAgeMinutes = DefaultReauthMaxAge
+	}
+	if c.Events.TimeoutSeconds == 0 {
+		c.Events.TimeoutSeconds = DefaultEventTimeout
+	}
+}
+
+func setDefault(value *string, def string) {
+	if *value == "" {
+		*value = def
+	}
+}
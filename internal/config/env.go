@@ -0,0 +1,172 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables that override configuration settings.
+const EnvPrefix = "KSA_"
+
+// fileSuffix marks a variable whose value is the path of a file holding the setting,
+// as used for secrets mounted by Docker or Kubernetes.
+const fileSuffix = "_FILE"
+
+// EnvName returns the environment variable that overrides the setting at the
+// given YAML path, for example "authentication.JWTSecret" becomes
+// KSA_AUTHENTICATION_JWT_SECRET.
+func EnvName(yamlPath ...string) string {
+	parts := make([]string, len(yamlPath))
+	for i, key := range yamlPath {
+		parts[i] = screamingSnake(key)
+	}
+	return EnvPrefix + strings.Join(parts, "_")
+}
+
+// ApplyEnv overrides settings with the KSA_ environment variables returned by lookup.
+// Every setting has a variable named after its YAML path; a variable with the
+// _FILE suffix reads the value from the named file instead. Lists are comma
+// separated and maps use key=value pairs separated by commas.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	walkSettings(nil, func(path []string, fields []reflect.Value) {
+		field := fields[0]
+		value, ok, err := lookupSetting(EnvName(path...), lookup)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if !ok {
+			return
+		}
+		if err := setField(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", EnvName(path...), err))
+		}
+	}, reflect.ValueOf(c).Elem())
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment overrides:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// walkSettings calls fn for every leaf setting of one or more configuration structs
+// of the same type, passing the matching field of each struct.
+func walkSettings(path []string, fn func(path []string, fields []reflect.Value), values ...reflect.Value) {
+	t := values[0].Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		fieldPath := append(append([]string{}, path...), key)
+		fields := make([]reflect.Value, len(values))
+		for j, v := range values {
+			fields[j] = v.Field(i)
+		}
+		if fields[0].Kind() == reflect.Struct {
+			walkSettings(fieldPath, fn, fields...)
+			continue
+		}
+		fn(fieldPath, fields)
+	}
+}
+
+func lookupSetting(name string, lookup func(string) (string, bool)) (string, bool, error) {
+	value, ok := lookup(name)
+	path, fromFile := lookup(name + fileSuffix)
+	switch {
+	case ok && fromFile:
+		return "", false, fmt.Errorf("%s and %s%s are both set", name, name, fileSuffix)
+	case fromFile:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s%s: %w", name, fileSuffix, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	default:
+		return value, ok, nil
+	}
+}
+
+// setField parses value into field. Custom types are decoded through their
+// UnmarshalYAML method so that they are checked the same way as in the file.
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		if field.Type().PkgPath() == "" {
+			field.SetString(value)
+			return nil
+		}
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", field.Type())
+		}
+		items := reflect.MakeSlice(field.Type(), 0, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = reflect.Append(items, reflect.ValueOf(item).Convert(field.Type().Elem()))
+			}
+		}
+		field.Set(items)
+		return nil
+	case reflect.Map:
+		if field.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map type %s", field.Type())
+		}
+		entries := reflect.MakeMap(field.Type())
+		for _, pair := range strings.Split(value, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			key, raw, found := strings.Cut(pair, "=")
+			if !found {
+				return fmt.Errorf("%q is not a key=value pair", pair)
+			}
+			item := reflect.New(field.Type().Elem())
+			if err := setField(item.Elem(), strings.TrimSpace(raw)); err != nil {
+				return err
+			}
+			entries.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)), item.Elem())
+		}
+		field.Set(entries)
+		return nil
+	}
+
+	node := yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if field.Kind() == reflect.String {
+		// Keep values such as "null" or "123" as plain strings.
+		node.Tag = "!!str"
+	}
+	if err := node.Decode(field.Addr().Interface()); err != nil {
+		return fmt.Errorf("cannot use %q: %w", value, err)
+	}
+	return nil
+}
+
+// screamingSnake converts a YAML key such as "JWTSecret" or "maxSizeMB" into
+// JWT_SECRET or MAX_SIZE_MB.
+func screamingSnake(key string) string {
+	runes := []rune(key)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,27 @@
+package config
+
+import "sync/atomic"
+
+// Holder gives concurrent access to the current configuration. Components that
+// support hot reload read their settings through it on every use instead of
+// keeping a copy taken at startup.
+type Holder struct {
+	current atomic.Pointer[Config]
+}
+
+// NewHolder returns a Holder containing cfg.
+func NewHolder(cfg *Config) *Holder {
+	h := &Holder{}
+	h.current.Store(cfg)
+	return h
+}
+
+// Get returns the current configuration. The returned value must not be modified.
+func (h *Holder) Get() *Config {
+	return h.current.Load()
+}
+
+// Set replaces the current configuration.
+func (h *Holder) Set(cfg *Config) {
+	h.current.Store(cfg)
+}
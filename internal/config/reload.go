@@ -0,0 +1,259 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// reloadableSettings lists the settings, by YAML path or path prefix, that are
+// applied without a restart. Every other change is reported and ignored until
+// the process is restarted.
+var reloadableSettings = []string{
+	"logging.level",
+	"logging.accessLog",
+	"clientConnectionSettings.allowedOrigins",
+}
+
+// Change describes a setting that differs between two configurations.
+type Change struct {
+	Setting    string
+	Old        string
+	New        string
+	Reloadable bool
+}
+
+// Diff returns the settings that differ between old and new. Values of secrets,
+// of URIs, which may embed credentials, and of lists whose entries hold secrets
+// are masked.
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	walkSettings(nil, func(path []string, fields []reflect.Value) {
+		oldValue := fmt.Sprint(fields[0].Interface())
+		newValue := fmt.Sprint(fields[1].Interface())
+		if oldValue == newValue {
+			return
+		}
+		setting := strings.Join(path, ".")
+		if isSensitive(path[len(path)-1], fields[0].Type()) {
+			oldValue, newValue = "***", "***"
+		}
+		changes = append(changes, Change{
+			Setting:    setting,
+			Old:        oldValue,
+			New:        newValue,
+			Reloadable: isReloadable(setting),
+		})
+	}, reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem())
+	return changes
+}
+
+// MergeReloadable returns a copy of current with the reloadable settings taken from next.
+func MergeReloadable(current, next *Config) *Config {
+	merged := *current
+	walkSettings(nil, func(path []string, fields []reflect.Value) {
+		if isReloadable(strings.Join(path, ".")) {
+			fields[0].Set(fields[1])
+		}
+	}, reflect.ValueOf(&merged).Elem(), reflect.ValueOf(next).Elem())
+	return &merged
+}
+
+func isReloadable(setting string) bool {
+	for _, prefix := range reloadableSettings {
+		if setting == prefix || strings.HasPrefix(setting, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// isSensitive reports whether the value of the setting key of type t must not be logged.
+func isSensitive(key string, t reflect.Type) bool {
+	return isSecret(key) || isConnectionString(key) || hasSecret(t)
+}
+
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+	return strings.Contains(key, "secret") || strings.Contains(key, "password") || strings.HasSuffix(key, "key")
+}
+
+// isConnectionString reports whether the setting holds a URI or DSN, which may embed credentials.
+func isConnectionString(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasSuffix(key, "uri") || strings.HasSuffix(key, "url") || strings.HasSuffix(key, "dsn")
+}
+
+// hasSecret reports whether values of t contain a sensitive field, like the
+// entries of grpcConnectionSettings.services, which walkSettings does not walk into.
+func hasSecret(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Pointer:
+		return hasSecret(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if isSecret(key) || isConnectionString(key) || hasSecret(field.Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Reloader re-reads the configuration file on SIGHUP or when its content changes
+// and applies the reloadable settings to the Holder.
+type Reloader struct {
+	file     string
+	holder   *Holder
+	logger   *slog.Logger
+	interval time.Duration
+
+	mu        sync.Mutex
+	checksum  [sha256.Size]byte
+	listeners []func(*Config)
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewReloader returns a Reloader for file. The file is polled for changes every
+// interval; a zero interval disables polling and only SIGHUP triggers a reload.
+func NewReloader(file string, holder *Holder, interval time.Duration, lg *slog.Logger) *Reloader {
+	r := &Reloader{
+		file:     file,
+		holder:   holder,
+		logger:   lg.With(slog.String("component", "config")),
+		interval: interval,
+	}
+	if data, err := os.ReadFile(file); err == nil {
+		r.checksum = sha256.Sum256(data)
+	}
+	return r
+}
+
+// OnReload registers fn to be called with the new configuration after every reload
+// that changed a reloadable setting.
+func (r *Reloader) OnReload(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// Reload reads and validates the configuration file. The reloadable settings of a
+// valid configuration replace the current ones; changes to other settings are only
+// logged. An invalid configuration is rejected as a whole.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if data, err := os.ReadFile(r.file); err == nil {
+		r.checksum = sha256.Sum256(data)
+	}
+
+	next, err := Load(r.file)
+	if err != nil {
+		r.logger.Error("Configuration reload rejected", slog.String("error", err.Error()))
+		return err
+	}
+
+	current := r.holder.Get()
+	changes := Diff(current, next)
+	applied := 0
+	for _, change := range changes {
+		if change.Reloadable {
+			applied++
+			r.logger.Info("Configuration setting changed",
+				slog.String("setting", change.Setting),
+				slog.String("old", change.Old),
+				slog.String("new", change.New))
+			continue
+		}
+		r.logger.Warn("Configuration setting requires a restart and was not applied",
+			slog.String("setting", change.Setting),
+			slog.String("old", change.Old),
+			slog.String("new", change.New))
+	}
+
+	if applied == 0 {
+		r.logger.Info("Configuration reloaded, nothing to apply", slog.Int("changes", len(changes)))
+		return nil
+	}
+
+	merged := MergeReloadable(current, next)
+	r.holder.Set(merged)
+	for _, fn := range r.listeners {
+		fn(merged)
+	}
+	r.logger.Info("Configuration reloaded", slog.Int("applied", applied), slog.Int("ignored", len(changes)-applied))
+	return nil
+}
+
+// Start reloads the configuration on SIGHUP and, when polling is enabled, whenever
+// the content of the file changes.
+func (r *Reloader) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer signal.Stop(hup)
+
+		var poll <-chan time.Time
+		if r.interval > 0 {
+			ticker := time.NewTicker(r.interval)
+			defer ticker.Stop()
+			poll = ticker.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				r.logger.Info("SIGHUP received, reloading configuration")
+				_ = r.Reload()
+			case <-poll:
+				if r.fileChanged() {
+					r.logger.Info("Configuration file changed, reloading", slog.String("file", r.file))
+					_ = r.Reload()
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the watch started by Start.
+func (r *Reloader) Stop(context.Context) error {
+	if r.cancel != nil {
+		r.cancel()
+		r.wg.Wait()
+	}
+	return nil
+}
+
+func (r *Reloader) fileChanged() bool {
+	data, err := os.ReadFile(r.file)
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256(data)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !bytes.Equal(sum[:], r.checksum[:])
+}
@@ -24,3 +24,17 @@ const (
 	LogLevelWarning LogLevel = "warning"
 	LogLevelError   LogLevel = "error"
 )
+
+type DatabaseDriver string
+
+const (
+	DriverMongo    DatabaseDriver = "mongo"
+	DriverPostgres DatabaseDriver = "postgres"
+)
+
+type TraceExporter string
+
+const (
+	ExporterOTLP   TraceExporter = "otlp"
+	ExporterStdout TraceExporter = "stdout"
+)
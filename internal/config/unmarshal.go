@@ -52,4 +52,41 @@ func (l *LogLevel) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	default:
 		return fmt.Errorf("invalid log level: %s", levelStr)
 	}
-}
\ No newline at end of file
+}
+// UnmarshalYAML customizes the unmarshalling for DatabaseDriver.
+// An empty value selects MongoDB for compatibility with existing configurations.
+func (d *DatabaseDriver) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var driverStr string
+	if err := unmarshal(&driverStr); err != nil {
+		return err
+	}
+
+	driverStr = strings.ToLower(driverStr)
+	switch DatabaseDriver(driverStr) {
+	case "":
+		*d = DriverMongo
+		return nil
+	case DriverMongo, DriverPostgres:
+		*d = DatabaseDriver(driverStr)
+		return nil
+	default:
+		return fmt.Errorf("invalid database driver: %s", driverStr)
+	}
+}
+
+// UnmarshalYAML customizes the unmarshalling for TraceExporter.
+func (t *TraceExporter) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var exporterStr string
+	if err := unmarshal(&exporterStr); err != nil {
+		return err
+	}
+
+	exporterStr = strings.ToLower(exporterStr)
+	switch TraceExporter(exporterStr) {
+	case "", ExporterOTLP, ExporterStdout:
+		*t = TraceExporter(exporterStr)
+		return nil
+	default:
+		return fmt.Errorf("invalid trace exporter: %s", exporterStr)
+	}
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// minJWTSecretLength is the shortest HMAC secret accepted in production, for the
+// JWT secret and the audit pseudonym key.
+const minJWTSecretLength = 32
+
+// Validate checks the configuration and reports every problem it finds at once.
+// Each error names the offending setting by its YAML path.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	switch c.Environment {
+	case Dev, Prod:
+	case "":
+		v.add("environment", "is required (dev or prod)")
+	default:
+		v.add("environment", "must be dev or prod")
+	}
+
+	if c.Logging.FileOutput.FilePath != "" && c.Logging.FileOutput.MaxSizeMB < 0 {
+		v.add("logging.fileOutput.maxSizeMB", "must not be negative")
+	}
+	for route, rate := range c.Logging.AccessLog.SampleRates {
+		if rate < 0 || rate > 1 {
+			v.add("logging.accessLog.sampleRates."+route, "must be between 0 and 1")
+		}
+	}
+
+	switch c.ClientConnection.GinMode {
+	case "", "debug", "release":
+	default:
+		v.add("clientConnectionSettings.ginMode", "must be debug or release")
+	}
+	v.port("clientConnectionSettings.port", c.ClientConnection.Port, true)
+	if c.ClientConnection.GinMode == "release" && len(c.ClientConnection.AllowedOrigins) == 0 {
+		v.add("clientConnectionSettings.allowedOrigins", "must list at least one origin in release mode")
+	}
+	for i, origin := range c.ClientConnection.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			v.add(fmt.Sprintf("clientConnectionSettings.allowedOrigins[%d]", i), "must be an absolute origin such as https://example.com")
+		}
+	}
+	for i, proxy := range c.ClientConnection.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			v.add(fmt.Sprintf("clientConnectionSettings.trustedProxies[%d]", i), "must be an IP address or CIDR")
+		}
+	}
+
+	v.port("adminConnectionSettings.port", c.AdminConnection.Port, true)
+	if c.AdminConnection.Port != "" && c.AdminConnection.Port == c.ClientConnection.Port {
+		v.add("adminConnectionSettings.port", "must differ from clientConnectionSettings.port")
+	}
+	if adminTLS := c.AdminConnection.TLS; adminTLS.Enabled {
+		v.required("adminConnectionSettings.tls.certFile", adminTLS.CertFile)
+		v.required("adminConnectionSettings.tls.keyFile", adminTLS.KeyFile)
+		v.file("adminConnectionSettings.tls.certFile", adminTLS.CertFile)
+		v.file("adminConnectionSettings.tls.keyFile", adminTLS.KeyFile)
+		v.file("adminConnectionSettings.tls.clientCAFile", adminTLS.ClientCAFile)
+	} else if adminTLS.ClientCAFile != "" {
+		v.add("adminConnectionSettings.tls.clientCAFile", "requires adminConnectionSettings.tls.enabled")
+	}
+	// Без списка имен любой сертификат этого CA получил бы права администратора
+	if adminTLS := c.AdminConnection.TLS; adminTLS.ClientCAFile != "" && len(adminTLS.AllowedClientNames) == 0 {
+		v.add("adminConnectionSettings.tls.allowedClientNames", "is required when clientCAFile is set")
+	} else if adminTLS.ClientCAFile == "" && len(adminTLS.AllowedClientNames) != 0 {
+		v.add("adminConnectionSettings.tls.allowedClientNames", "requires adminConnectionSettings.tls.clientCAFile")
+	}
+
+	if grpcServer := c.GrpcConnection; grpcServer.Enabled {
+		v.port("grpcConnectionSettings.port", grpcServer.Port, true)
+		if grpcServer.Port == c.ClientConnection.Port || grpcServer.Port == c.AdminConnection.Port {
+			v.add("grpcConnectionSettings.port", "must differ from the HTTP ports")
+		}
+		v.positive("grpcConnectionSettings.serviceTokenTTLMinutes", grpcServer.ServiceTokenTTLMinutes)
+		if grpcServer.TLS.Enabled {
+			v.required("grpcConnectionSettings.tls.certFile", grpcServer.TLS.CertFile)
+			v.required("grpcConnectionSettings.tls.keyFile", grpcServer.TLS.KeyFile)
+			v.file("grpcConnectionSettings.tls.certFile", grpcServer.TLS.CertFile)
+			v.file("grpcConnectionSettings.tls.keyFile", grpcServer.TLS.KeyFile)
+		}
+		names := map[string]bool{}
+		for i, service := range grpcServer.Services {
+			path := fmt.Sprintf("grpcConnectionSettings.services[%d]", i)
+			v.required(path+".name", service.Name)
+			v.required(path+".secret", service.Secret)
+			if names[service.Name] {
+				v.add(path+".name", "is listed more than once")
+			}
+			names[service.Name] = true
+		}
+	}
+
+	smtp := c.ExternalService.SmtpServer.Grpc
+	v.required("externalServiceIntegrations.smtpServer.grpc.host", smtp.Host)
+	v.port("externalServiceIntegrations.smtpServer.grpc.port", smtp.Port, true)
+
+	c.validateDatabase(v)
+
+	auth := c.Authentication
+	if auth.JWTSecret == "" {
+		v.add("authentication.JWTSecret", "is required")
+	} else if c.Environment == Prod && len(auth.JWTSecret) < minJWTSecretLength {
+		v.add("authentication.JWTSecret", fmt.Sprintf("must be at least %d characters long in production", minJWTSecretLength))
+	}
+	v.positive("authentication.accessTokenExpiryHours", auth.AccessTokenExpiryHours)
+	v.positive("authentication.refreshTokenExpiryDays", auth.RefreshTokenExpiryDays)
+
+	v.notNegative("janitor.intervalMinutes", c.Janitor.IntervalMinutes)
+	v.notNegative("janitor.unverifiedUserMaxAgeHours", c.Janitor.UnverifiedUserMaxAgeHours)
+	v.notNegative("janitor.leaseTTLSeconds", c.Janitor.LeaseTTLSeconds)
+
+	v.positive("lifecycle.shutdownTimeoutSeconds", c.Lifecycle.ShutdownTimeoutSeconds)
+	v.notNegative("lifecycle.readinessDrainSeconds", c.Lifecycle.ReadinessDrainSeconds)
+	v.positive("lifecycle.readinessCheckTimeoutSeconds", c.Lifecycle.ReadinessCheckTimeoutSeconds)
+	if c.Lifecycle.ReadinessDrainSeconds >= c.Lifecycle.ShutdownTimeoutSeconds && c.Lifecycle.ShutdownTimeoutSeconds > 0 {
+		v.add("lifecycle.readinessDrainSeconds", "must be shorter than lifecycle.shutdownTimeoutSeconds")
+	}
+
+	if c.Tracing.Enabled {
+		if c.Tracing.Exporter == ExporterOTLP && c.Tracing.Endpoint == "" {
+			v.add("tracing.endpoint", "is required by the otlp exporter")
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			v.add("tracing.sampleRatio", "must be between 0 and 1")
+		}
+	}
+
+	v.notNegative("audit.retentionDays", c.Audit.RetentionDays)
+	v.positive("audit.queryLimit", c.Audit.QueryLimit)
+	v.notNegative("reload.pollIntervalSeconds", c.Reload.PollIntervalSeconds)
+
+	if oauth := c.OAuth; oauth.Enabled {
+		if u, err := url.Parse(oauth.Issuer); err != nil || u.Scheme == "" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" || strings.HasSuffix(oauth.Issuer, "/") {
+			v.add("oauth.issuer", "must be an absolute URL without query or trailing slash, such as https://example.com/kidneysmart-auth")
+		}
+		if u, err := url.Parse(oauth.LoginURL); oauth.LoginURL != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+			v.add("oauth.loginURL", "must be an absolute URL such as https://example.com/signin")
+		}
+		v.positive("oauth.authorizationTTLMinutes", oauth.AuthorizationTTLMinutes)
+		v.positive("oauth.codeTTLSeconds", oauth.CodeTTLSeconds)
+		v.positive("oauth.accessTokenTTLMinutes", oauth.AccessTokenTTLMinutes)
+	}
+
+	v.positive("account.deletionGracePeriodHours", c.Account.DeletionGracePeriodHours)
+	v.positive("account.reauthMaxAgeMinutes", c.Account.ReauthMaxAgeMinutes)
+	if key := c.Account.AuditPseudonymKey; key == "" {
+		v.add("account.auditPseudonymKey", "is required")
+	} else if c.Environment == Prod && len(key) < minJWTSecretLength {
+		v.add("account.auditPseudonymKey", fmt.Sprintf("must be at least %d characters long in production", minJWTSecretLength))
+	} else if key == auth.JWTSecret {
+		v.add("account.auditPseudonymKey", "must differ from authentication.JWTSecret")
+	}
+	v.positive("events.timeoutSeconds", c.Events.TimeoutSeconds)
+	for i, webhook := range c.Events.Webhooks {
+		path := fmt.Sprintf("events.webhooks[%d]", i)
+		if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add(path+".url", "must be an absolute http or https URL")
+		}
+		v.required(path+".secret", webhook.Secret)
+	}
+
+	return v.err()
+}
+
+func (c *Config) validateDatabase(v *validator) {
+	db := c.Database
+
+	switch db.Driver {
+	case DriverMongo, DriverPostgres:
+	default:
+		v.add("database.driver", "must be mongo or postgres")
+	}
+	if db.URI == "" {
+		v.required("database.host", db.Host)
+		if db.Driver == DriverPostgres {
+			v.port("database.port", db.Port, true)
+		}
+	}
+	v.required("database.name", db.Name)
+	if db.Password != "" && db.User == "" {
+		v.add("database.user", "is required when a password is set")
+	}
+
+	v.positive("database.connectionTimeoutSeconds", db.ConnectionTimeout)
+	v.notNegative("database.connectRetries", db.ConnectRetries)
+	v.notNegative("database.maxPoolSize", db.MaxPoolSize)
+	v.notNegative("database.minPoolSize", db.MinPoolSize)
+	if db.MaxPoolSize > 0 && db.MinPoolSize > db.MaxPoolSize {
+		v.add("database.minPoolSize", "must not exceed database.maxPoolSize")
+	}
+
+	if db.TLS.Enabled {
+		v.file("database.tls.caFile", db.TLS.CAFile)
+		v.file("database.tls.certificateKeyFile", db.TLS.CertificateKeyFile)
+	}
+	if db.Driver == DriverPostgres {
+		switch db.SSLMode {
+		case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			v.add("database.sslMode", "is not a valid PostgreSQL sslmode")
+		}
+	}
+}
+
+// validator collects validation errors.
+type validator struct {
+	errs []error
+}
+
+func (v *validator) add(field, problem string) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", field, problem))
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration:\n%w", errors.Join(v.errs...))
+}
+
+func (v *validator) required(field, value string) {
+	if value == "" {
+		v.add(field, "is required")
+	}
+}
+
+func (v *validator) port(field, value string, required bool) {
+	if value == "" {
+		if required {
+			v.add(field, "is required")
+		}
+		return
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+		v.add(field, fmt.Sprintf("%q is not a valid port", value))
+	}
+}
+
+func (v *validator) positive(field string, value int) {
+	if value <= 0 {
+		v.add(field, "must be greater than zero")
+	}
+}
+
+func (v *validator) notNegative(field string, value int) {
+	if value < 0 {
+		v.add(field, "must not be negative")
+	}
+}
+
+// file checks that an optional file setting points to a readable file.
+func (v *validator) file(field, path string) {
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		v.add(field, fmt.Sprintf("cannot be read: %v", err))
+	}
+}
@@ -0,0 +1,121 @@
+// Package events notifies downstream services about changes of accounts, so that
+// they can react to them, for example purge their data of a deleted user.
+//
+// Events are delivered as JSON POST requests to the webhooks of the configuration.
+// Every request carries the event type in X-KidneySmart-Event and an HMAC-SHA256
+// of the body, keyed with the secret of the webhook, in X-KidneySmart-Signature
+// as "sha256=<hex>". Delivery is at least once: an event whose delivery failed is
+// published again, so receivers must handle repeated event IDs.
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"golang.org/x/exp/slog"
+)
+
+// Event types.
+const (
+	// TypeAccountDeleted is published when an account has been removed for good.
+	// Receivers must delete all data they keep about the user.
+	TypeAccountDeleted = "account.deleted"
+)
+
+// Headers of the webhook requests.
+const (
+	HeaderEvent     = "X-KidneySmart-Event"
+	HeaderSignature = "X-KidneySmart-Signature"
+)
+
+// Event is the body of a webhook request.
+type Event struct {
+	ID         string    `json:"id"`   // Identifier of the event, the same for every delivery attempt
+	Type       string    `json:"type"` // For example TypeAccountDeleted
+	UserID     string    `json:"userId"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+// Publisher delivers events to downstream services.
+type Publisher interface {
+	// Publish delivers the event to every receiver. It fails if any receiver did not
+	// accept it; the event should then be published again later.
+	Publish(ctx context.Context, event Event) error
+}
+
+// WebhookPublisher is a Publisher posting events to the configured webhooks.
+type WebhookPublisher struct {
+	webhooks []config.WebhookConfig
+	client   *http.Client
+	logger   *slog.Logger
+}
+
+// NewWebhookPublisher returns a Publisher for the webhooks of cfg. Without
+// webhooks events are only logged.
+func NewWebhookPublisher(cfg config.EventsConfig, lg *slog.Logger) *WebhookPublisher {
+	return &WebhookPublisher{
+		webhooks: cfg.Webhooks,
+		client:   &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+		logger:   lg.With(slog.String("component", "events")),
+	}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, webhook := range p.webhooks {
+		if err := p.deliver(ctx, webhook, event.Type, body); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", webhook.URL, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	p.logger.InfoContext(ctx, "Event published",
+		slog.String("id", event.ID),
+		slog.String("type", event.Type),
+		slog.Int("webhooks", len(p.webhooks)))
+	return nil
+}
+
+func (p *WebhookPublisher) deliver(ctx context.Context, webhook config.WebhookConfig, eventType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderSignature, Sign(body, webhook.Secret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the value of the X-KidneySmart-Signature header for body.
+// Receivers compare it with hmac.Equal against the value they compute.
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,198 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const healthMethodPrefix = "/grpc.health.v1.Health/"
+
+// LoggingInterceptor logs every call with its duration and status code.
+// Health checks are only logged at debug level.
+func LoggingInterceptor(lg *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		attrs := []any{
+			slog.String("method", info.FullMethod),
+			slog.String("code", code.String()),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if service, ok := ServiceFromContext(ctx); ok {
+			attrs = append(attrs, slog.String("service", service))
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+		}
+
+		switch {
+		case strings.HasPrefix(info.FullMethod, healthMethodPrefix) && err == nil:
+			lg.DebugContext(ctx, "gRPC call", attrs...)
+		case code == codes.Internal || code == codes.Unknown || code == codes.DataLoss || code == codes.Unavailable:
+			lg.ErrorContext(ctx, "gRPC call", attrs...)
+		case err != nil:
+			lg.WarnContext(ctx, "gRPC call", attrs...)
+		default:
+			lg.InfoContext(ctx, "gRPC call", attrs...)
+		}
+		return resp, err
+	}
+}
+
+// RecoveryInterceptor turns a panic in a handler into an Internal error.
+func RecoveryInterceptor(lg *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				lg.ErrorContext(ctx, "gRPC server panic",
+					slog.String("method", info.FullMethod),
+					slog.String("error", fmt.Sprintf("%v", r)))
+				err = status.Error(codes.Internal, "internal server error")
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+type serviceKey struct{}
+
+// ServiceFromContext returns the name of the authenticated calling service.
+func ServiceFromContext(ctx context.Context) (string, bool) {
+	service, ok := ctx.Value(serviceKey{}).(string)
+	return service, ok
+}
+
+// Authenticator identifies the calling service. Methods listed as credential
+// methods accept "Basic base64(service:secret)" with a configured credential on
+// TLS connections only, every other method a "Bearer" service token.
+type Authenticator struct {
+	verifier          utils.TokenVerifier
+	secrets           map[string]string
+	credentialMethods map[string]bool
+}
+
+// NewAuthenticator returns an Authenticator checking service tokens with verifier
+// and Basic credentials against services.
+func NewAuthenticator(verifier utils.TokenVerifier, services []config.ServiceCredential, credentialMethods ...string) *Authenticator {
+	a := &Authenticator{
+		verifier:          verifier,
+		secrets:           make(map[string]string, len(services)),
+		credentialMethods: make(map[string]bool, len(credentialMethods)),
+	}
+	for _, service := range services {
+		a.secrets[service.Name] = service.Secret
+	}
+	for _, method := range credentialMethods {
+		a.credentialMethods[method] = true
+	}
+	return a
+}
+
+// UnaryInterceptor rejects unauthenticated calls with Unauthenticated and stores
+// the name of the calling service in the context. Health checks need no credentials.
+func (a *Authenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, healthMethodPrefix) {
+			return handler(ctx, req)
+		}
+
+		var authorization string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get("authorization"); len(values) > 0 {
+				authorization = values[0]
+			}
+		}
+		if authorization == "" {
+			return nil, status.Error(codes.Unauthenticated, "authorization metadata is required")
+		}
+
+		var service string
+		var err error
+		if a.credentialMethods[info.FullMethod] {
+			if !secureConnection(ctx) {
+				// The secret has already been sent, but refusing it keeps clients from
+				// relying on a setup that exposes it
+				return nil, status.Error(codes.FailedPrecondition, "service credentials are only accepted over TLS")
+			}
+			service, err = a.checkCredentials(authorization)
+		} else {
+			service, err = a.checkToken(authorization)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return handler(context.WithValue(ctx, serviceKey{}, service), req)
+	}
+}
+
+func (a *Authenticator) checkCredentials(authorization string) (string, error) {
+	encoded, ok := cutPrefixFold(authorization, "Basic ")
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "Basic credentials are required")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", status.Error(codes.Unauthenticated, "malformed Basic credentials")
+	}
+	name, secret, _ := strings.Cut(string(decoded), ":")
+
+	expected, known := a.secrets[name]
+	if !known {
+		// Compare anyway so that unknown names take as long as wrong secrets
+		expected = "\x00"
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) != 1 || !known {
+		return "", status.Error(codes.Unauthenticated, "invalid service credentials")
+	}
+	return name, nil
+}
+
+func (a *Authenticator) checkToken(authorization string) (string, error) {
+	token, ok := cutPrefixFold(authorization, "Bearer ")
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "a Bearer service token is required")
+	}
+	service, err := utils.ParseServiceToken(token, a.verifier)
+	if err != nil {
+		_, message := utils.TokenErrorStatus(err)
+		return "", status.Error(codes.Unauthenticated, message)
+	}
+	if _, known := a.secrets[service]; !known {
+		return "", status.Error(codes.PermissionDenied, "service is no longer allowed")
+	}
+	return service, nil
+}
+
+// secureConnection reports whether the call arrived over a TLS connection.
+func secureConnection(ctx context.Context) bool {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	_, ok = p.AuthInfo.(credentials.TLSInfo)
+	return ok
+}
+
+// cutPrefixFold removes a case-insensitive prefix.
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return "", false
+	}
+	return s[len(prefix):], true
+}
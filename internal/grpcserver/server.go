@@ -0,0 +1,109 @@
+// Package grpcserver runs the gRPC server used by internal microservices.
+//
+// Every call passes through the interceptors in this order: request ID, logging,
+// panic recovery and service authentication. The server also answers the standard
+// grpc.health.v1 health checks for every registered service. With TLS configured
+// connections are encrypted; service secrets are only accepted on such connections.
+package grpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/requestid"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Server is a gRPC server together with its health service.
+type Server struct {
+	*grpc.Server
+	Addr string
+
+	health *health.Server
+	logger *slog.Logger
+}
+
+// New returns a server listening on the configured address. Services are
+// registered on the embedded grpc.Server before Serve is called.
+func New(cfg config.GrpcServerConfig, auth *Authenticator, lg *slog.Logger) (*Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			requestid.UnaryServerInterceptor(),
+			LoggingInterceptor(lg),
+			RecoveryInterceptor(lg),
+			auth.UnaryInterceptor(),
+		),
+	}
+	if cfg.TLS.Enabled {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading certificate: %w", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(&tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		})))
+	} else {
+		lg.Warn("gRPC server runs without TLS, service credentials are refused")
+	}
+	srv := grpc.NewServer(opts...)
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthServer)
+
+	return &Server{
+		Server: srv,
+		Addr:   net.JoinHostPort(cfg.Host, cfg.Port),
+		health: healthServer,
+		logger: lg,
+	}, nil
+}
+
+// Serve marks every registered service as serving and accepts connections until
+// the server is shut down.
+func (s *Server) Serve() error {
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	for name := range s.GetServiceInfo() {
+		s.health.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	s.logger.Info("gRPC Server starting", slog.String("addr", s.Addr))
+	if err := s.Server.Serve(listener); err != nil && err != grpc.ErrServerStopped {
+		return err
+	}
+	return nil
+}
+
+// Shutdown reports every service as not serving and waits for running calls to
+// finish. Calls still running when ctx expires are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.health.Shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
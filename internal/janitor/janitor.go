@@ -0,0 +1,288 @@
+// Package janitor periodically removes expired refresh tokens, abandoned
+// sign-ups, orphaned device records, expired OAuth authorization requests and
+// client assertions, audit records past their retention period and accounts
+// whose deletion grace period has ended.
+//
+// Several replicas of the service may run at the same time, so every run first
+// takes a lease through the LeaseRepository and only the lease holder cleans up.
+// The lease is renewed between the steps of a run, which stops once it is lost.
+package janitor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	leaseName = "janitor"
+
+	defaultInterval             = time.Hour
+	defaultUnverifiedUserMaxAge = 72 * time.Hour
+)
+
+// Stats holds the totals accumulated since the janitor was started.
+type Stats struct {
+	Runs                  int64
+	Failures              int64
+	TokensRemoved         int64
+	UsersRemoved          int64
+	DevicesRemoved        int64
+	AuditRemoved          int64
+	AuthorizationsRemoved int64
+	AccountsDeleted       int64
+	LastRun               time.Time
+}
+
+// AccountPurger removes the accounts whose deletion grace period has ended.
+type AccountPurger interface {
+	// PurgeDueAccounts removes the accounts due for deletion at now and returns how
+	// many were removed. When dryRun is set it only counts them.
+	PurgeDueAccounts(ctx context.Context, now time.Time, dryRun bool) (int64, error)
+}
+
+// Janitor runs the cleanup on a fixed interval while it holds the lease.
+type Janitor struct {
+	maintenance repository.MaintenanceRepository
+	leases      repository.LeaseRepository
+	accounts    AccountPurger
+	logger      *slog.Logger
+
+	interval       time.Duration
+	maxUserAge     time.Duration
+	auditRetention time.Duration
+	leaseTTL       time.Duration
+	dryRun         bool
+	holder         string
+
+	runs            atomic.Int64
+	failures        atomic.Int64
+	tokensRemoved   atomic.Int64
+	usersRemoved    atomic.Int64
+	devicesRemoved  atomic.Int64
+	auditRemoved    atomic.Int64
+	authzRemoved    atomic.Int64
+	accountsDeleted atomic.Int64
+	lastRun         atomic.Int64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a Janitor configured from cfg. Zero values in cfg fall back to defaults.
+// Audit records older than auditRetention are removed; zero keeps them forever.
+// Accounts pending deletion are removed through accounts.
+func New(maintenance repository.MaintenanceRepository, leases repository.LeaseRepository, accounts AccountPurger, cfg config.JanitorConfig, auditRetention time.Duration, lg *slog.Logger) *Janitor {
+	interval := time.Duration(cfg.IntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	maxUserAge := time.Duration(cfg.UnverifiedUserMaxAgeHours) * time.Hour
+	if maxUserAge <= 0 {
+		maxUserAge = defaultUnverifiedUserMaxAge
+	}
+	leaseTTL := time.Duration(cfg.LeaseTTLSeconds) * time.Second
+	if leaseTTL <= 0 {
+		// Outlive one interval so the leader keeps the lease between runs.
+		leaseTTL = 2 * interval
+	}
+
+	return &Janitor{
+		maintenance:    maintenance,
+		leases:         leases,
+		accounts:       accounts,
+		logger:         lg.With(slog.String("component", "janitor")),
+		interval:       interval,
+		maxUserAge:     maxUserAge,
+		auditRetention: auditRetention,
+		leaseTTL:       leaseTTL,
+		dryRun:         cfg.DryRun,
+		holder:         holderID(),
+	}
+}
+
+// Start launches the background loop. The first run happens immediately.
+func (j *Janitor) Start(ctx context.Context) {
+	ctx, j.cancel = context.WithCancel(ctx)
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			j.RunOnce(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	j.logger.Info("Janitor started",
+		slog.Duration("interval", j.interval),
+		slog.Bool("dryRun", j.dryRun),
+		slog.String("holder", j.holder))
+}
+
+// Stop ends the background loop, waits for a running cleanup to finish and
+// releases the lease so another replica can take over without waiting for it to expire.
+func (j *Janitor) Stop(ctx context.Context) error {
+	if j.cancel == nil {
+		return nil
+	}
+	j.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		j.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := j.leases.Release(ctx, leaseName, j.holder); err != nil {
+		return err
+	}
+	j.logger.Info("Janitor stopped")
+	return nil
+}
+
+// RunOnce performs a single cleanup if this instance holds or can take the lease.
+func (j *Janitor) RunOnce(ctx context.Context) {
+	leader, err := j.leases.TryAcquire(ctx, leaseName, j.holder, j.leaseTTL)
+	if err != nil {
+		j.failures.Add(1)
+		j.logger.Error("Failed to acquire janitor lease", slog.String("error", err.Error()))
+		return
+	}
+	if !leader {
+		j.logger.Debug("Janitor lease is held by another instance")
+		return
+	}
+
+	now := time.Now()
+	var tokens, users, devices, authorizations, audit, accounts int64
+	steps := []cleanupStep{
+		{"tokens", &tokens, func() (int64, error) { return j.maintenance.PurgeTokens(ctx, now, j.dryRun) }},
+		{"unverifiedUsers", &users, func() (int64, error) {
+			return j.maintenance.PurgeUnverifiedUsers(ctx, now.Add(-j.maxUserAge), j.dryRun)
+		}},
+		{"devices", &devices, func() (int64, error) { return j.maintenance.CompactDevices(ctx, j.dryRun) }},
+		{"authorizations", &authorizations, func() (int64, error) { return j.maintenance.PurgeAuthorizations(ctx, now, j.dryRun) }},
+	}
+	if j.auditRetention > 0 {
+		steps = append(steps, cleanupStep{"auditRecords", &audit, func() (int64, error) {
+			return j.maintenance.PurgeAuditRecords(ctx, now.Add(-j.auditRetention), j.dryRun)
+		}})
+	}
+	steps = append(steps, cleanupStep{"deletedAccounts", &accounts, func() (int64, error) {
+		return j.accounts.PurgeDueAccounts(ctx, now, j.dryRun)
+	}})
+
+	completed := true
+	for i, step := range steps {
+		// A long run may outlast the lease; renew it before every further step so
+		// that another replica never cleans up at the same time.
+		if i > 0 && !j.renewLease(ctx) {
+			completed = false
+			break
+		}
+		removed, err := step.run()
+		if err != nil {
+			j.failures.Add(1)
+			j.logger.Error("Janitor cleanup step failed", slog.String("step", step.name), slog.String("error", err.Error()))
+		}
+		*step.removed = removed
+	}
+
+	j.runs.Add(1)
+	j.lastRun.Store(now.Unix())
+	if !j.dryRun {
+		j.tokensRemoved.Add(tokens)
+		j.usersRemoved.Add(users)
+		j.devicesRemoved.Add(devices)
+		j.auditRemoved.Add(audit)
+		j.authzRemoved.Add(authorizations)
+		j.accountsDeleted.Add(accounts)
+	}
+
+	j.logger.Info("Janitor run finished",
+		slog.Bool("dryRun", j.dryRun),
+		slog.Bool("completed", completed),
+		slog.Int64("tokens", tokens),
+		slog.Int64("unverifiedUsers", users),
+		slog.Int64("devices", devices),
+		slog.Int64("authorizations", authorizations),
+		slog.Int64("auditRecords", audit),
+		slog.Int64("deletedAccounts", accounts),
+		slog.Duration("took", time.Since(now)))
+}
+
+// cleanupStep is one batch of a janitor run.
+type cleanupStep struct {
+	name    string
+	removed *int64
+	run     func() (int64, error)
+}
+
+// renewLease extends the lease before the next step of a run. It reports false,
+// ending the run, when the lease cannot be renewed or was taken over.
+func (j *Janitor) renewLease(ctx context.Context) bool {
+	leader, err := j.leases.TryAcquire(ctx, leaseName, j.holder, j.leaseTTL)
+	if err != nil {
+		j.failures.Add(1)
+		j.logger.Error("Failed to renew janitor lease", slog.String("error", err.Error()))
+		return false
+	}
+	if !leader {
+		j.logger.Warn("Janitor lease was taken over by another instance, stopping the run")
+		return false
+	}
+	return true
+}
+
+// Stats returns the totals accumulated since the janitor was created.
+// Records that were only counted in dry-run mode are not included.
+func (j *Janitor) Stats() Stats {
+	stats := Stats{
+		Runs:                  j.runs.Load(),
+		Failures:              j.failures.Load(),
+		TokensRemoved:         j.tokensRemoved.Load(),
+		UsersRemoved:          j.usersRemoved.Load(),
+		DevicesRemoved:        j.devicesRemoved.Load(),
+		AuditRemoved:          j.auditRemoved.Load(),
+		AuthorizationsRemoved: j.authzRemoved.Load(),
+		AccountsDeleted:       j.accountsDeleted.Load(),
+	}
+	if last := j.lastRun.Load(); last != 0 {
+		stats.LastRun = time.Unix(last, 0)
+	}
+	return stats
+}
+
+// holderID identifies this process in the lease document.
+func holderID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return host + "-" + hex.EncodeToString(suffix)
+}
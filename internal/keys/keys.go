@@ -0,0 +1,343 @@
+// Package keys manages the keys used to sign and verify JWTs.
+//
+// Tokens are signed with the newest active ES256 key from the KeyRepository and
+// carry its ID in the "kid" header. The server creates the first key on startup
+// (EnsureKey), so that the JWKS endpoint always publishes the key that signs new
+// tokens. Only while no key exists is the shared HS256 secret from the configuration
+// used for signing. Retired keys and the shared secret still verify tokens, which
+// lets refresh tokens issued before a rotation stay valid.
+//
+// Rotation is usually triggered from the CLI ("keys rotate"); running servers pick
+// up the new key the next time they refresh the key set.
+package keys
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/exp/slog"
+)
+
+// Algorithm is the JWS algorithm of the keys created by Rotate.
+const Algorithm = "ES256"
+
+// DefaultRefreshInterval is how often Start reloads the key set.
+const DefaultRefreshInterval = time.Minute
+
+// signingKey is a parsed db.SigningKey.
+type signingKey struct {
+	id         string
+	privateKey *ecdsa.PrivateKey
+	publicKey  *ecdsa.PublicKey
+}
+
+// keySet is an immutable snapshot of the loaded keys.
+type keySet struct {
+	active *signingKey                 // nil until the first rotation
+	public map[string]*ecdsa.PublicKey // keyed by kid, active and retired keys
+}
+
+// Manager signs tokens with the active key and verifies them with any known key.
+// It implements utils.TokenSigner and utils.TokenVerifier.
+type Manager struct {
+	repo      repository.KeyRepository
+	secret    utils.HMACSecret
+	retention time.Duration
+	logger    *slog.Logger
+
+	set atomic.Pointer[keySet]
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewManager returns a Manager using the keys stored in repo. The shared secret
+// signs tokens while no key has been created and keeps verifying HS256 tokens.
+// Retired keys are accepted for the retention period, normally the refresh token lifetime.
+func NewManager(repo repository.KeyRepository, secret string, retention time.Duration, lg *slog.Logger) *Manager {
+	m := &Manager{
+		repo:      repo,
+		secret:    utils.HMACSecret(secret),
+		retention: retention,
+		logger:    lg,
+	}
+	m.set.Store(&keySet{public: map[string]*ecdsa.PublicKey{}})
+	return m
+}
+
+// Refresh reloads the key set from the repository.
+func (m *Manager) Refresh(ctx context.Context) error {
+	stored, err := m.repo.List(ctx)
+	if err != nil {
+		return fmt.Errorf("error loading signing keys: %w", err)
+	}
+
+	now := time.Now()
+	set := &keySet{public: make(map[string]*ecdsa.PublicKey, len(stored))}
+	for _, key := range stored {
+		retired := !key.RetiredAt.IsZero()
+		if retired && now.Sub(key.RetiredAt) > m.retention {
+			continue
+		}
+		parsed, err := parseKey(key)
+		if err != nil {
+			m.logger.Error("Skipping invalid signing key", slog.String("kid", key.ID), slog.String("error", err.Error()))
+			continue
+		}
+		set.public[key.ID] = parsed.publicKey
+		// Keys are listed newest first
+		if !retired && set.active == nil {
+			set.active = parsed
+		}
+	}
+	m.set.Store(set)
+	return nil
+}
+
+// Start loads the keys and keeps reloading them every interval until Stop is called.
+func (m *Manager) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+
+	if err := m.Refresh(ctx); err != nil {
+		m.logger.Error("Failed to load signing keys", slog.String("error", err.Error()))
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := m.Refresh(ctx); err != nil && ctx.Err() == nil {
+				m.logger.Error("Failed to refresh signing keys", slog.String("error", err.Error()))
+			}
+		}
+	}()
+}
+
+// Stop ends the refresh loop started by Start.
+func (m *Manager) Stop(ctx context.Context) error {
+	if m.cancel == nil {
+		return nil
+	}
+	m.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Rotate creates a new active key and retires the keys that were active before.
+// It returns the ID of the new key.
+func (m *Manager) Rotate(ctx context.Context) (string, error) {
+	previous, err := m.repo.List(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error loading signing keys: %w", err)
+	}
+
+	key, err := generateKey(time.Now().UTC())
+	if err != nil {
+		return "", err
+	}
+	if err := m.repo.Create(ctx, key); err != nil {
+		return "", fmt.Errorf("error storing signing key: %w", err)
+	}
+
+	for _, old := range previous {
+		if old.RetiredAt.IsZero() {
+			if err := m.repo.Retire(ctx, old.ID, key.CreatedAt); err != nil {
+				return "", fmt.Errorf("error retiring signing key %s: %w", old.ID, err)
+			}
+		}
+	}
+	return key.ID, m.Refresh(ctx)
+}
+
+// EnsureKey creates the first signing key when the repository holds no active key
+// and reports whether it did. Replicas starting at the same time may each create
+// one; the newest is used for signing and all of them verify.
+func (m *Manager) EnsureKey(ctx context.Context) (string, bool, error) {
+	stored, err := m.repo.List(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("error loading signing keys: %w", err)
+	}
+	for _, key := range stored {
+		if key.RetiredAt.IsZero() {
+			return key.ID, false, nil
+		}
+	}
+
+	kid, err := m.Rotate(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	return kid, true, nil
+}
+
+// Loaded reports whether tokens can be signed.
+func (m *Manager) Loaded() bool {
+	return m.set.Load().active != nil || len(m.secret) > 0
+}
+
+// SignToken signs the claims with the active key, or with the shared secret
+// when no key has been created yet.
+func (m *Manager) SignToken(claims jwt.Claims) (string, error) {
+	active := m.set.Load().active
+	if active == nil {
+		if len(m.secret) == 0 {
+			return "", errors.New("no signing key loaded")
+		}
+		return m.secret.SignToken(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = active.id
+	return token.SignedString(active.privateKey)
+}
+
+// VerificationKey returns the key that signed the token: the public key named by
+// the "kid" header for ES256 and the shared secret for HS256.
+func (m *Manager) VerificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(m.secret) == 0 {
+			return nil, utils.ErrTokenSignatureInvalid
+		}
+		return m.secret.VerificationKey(token)
+	case *jwt.SigningMethodECDSA:
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := m.set.Load().public[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, utils.ErrTokenSignatureInvalid
+}
+
+// JSONWebKey is a public key in the JWK format of RFC 7517.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+// JSONWebKeySet is the document published at the JWKS endpoint.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys that verify tokens, the active key first.
+// Tokens signed with the shared HS256 secret cannot be verified with it.
+func (m *Manager) JWKS() JSONWebKeySet {
+	set := m.set.Load()
+	kids := make([]string, 0, len(set.public))
+	for kid := range set.public {
+		kids = append(kids, kid)
+	}
+	sort.Slice(kids, func(i, j int) bool {
+		if set.active != nil && (kids[i] == set.active.id) != (kids[j] == set.active.id) {
+			return kids[i] == set.active.id
+		}
+		return kids[i] < kids[j]
+	})
+
+	jwks := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(kids))}
+	for _, kid := range kids {
+		key := set.public[kid]
+		x, y := make([]byte, 32), make([]byte, 32)
+		key.X.FillBytes(x)
+		key.Y.FillBytes(y)
+		jwks.Keys = append(jwks.Keys, JSONWebKey{
+			KeyType:   "EC",
+			Curve:     "P-256",
+			X:         base64.RawURLEncoding.EncodeToString(x),
+			Y:         base64.RawURLEncoding.EncodeToString(y),
+			KeyID:     kid,
+			Algorithm: Algorithm,
+			Use:       "sig",
+		})
+	}
+	return jwks
+}
+
+// generateKey creates a P-256 key pair. The key ID is derived from the public key.
+func generateKey(now time.Time) (db.SigningKey, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return db.SigningKey{}, fmt.Errorf("error generating signing key: %w", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return db.SigningKey{}, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return db.SigningKey{}, err
+	}
+
+	sum := sha256.Sum256(publicDER)
+	return db.SigningKey{
+		ID:         base64.RawURLEncoding.EncodeToString(sum[:16]),
+		Algorithm:  Algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		CreatedAt:  now,
+	}, nil
+}
+
+// parseKey decodes the PEM encoded key pair of a stored key.
+func parseKey(key db.SigningKey) (*signingKey, error) {
+	if key.Algorithm != Algorithm {
+		return nil, fmt.Errorf("unsupported algorithm %q", key.Algorithm)
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an ECDSA key")
+	}
+	return &signingKey{id: key.ID, privateKey: privateKey, publicKey: &privateKey.PublicKey}, nil
+}
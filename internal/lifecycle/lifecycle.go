@@ -0,0 +1,148 @@
+// Package lifecycle coordinates the startup and graceful shutdown of the service.
+//
+// The Manager runs the server until SIGINT or SIGTERM is received, then marks the
+// instance as not ready, waits for load balancers to notice, and runs the registered
+// shutdown hooks one after another in registration order within the configured timeout.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+type hook struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// Manager tracks readiness and owns the ordered list of shutdown hooks.
+type Manager struct {
+	logger          *slog.Logger
+	shutdownTimeout time.Duration
+	readinessDrain  time.Duration
+
+	ready        atomic.Bool
+	shuttingDown atomic.Bool
+
+	mu    sync.Mutex
+	hooks []hook
+}
+
+// New returns a Manager configured from cfg. Zero values fall back to defaults.
+func New(cfg config.LifecycleConfig, lg *slog.Logger) *Manager {
+	shutdownTimeout := time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+
+	return &Manager{
+		logger:          lg,
+		shutdownTimeout: shutdownTimeout,
+		readinessDrain:  time.Duration(cfg.ReadinessDrainSeconds) * time.Second,
+	}
+}
+
+// OnShutdown registers a hook that is called during shutdown.
+// Hooks run sequentially in the order they were registered.
+func (m *Manager) OnShutdown(name string, stop func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hooks = append(m.hooks, hook{name: name, stop: stop})
+}
+
+// Ready reports whether the instance should receive traffic.
+func (m *Manager) Ready() bool {
+	return m.ready.Load() && !m.shuttingDown.Load()
+}
+
+// ShuttingDown reports whether shutdown has begun.
+func (m *Manager) ShuttingDown() bool {
+	return m.shuttingDown.Load()
+}
+
+// Run starts every serve function in the background, marks the instance ready and
+// blocks until a termination signal arrives or one of the servers stops. It then
+// performs the shutdown and returns the error of the failed server, if any.
+// A second signal aborts the shutdown immediately.
+func (m *Manager) Run(servers ...func() error) error {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	serveErr := make(chan error, len(servers))
+	for _, serve := range servers {
+		go func(serve func() error) {
+			serveErr <- serve()
+		}(serve)
+	}
+	m.ready.Store(true)
+
+	var runErr error
+	select {
+	case sig := <-signals:
+		m.logger.Info("Received signal, shutting down", slog.String("signal", sig.String()))
+	case err := <-serveErr:
+		if err != nil {
+			m.logger.Error("Server stopped unexpectedly", slog.String("error", err.Error()))
+			runErr = err
+		}
+	}
+
+	go func() {
+		sig := <-signals
+		m.logger.Error("Received second signal, exiting immediately", slog.String("signal", sig.String()))
+		os.Exit(1)
+	}()
+
+	if err := m.Shutdown(); err != nil && runErr == nil {
+		runErr = err
+	}
+	return runErr
+}
+
+// Shutdown flips readiness, waits for the readiness drain period and runs every
+// hook within the shutdown timeout. Failing hooks do not stop the remaining ones.
+func (m *Manager) Shutdown() error {
+	if !m.shuttingDown.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	if m.readinessDrain > 0 {
+		m.logger.Info("Readiness disabled, waiting for load balancers", slog.Duration("drain", m.readinessDrain))
+		time.Sleep(m.readinessDrain)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancel()
+
+	m.mu.Lock()
+	hooks := append([]hook(nil), m.hooks...)
+	m.mu.Unlock()
+
+	var errs []error
+	for _, h := range hooks {
+		start := time.Now()
+		if err := h.stop(ctx); err != nil {
+			m.logger.Error("Shutdown step failed", slog.String("step", h.name), slog.String("error", err.Error()))
+			errs = append(errs, err)
+			continue
+		}
+		m.logger.Debug("Shutdown step finished", slog.String("step", h.name), slog.Duration("took", time.Since(start)))
+	}
+
+	return errors.Join(errs...)
+}
@@ -8,9 +8,21 @@ import (
 	"os"
 )
 
-func SetupLogger(cfg *config.Config) *slog.Logger {
-	level := parseLogLevel(cfg.Logging.Level)
+// level is the minimum level of the application logger. It can be changed at
+// runtime with SetLevel when the configuration is reloaded.
+var level = new(slog.LevelVar)
+
+// SetLevel changes the minimum level of the logger created by SetupLogger.
+func SetLevel(l config.LogLevel) {
+	level.Set(parseLogLevel(l))
+}
+
+// SetupLogger creates the application logger and returns it together with a
+// function that flushes and closes the underlying output.
+func SetupLogger(cfg *config.Config) (*slog.Logger, func() error) {
+	SetLevel(cfg.Logging.Level)
 	var logger *slog.Logger
+	var closeOutput func() error
 
 	// Setup lumberjack for log rotation
 	logWriter := &lumberjack.Logger{
@@ -23,13 +35,15 @@ func SetupLogger(cfg *config.Config) *slog.Logger {
 
 	// Use lumberjack for file logging if file path is specified
 	if cfg.Logging.FileOutput.FilePath != "" {
-		logger = slog.New(slog.NewJSONHandler(logWriter, &slog.HandlerOptions{Level: level}))
+		logger = slog.New(NewContextHandler(slog.NewJSONHandler(logWriter, &slog.HandlerOptions{Level: level})))
+		closeOutput = logWriter.Close
 	} else {
 		// Use standard output if file path is not specified
-		logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+		logger = slog.New(NewContextHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level})))
+		closeOutput = os.Stdout.Sync
 	}
 
-	return logger
+	return logger, closeOutput
 }
 
 func Err(err error) slog.Attr {
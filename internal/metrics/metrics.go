@@ -0,0 +1,164 @@
+// Package metrics exposes Prometheus metrics for the authentication flows.
+//
+// The collectors are registered on a dedicated registry that is served by the
+// admin server, so metrics are never reachable through the public port.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/janitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+)
+
+const namespace = "kidneysmart_auth"
+
+// Metrics owns the Prometheus registry and every collector of the service.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpDuration     *prometheus.HistogramVec
+	responseStatuses *prometheus.CounterVec
+	emailDuration    *prometheus.HistogramVec
+	emailFailures    prometheus.Counter
+	mongoDuration    *prometheus.HistogramVec
+}
+
+// New creates the collectors and registers them together with the Go runtime
+// and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		responseStatuses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "response_status_total",
+			Help:      "Number of responses by route and the Status string returned in the body.",
+		}, []string{"route", "status"}),
+		emailDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "email_send_duration_seconds",
+			Help:      "Latency of calls to the email sender by gRPC method and result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "result"}),
+		emailFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "email_send_failures_total",
+			Help:      "Number of failed calls to the email sender.",
+		}),
+		mongoDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "mongo_command_duration_seconds",
+			Help:      "Latency of MongoDB commands by command name and result.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"command", "result"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpDuration,
+		m.responseStatuses,
+		m.emailDuration,
+		m.emailFailures,
+		m.mongoDuration,
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// EmailClientInterceptor measures the latency and failures of calls made through
+// the gRPC connection to the email sender.
+func (m *Metrics) EmailClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		result := "success"
+		if err != nil {
+			result = "error"
+			m.emailFailures.Inc()
+		}
+		m.emailDuration.WithLabelValues(method, result).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// MongoMonitor returns a command monitor that records the latency of every MongoDB command.
+func (m *Metrics) MongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			m.mongoDuration.WithLabelValues(e.CommandName, "success").Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			m.mongoDuration.WithLabelValues(e.CommandName, "error").Observe(e.Duration.Seconds())
+		},
+	}
+}
+
+// RegisterActiveSessions exposes the number of active refresh tokens. The count is
+// queried on every scrape, bounded by a short timeout.
+func (m *Metrics) RegisterActiveSessions(count func(ctx context.Context, now time.Time) (int64, error), lg *slog.Logger) {
+	m.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_sessions",
+		Help:      "Number of active, unexpired refresh tokens.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		n, err := count(ctx, time.Now())
+		if err != nil {
+			lg.Warn("Failed to count active sessions", slog.String("error", err.Error()))
+			return 0
+		}
+		return float64(n)
+	}))
+}
+
+// RegisterJanitor exposes the totals accumulated by the janitor.
+func (m *Metrics) RegisterJanitor(stats func() janitor.Stats) {
+	counter := func(name, help string, value func(janitor.Stats) int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "janitor",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(stats())) })
+	}
+
+	m.Registry.MustRegister(
+		counter("runs_total", "Number of cleanup runs performed while holding the lease.",
+			func(s janitor.Stats) int64 { return s.Runs }),
+		counter("failures_total", "Number of failed cleanup steps.",
+			func(s janitor.Stats) int64 { return s.Failures }),
+		counter("tokens_removed_total", "Number of expired or inactive refresh tokens removed.",
+			func(s janitor.Stats) int64 { return s.TokensRemoved }),
+		counter("users_removed_total", "Number of unverified users removed.",
+			func(s janitor.Stats) int64 { return s.UsersRemoved }),
+		counter("devices_removed_total", "Number of orphaned device records removed.",
+			func(s janitor.Stats) int64 { return s.DevicesRemoved }),
+		counter("audit_records_removed_total", "Number of audit records removed after the retention period.",
+			func(s janitor.Stats) int64 { return s.AuditRemoved }),
+		counter("oauth_authorizations_removed_total", "Number of expired OAuth authorization requests and client assertions removed.",
+			func(s janitor.Stats) int64 { return s.AuthorizationsRemoved }),
+		counter("accounts_deleted_total", "Number of accounts removed after their deletion grace period.",
+			func(s janitor.Stats) int64 { return s.AccountsDeleted }),
+	)
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSniffedBody limits how much of a response body is kept to read its status field.
+const maxSniffedBody = 4 << 10
+
+// statusSniffer keeps the beginning of a JSON response body so that the Status
+// string returned by the handlers can be counted without changing them.
+type statusSniffer struct {
+	gin.ResponseWriter
+	body []byte
+}
+
+func (w *statusSniffer) Write(b []byte) (int, error) {
+	w.sniff(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusSniffer) WriteString(s string) (int, error) {
+	w.sniff([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *statusSniffer) sniff(b []byte) {
+	if room := maxSniffedBody - len(w.body); room > 0 {
+		if len(b) > room {
+			b = b[:room]
+		}
+		w.body = append(w.body, b...)
+	}
+}
+
+// HTTPMiddleware records the request duration by route template and status code
+// and counts the "status" field of JSON responses.
+func (m *Metrics) HTTPMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		sniffer := &statusSniffer{ResponseWriter: c.Writer}
+		c.Writer = sniffer
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		m.httpDuration.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+
+		if !strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "application/json") {
+			return
+		}
+		var body struct {
+			Status string `json:"status"`
+		}
+		if json.Unmarshal(sniffer.body, &body) == nil && body.Status != "" {
+			m.responseStatuses.WithLabelValues(route, body.Status).Inc()
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/rbac"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/a-dev-mobile/kidneysmart-auth/pkg/authmw"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminActorKey хранит идентификатор администратора, выполняющего запрос к API
+// администрирования: "mtls:<CN сертификата>" или "user:<userID>".
+const AdminActorKey ContextKey = "adminActor"
+
+// AdminAuth возвращает цепочку middleware API администрирования. Запрос пропускается,
+// если клиент предъявил сертификат, проверенный при TLS рукопожатии админ-сервера (mTLS),
+// CN или DNS имя которого входит в allowedClients, или access токен пользователя с ролью
+// admin. Для остальных сертификатов проверяется токен.
+func AdminAuth(verifier utils.TokenVerifier, users repository.UserRepository, allowedClients []string) gin.HandlersChain {
+	authenticate := AuthMiddleware(verifier, users)
+	requireAdmin := RequireRole(rbac.RoleAdmin)
+	return gin.HandlersChain{
+		func(c *gin.Context) {
+			if cert := verifiedClientCertificate(c.Request); cert != nil {
+				if name, ok := allowedClientName(cert, allowedClients); ok {
+					c.Set(string(AdminActorKey), "mtls:"+name)
+					c.Next()
+					return
+				}
+			}
+			authenticate(c)
+		},
+		func(c *gin.Context) {
+			if _, ok := c.Get(string(AdminActorKey)); ok {
+				c.Next()
+				return
+			}
+			// Actor устанавливается до проверки роли; при отказе запрос прерывается
+			if claims, ok := authmw.ClaimsFromContext(c.Request.Context()); ok {
+				c.Set(string(AdminActorKey), "user:"+claims.UserID)
+			}
+			requireAdmin(c)
+		},
+	}
+}
+
+// AdminActor возвращает идентификатор администратора, установленный AdminAuth.
+func AdminActor(c *gin.Context) string {
+	return c.GetString(string(AdminActorKey))
+}
+
+// verifiedClientCertificate возвращает клиентский сертификат, цепочка которого
+// проверена при рукопожатии, или nil для запросов без mTLS.
+func verifiedClientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// allowedClientName возвращает CN или DNS имя сертификата, входящее в allowed.
+func allowedClientName(cert *x509.Certificate, allowed []string) (string, bool) {
+	for _, name := range append([]string{cert.Subject.CommonName}, cert.DNSNames...) {
+		for _, a := range allowed {
+			if name != "" && name == a {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
@@ -2,9 +2,11 @@ package middleware
 
 import (
 	"net/http"
-	"strings"
 
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/account"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/repository"
 	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils" // Убедитесь, что путь к пакету корректен
+	"github.com/a-dev-mobile/kidneysmart-auth/pkg/authmw"
 	"github.com/gin-gonic/gin"
 )
 
@@ -12,62 +14,54 @@ import (
 type ContextKey string
 
 // Определение константы для ключа userID
-const UserIDKey ContextKey = "userID"
+const UserIDKey ContextKey = authmw.UserIDKey
+
+// ClientIDKey хранит client_id токена машинного клиента (client_credentials)
+const ClientIDKey ContextKey = authmw.ClientIDKey
 
 // AuthErrorResponse структура для ответов об ошибках аутентификации
-type AuthErrorResponse struct {
-	Status  string `json:"status"`
-	Message string `json:"message"`
-}
+type AuthErrorResponse = authmw.ErrorResponse
 
 // AuthMiddleware создает middleware для проверки JWT токена.
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// Проверка выполняется тем же кодом, что и в pkg/authmw у других сервисов,
+// но с собственными ключами подписи. Дополнительно проверяется статус учетной
+// записи пользователя: токены заблокированных пользователей отклоняются с 403
+// ACCOUNT_SUSPENDED сразу, не дожидаясь истечения их срока.
+//
+// Пропускаются только токены приложений KidneySmart: токены, выданные OAuth
+// клиентам (с client_id), отклоняются с 403 FIRST_PARTY_TOKEN_REQUIRED.
+func AuthMiddleware(verifier utils.TokenVerifier, users repository.UserRepository) gin.HandlerFunc {
+	authenticate := TokenMiddleware(verifier, users)
 	return func(c *gin.Context) {
-		// Извлечение токена из заголовка Authorization
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, AuthErrorResponse{Status: "AUTHORIZATION_REQUIRED", Message: "Authorization header is required"})
+		authenticate(c)
+		if c.IsAborted() {
 			return
 		}
-
-		// Проверка формата токена (обычно это 'Bearer [token]')
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if token == authHeader {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, AuthErrorResponse{Status: "INVALID_TOKEN_FORMAT", Message: "Invalid token format. Format should be 'Bearer [token]'."})
+		if claims, _ := authmw.ClaimsFromContext(c.Request.Context()); claims != nil && claims.ClientID != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, AuthErrorResponse{
+				Status:  "FIRST_PARTY_TOKEN_REQUIRED",
+				Message: "This operation is only available to the KidneySmart apps.",
+			})
 			return
 		}
+		c.Next()
+	}
+}
 
-		// Парсинг и валидация токена
-		userID, err := utils.ParseToken(token, jwtSecret, "access")
-		if err != nil {
-			var status string
-			var message string
-			switch err {
-			case utils.ErrTokenExpired:
-				status = "TOKEN_EXPIRED"
-				message = "Your token has expired. Please log in again."
-			case utils.ErrInvalidToken, utils.ErrInvalidTokenType:
-				status = "INVALID_TOKEN"
-				message = "The provided token is invalid. Check the token and try again."
-			case utils.ErrUserIDNotFound:
-				status = "USER_ID_NOT_FOUND"
-				message = "UserID not found in token."
-			case utils.ErrTokenSignatureInvalid:
-				status = "INVALID_TOKEN_SIGNATURE"
-				message = "The token's signature is invalid. The token may have been tampered with."
-			default:
-				status = "AUTHENTICATION_FAILED"
-				message = "Error occurred during token validation. Please try again."
-			}
-
-			c.AbortWithStatusJSON(http.StatusUnauthorized, AuthErrorResponse{Status: status, Message: message})
-			return
-		}
+// TokenMiddleware проверяет токен так же, как AuthMiddleware, но пропускает и
+// токены OAuth клиентов. Обработчик сам проверяет их scopes.
+func TokenMiddleware(verifier utils.TokenVerifier, users repository.UserRepository) gin.HandlerFunc {
+	return authmw.Gin(account.NewVerifier(authmw.NewKeyVerifier(verifier), users))
+}
 
-		// Добавление userID в контекст Gin
-		c.Set(string(UserIDKey), userID)
+// RequireRole пропускает запрос, если у токена есть хотя бы одна из ролей roles.
+// Используется после AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return authmw.GinRequireRole(roles...)
+}
 
-		// Переход к следующему обработчику
-		c.Next()
-	}
+// RequireScope пропускает запрос, если токену выдан хотя бы один из scopes.
+// Используется после AuthMiddleware.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return authmw.GinRequireScope(scopes...)
 }
@@ -9,18 +9,17 @@ import (
 	"golang.org/x/exp/slog"
 )
 
-func CORSMiddleware(cfg config.Config, lg *slog.Logger) gin.HandlerFunc {
-	// Create a map of allowed sources once during middleware initialization
-	allowedOrigins := map[string]bool{}
-	for _, allowedOrigin := range cfg.ClientConnection.AllowedOrigins {
-		allowedOrigins[allowedOrigin] = true
-	}
+// CORSMiddleware checks the Origin of every request against the allowed origins.
+// The settings are read from holder on every request, so a reloaded list of
+// allowed origins takes effect immediately.
+func CORSMiddleware(holder *config.Holder, lg *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		cfg := holder.Get()
 		origin := c.Request.Header.Get("Origin")
 		// Разрешить запросы без Origin в режиме разработки
 		if origin == "" && cfg.ClientConnection.GinMode == "debug" {
 			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		} else if _, ok := allowedOrigins[origin]; ok {
+		} else if originAllowed(cfg.ClientConnection.AllowedOrigins, origin) {
 			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
 		} else {
 			lg.Warn("CORS policy rejection", slog.String("origin", origin))
@@ -30,8 +29,9 @@ func CORSMiddleware(cfg config.Config, lg *slog.Logger) gin.HandlerFunc {
 		}
 
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -41,3 +41,12 @@ func CORSMiddleware(cfg config.Config, lg *slog.Logger) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+func originAllowed(allowedOrigins []string, origin string) bool {
+	for _, allowedOrigin := range allowedOrigins {
+		if allowedOrigin == origin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/requestid"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+// errorAnnotation returns a field name and value that is added to JSON error bodies.
+// An empty value leaves the body unchanged.
+type errorAnnotation func(ctx context.Context) (string, string)
+
+// errorAnnotations lists the fields added to every JSON error response.
+var errorAnnotations = []errorAnnotation{
+	func(ctx context.Context) (string, string) { return "requestId", requestid.FromContext(ctx) },
+	func(ctx context.Context) (string, string) { return "traceId", tracing.TraceID(ctx) },
+}
+
+// annotatingWriter rewrites JSON error bodies before they reach the client.
+type annotatingWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+}
+
+func (w *annotatingWriter) Write(b []byte) (int, error) {
+	if w.Status() < 400 || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(b)
+	}
+	annotated, ok := annotateJSON(w.ctx, b)
+	if !ok {
+		return w.ResponseWriter.Write(b)
+	}
+	if _, err := w.ResponseWriter.Write(annotated); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w *annotatingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// annotateJSON adds the error annotations to a JSON object. Fields that the
+// handler already set are kept as they are.
+func annotateJSON(ctx context.Context, b []byte) ([]byte, bool) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(b, &body); err != nil || body == nil {
+		return nil, false
+	}
+	changed := false
+	for _, annotate := range errorAnnotations {
+		key, value := annotate(ctx)
+		if value == "" {
+			continue
+		}
+		if _, exists := body[key]; exists {
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		body[key] = encoded
+		changed = true
+	}
+	if !changed {
+		return nil, false
+	}
+	annotated, err := json.Marshal(body)
+	if err != nil {
+		return nil, false
+	}
+	return annotated, true
+}
+
+// ErrorAnnotations adds correlation identifiers, the request ID and the trace ID, to JSON error
+// responses so that a failed request reported by a client can be found in the logs.
+func ErrorAnnotations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &annotatingWriter{ResponseWriter: c.Writer, ctx: c.Request.Context()}
+		c.Next()
+	}
+}
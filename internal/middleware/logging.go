@@ -1,20 +1,208 @@
 package middleware
 
 import (
-	"log"
+	"bytes"
+	"encoding/json"
+	"io"
+	mathrand "math/rand"
+	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
 )
 
-func LogHeaders() gin.HandlerFunc {
+const (
+	redacted            = "[REDACTED]"
+	defaultMaxBodyBytes = 4 << 10
+)
+
+// Headers and JSON fields that are always redacted, whatever the configuration says.
+var (
+	defaultRedactHeaders = []string{
+		"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key",
+	}
+	defaultRedactBodyFields = []string{
+		"password", "code", "token", "accessToken", "refreshToken",
+		"access_token", "refresh_token", "id_token", "client_secret", "code_verifier", "cancelToken",
+	}
+)
+
+// AccessLog writes one structured record per request to lg. The record contains
+// the method, route template, status, latency, client IP and, when the
+// request was authenticated, the user ID. Headers and the JSON request body are
+// logged only when enabled and always pass through redaction. The request ID set by
+// RequestID is added by the context aware log handler.
+//
+// Successful requests of the routes listed in logging.accessLog.sampleRates are
+// logged with the given probability; failed requests are always logged.
+// The settings are taken from holder, so a configuration reload applies to the
+// next request.
+func AccessLog(holder *config.Holder, lg *slog.Logger) gin.HandlerFunc {
+	var cache atomic.Pointer[accessLogSettings]
+	current := func() *accessLogSettings {
+		cfg := holder.Get()
+		if settings := cache.Load(); settings != nil && settings.source == cfg {
+			return settings
+		}
+		settings := newAccessLogSettings(cfg)
+		cache.Store(settings)
+		return settings
+	}
+
 	return func(c *gin.Context) {
-		currentTime := time.Now().Format("2006/01/02 15:04:05")
-		log.Printf("\n[%s] Headers for %s %s:\n", currentTime, c.Request.Method, c.Request.URL.Path)
-		for k, v := range c.Request.Header {
-			log.Printf("  %s: %s", k, strings.Join(v, ","))
+		start := time.Now()
+		settings := current()
+		cfg := settings.cfg
+		redactHeaders, redactFields, maxBodyBytes := settings.redactHeaders, settings.redactFields, settings.maxBodyBytes
+
+		var body []byte
+		if cfg.LogBody && c.Request.Body != nil && c.Request.ContentLength <= int64(maxBodyBytes) {
+			body, _ = io.ReadAll(io.LimitReader(c.Request.Body, int64(maxBodyBytes)+1))
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
 		}
+
 		c.Next()
+
+		route := c.FullPath()
+		status := c.Writer.Status()
+		if status < http.StatusBadRequest && !sampled(cfg.SampleRates, route) {
+			return
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", clientIP(c)),
+			slog.String("user_agent", c.Request.UserAgent()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if userID, ok := c.Get(string(UserIDKey)); ok {
+			attrs = append(attrs, slog.Any("user_id", userID))
+		}
+		if clientID, ok := c.Get(string(ClientIDKey)); ok {
+			attrs = append(attrs, slog.Any("client_id", clientID))
+		}
+		if cfg.LogHeaders {
+			attrs = append(attrs, slog.Any("headers", redactHeaderValues(c.Request.Header, redactHeaders)))
+		}
+		if len(body) > 0 && len(body) <= maxBodyBytes {
+			if redactedBody, ok := redactJSON(body, redactFields); ok {
+				attrs = append(attrs, slog.String("body", redactedBody))
+			}
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		lg.LogAttrs(c.Request.Context(), level, "HTTP request", attrs...)
+	}
+}
+
+// accessLogSettings holds the access log configuration prepared for use on every request.
+type accessLogSettings struct {
+	source        *config.Config
+	cfg           config.AccessLogConfig
+	redactHeaders map[string]bool
+	redactFields  map[string]bool
+	maxBodyBytes  int
+}
+
+func newAccessLogSettings(source *config.Config) *accessLogSettings {
+	cfg := source.Logging.AccessLog
+	maxBodyBytes := cfg.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultMaxBodyBytes
+	}
+	return &accessLogSettings{
+		source:        source,
+		cfg:           cfg,
+		redactHeaders: lowerSet(defaultRedactHeaders, cfg.RedactHeaders),
+		redactFields:  lowerSet(defaultRedactBodyFields, cfg.RedactBodyFields),
+		maxBodyBytes:  maxBodyBytes,
+	}
+}
+
+// sampled reports whether a successful request of route should be logged.
+func sampled(rates map[string]float64, route string) bool {
+	rate, ok := rates[route]
+	if !ok || rate >= 1 {
+		return true
+	}
+	return rate > 0 && mathrand.Float64() < rate
+}
+
+// clientIP prefers the address stored by TrustProxyHeader.
+func clientIP(c *gin.Context) string {
+	if ip := c.GetString("ClientIP"); ip != "" {
+		return ip
+	}
+	return c.ClientIP()
+}
+
+func redactHeaderValues(header http.Header, redact map[string]bool) map[string]string {
+	values := make(map[string]string, len(header))
+	for name, v := range header {
+		if redact[strings.ToLower(name)] {
+			values[name] = redacted
+			continue
+		}
+		values[name] = strings.Join(v, ",")
+	}
+	return values
+}
+
+// redactJSON replaces the values of the redacted fields at any depth of a JSON document.
+// Bodies that are not valid JSON are not logged.
+func redactJSON(body []byte, redact map[string]bool) (string, bool) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", false
+	}
+	out, err := json.Marshal(redactValue(doc, redact))
+	if err != nil {
+		return "", false
+	}
+	return string(out), true
+}
+
+func redactValue(v interface{}, redact map[string]bool) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if redact[strings.ToLower(key)] {
+				value[key] = redacted
+			} else {
+				value[key] = redactValue(field, redact)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactValue(item, redact)
+		}
+	}
+	return v
+}
+
+func lowerSet(lists ...[]string) map[string]bool {
+	set := map[string]bool{}
+	for _, list := range lists {
+		for _, item := range list {
+			set[strings.ToLower(item)] = true
+		}
 	}
-}
\ No newline at end of file
+	return set
+}
@@ -15,7 +15,7 @@ func RecoveryMiddleware(lg *slog.Logger) gin.HandlerFunc {
 		defer func() {
 			if err := recover(); err != nil {
 				// Логирование паники
-				lg.Error("Server panic", slog.String("error", fmt.Sprintf("%v", err)))
+				lg.ErrorContext(c.Request.Context(), "Server panic", slog.String("error", fmt.Sprintf("%v", err)))
 
 				// Ответ сервера
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
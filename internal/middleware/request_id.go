@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDKey is the Gin context key of the request ID.
+const RequestIDKey ContextKey = "requestID"
+
+// RequestID accepts the X-Request-ID header sent by the client or generates a new ID,
+// stores it in the request context and echoes it in the response headers.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+		c.Set(string(RequestIDKey), id)
+		c.Header(requestid.Header, id)
+
+		c.Next()
+	}
+}
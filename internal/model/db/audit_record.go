@@ -0,0 +1,24 @@
+package db
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditRecord describes a security relevant action performed on an account.
+// Records are only ever appended; they are removed once the retention period has passed.
+type AuditRecord struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Action    string             `json:"action" bson:"action"`                     // Что произошло, например registration или admin.user_disable
+	Outcome   string             `json:"outcome" bson:"outcome"`                   // success или failure
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"` // Причина отказа
+	ActorID   string             `json:"actorId" bson:"actorId"`                   // Кто выполнил действие: пользователь, администратор или сервис
+	UserID    string             `json:"userId,omitempty" bson:"userId,omitempty"` // Затронутый пользователь
+	Email     string             `json:"email,omitempty" bson:"email,omitempty"`   // Email затронутого пользователя
+	IP        string             `json:"ip,omitempty" bson:"ip,omitempty"`         // IP адрес клиента
+	UserAgent string             `json:"userAgent,omitempty" bson:"userAgent,omitempty"`
+	RequestID string             `json:"requestId,omitempty" bson:"requestId,omitempty"`
+	Details   map[string]string  `json:"details,omitempty" bson:"details,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
@@ -12,8 +12,34 @@ type AuthUser struct {
 
 	Email           string    `json:"email" bson:"email"`
 	Code            string    `json:"code" bson:"code"`
+	CodeSentAt      time.Time `json:"codeSentAt" bson:"codeSentAt"` // Время отправки кода повторной аутентификации
 	EmailVerified   bool      `json:"emailVerified" bson:"emailVerified"`
 	AttemptCount    int       `json:"attemptCount" bson:"attemptCount"`
 	LastAttemptTime time.Time `json:"lastAttemptTime" bson:"lastAttemptTime"`
 	Password        string    `json:"password" bson:"password"`
+	Status          string    `json:"status" bson:"status"`                   // Статус учетной записи; пустой означает StatusActive
+	StatusReason    string    `json:"statusReason" bson:"statusReason"`       // Причина последнего изменения статуса
+	StatusChangedAt time.Time `json:"statusChangedAt" bson:"statusChangedAt"` // Время последнего изменения статуса
+	Roles           []string  `json:"roles" bson:"roles"`                     // Роли пользователя; без ролей пользователь считается пациентом
+	Permissions     []string  `json:"permissions" bson:"permissions"`         // Scope, выданные сверх ролей
+	CreatedAt       time.Time `json:"createdAt" bson:"createdAt"`
+
+	// Запрошенное пользователем удаление (StatusPendingDeletion)
+	DeletionScheduledAt time.Time `json:"deletionScheduledAt" bson:"deletionScheduledAt"` // Время окончательного удаления
+	DeletionCancelHash  string    `json:"deletionCancelHash" bson:"deletionCancelHash"`   // SHA-256 токена отмены удаления в hex
+}
+
+// Статусы учетной записи.
+const (
+	StatusActive          = "active"
+	StatusSuspended       = "suspended"        // Заблокирована администратором
+	StatusPendingDeletion = "pending_deletion" // Удаление запрошено пользователем
+)
+
+// AccountStatus возвращает статус учетной записи. Записи без статуса активны.
+func (u *AuthUser) AccountStatus() string {
+	if u.Status == "" {
+		return StatusActive
+	}
+	return u.Status
 }
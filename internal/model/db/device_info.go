@@ -0,0 +1,18 @@
+package db
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DeviceInfo describes a device a refresh token was issued to.
+type DeviceInfo struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	UserID     primitive.ObjectID `bson:"userId"`     // Ссылка на идентификатор пользователя
+	Platform   string             `bson:"platform"`   // Операционная система устройства
+	Model      string             `bson:"model"`      // Модель устройства
+	AppVersion string             `bson:"appVersion"` // Версия приложения
+	CreatedAt  time.Time          `bson:"createdAt"`  // Время первой регистрации устройства
+	LastSeenAt time.Time          `bson:"lastSeenAt"` // Время последнего обращения с устройства
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OAuth client types (RFC 6749, section 2.1).
+const (
+	ClientTypePublic       = "public"       // Не может хранить секрет, например SPA или мобильное приложение
+	ClientTypeConfidential = "confidential" // Аутентифицируется секретом на /token
+	ClientTypeMachine      = "machine"      // Сервис без пользователя, получает токены через client_credentials
+)
+
+// Client authentication methods at /token.
+const (
+	AuthMethodClientSecret  = "client_secret"   // Секрет через HTTP Basic или в форме
+	AuthMethodPrivateKeyJWT = "private_key_jwt" // JWT, подписанный ключом клиента (RFC 7523)
+)
+
+// OAuthClient is a third-party application registered to use the authorization code flow,
+// or a backend service (machine client) using the client credentials grant.
+type OAuthClient struct {
+	ID            string    `bson:"_id"`           // client_id
+	Name          string    `bson:"name"`          // Название, показываемое пользователю при согласии
+	Type          string    `bson:"type"`          // public, confidential или machine
+	AuthMethod    string    `bson:"authMethod"`    // client_secret или private_key_jwt; пустой значит client_secret
+	SecretHash    string    `bson:"secretHash"`    // SHA-256 секрета в hex; пустой у public клиентов
+	PublicKey     string    `bson:"publicKey"`     // PEM открытого ключа для private_key_jwt
+	RedirectURIs  []string  `bson:"redirectUris"`  // Разрешенные redirect_uri, сравниваются целиком
+	AllowedScopes []string  `bson:"allowedScopes"` // Scope, которые клиент может запросить
+	CreatedAt     time.Time `bson:"createdAt"`     // Время регистрации
+}
+
+// OAuthAuthorization is an authorization request in progress. It is created by
+// /authorize, completed by the email code login and the user's consent, and ends
+// when its authorization code is exchanged at /token.
+type OAuthAuthorization struct {
+	ID                  string             `bson:"_id"`                 // request_id, передается странице входа
+	ClientID            string             `bson:"clientId"`            // Клиент, начавший запрос
+	RedirectURI         string             `bson:"redirectUri"`         // redirect_uri запроса
+	Scopes              []string           `bson:"scopes"`              // Запрошенные scope
+	State               string             `bson:"state"`               // state клиента, возвращается без изменений
+	CodeChallenge       string             `bson:"codeChallenge"`       // PKCE code_challenge
+	CodeChallengeMethod string             `bson:"codeChallengeMethod"` // PKCE метод, всегда S256
+	Nonce               string             `bson:"nonce"`               // OpenID Connect nonce, копируется в ID токен
+	Email               string             `bson:"email"`               // Email, на который отправлен код входа
+	LoginCode           string             `bson:"loginCode"`           // Код входа из письма
+	AttemptCount        int                `bson:"attemptCount"`        // Число введенных кодов входа
+	UserID              primitive.ObjectID `bson:"userId"`              // Пользователь после успешного входа
+	AuthTime            time.Time          `bson:"authTime"`            // Время успешного входа (auth_time ID токена)
+	CodeHash            string             `bson:"codeHash,omitempty"`  // SHA-256 кода авторизации в hex
+	CodeExpiresAt       time.Time          `bson:"codeExpiresAt"`       // Время истечения кода авторизации
+	Consumed            bool               `bson:"consumed"`            // Код авторизации уже обменян на токен
+	CreatedAt           time.Time          `bson:"createdAt"`           // Время создания запроса
+	ExpiresAt           time.Time          `bson:"expiresAt"`           // Время, до которого запрос должен быть завершен
+}
+
+// OAuthConsent records the scopes a user has granted to a client.
+type OAuthConsent struct {
+	UserID    primitive.ObjectID `bson:"userId"`    // Пользователь, давший согласие
+	ClientID  string             `bson:"clientId"`  // Клиент, получивший согласие
+	Scopes    []string           `bson:"scopes"`    // Все одобренные scope
+	GrantedAt time.Time          `bson:"grantedAt"` // Время первого согласия
+	UpdatedAt time.Time          `bson:"updatedAt"` // Время последнего расширения согласия
+}
+
+// OAuthClientAssertion remembers a used private_key_jwt client assertion so that
+// it cannot be replayed before it expires.
+type OAuthClientAssertion struct {
+	ID        string    `bson:"_id"`       // client_id и jti через двоеточие
+	ClientID  string    `bson:"clientId"`  // Клиент, подписавший assertion
+	JTI       string    `bson:"jti"`       // jti из assertion
+	ExpiresAt time.Time `bson:"expiresAt"` // exp из assertion, после него запись удаляется
+}
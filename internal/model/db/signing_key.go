@@ -0,0 +1,14 @@
+package db
+
+import "time"
+
+// SigningKey is a key pair used to sign tokens. The key ID is published in the
+// "kid" header of every token it signs.
+type SigningKey struct {
+	ID         string    `bson:"_id"`        // Key ID (kid)
+	Algorithm  string    `bson:"algorithm"`  // JWS алгоритм, например ES256
+	PrivateKey string    `bson:"privateKey"` // PKCS#8 закрытый ключ в формате PEM
+	PublicKey  string    `bson:"publicKey"`  // PKIX открытый ключ в формате PEM
+	CreatedAt  time.Time `bson:"createdAt"`  // Время создания ключа
+	RetiredAt  time.Time `bson:"retiredAt"`  // Время вывода ключа из подписи; нулевое для активного ключа
+}
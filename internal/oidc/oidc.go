@@ -0,0 +1,21 @@
+// Package oidc holds the OpenID Connect vocabulary shared by the token, userinfo
+// and discovery endpoints.
+package oidc
+
+// Scopes of OpenID Connect Core, section 5.4. openid is required for an ID token,
+// email adds the email and email_verified claims. profile is accepted for client
+// compatibility; accounts hold no name or picture yet, so it adds no claims.
+const (
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+	ScopeProfile = "profile"
+)
+
+// SupportedScopes are the scopes published in the discovery document.
+var SupportedScopes = []string{ScopeOpenID, ScopeEmail, ScopeProfile}
+
+// SupportedClaims are the claims of ID tokens and of the userinfo response.
+var SupportedClaims = []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "amr", "email", "email_verified"}
+
+// AMROneTimeCode is the amr value (RFC 8176) of the sign-in with the code sent by email.
+const AMROneTimeCode = "otp"
@@ -0,0 +1,107 @@
+// Package rbac defines the roles of KidneySmart users and the scopes each role grants.
+// Roles and scopes are embedded in access tokens and checked by middleware.RequireRole
+// and middleware.RequireScope, or by authmw in other services.
+package rbac
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+)
+
+// Roles of users.
+const (
+	RolePatient   = "patient"
+	RoleCaregiver = "caregiver"
+	RoleClinician = "clinician"
+	RoleAdmin     = "admin"
+)
+
+// Scopes granted by the roles.
+const (
+	ScopeLabsRead     = "labs:read"
+	ScopeLabsWrite    = "labs:write"
+	ScopeRecordsRead  = "records:read"
+	ScopeRecordsWrite = "records:write"
+	ScopePatientsRead = "patients:read"
+	ScopeUsersRead    = "users:read"
+	ScopeUsersWrite   = "users:write"
+	ScopeRolesWrite   = "roles:write"
+	ScopeAuditRead    = "audit:read"
+)
+
+// roleScopes maps every role to the scopes it grants.
+var roleScopes = map[string][]string{
+	RolePatient:   {ScopeLabsRead, ScopeRecordsRead, ScopeRecordsWrite},
+	RoleCaregiver: {ScopeLabsRead, ScopeRecordsRead},
+	RoleClinician: {ScopeLabsRead, ScopeLabsWrite, ScopeRecordsRead, ScopePatientsRead},
+	RoleAdmin:     {ScopeUsersRead, ScopeUsersWrite, ScopeRolesWrite, ScopeAuditRead},
+}
+
+// scopePattern matches scopes such as "labs:read". Scopes are joined with spaces
+// in the access token, so they must not contain whitespace.
+var scopePattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]*(:[a-z0-9_.-]+)*$`)
+
+// Roles returns the names of all roles, sorted.
+func Roles() []string {
+	roles := make([]string, 0, len(roleScopes))
+	for role := range roleScopes {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// ValidRole reports whether role is known.
+func ValidRole(role string) bool {
+	_, ok := roleScopes[role]
+	return ok
+}
+
+// ValidScope reports whether scope is well-formed. Permissions are not limited to
+// the scopes of the roles, so that new APIs can be opened to single users.
+func ValidScope(scope string) bool {
+	return len(scope) <= 64 && scopePattern.MatchString(scope)
+}
+
+// EffectiveRoles returns the roles of the user. Users without roles are patients.
+func EffectiveRoles(user *db.AuthUser) []string {
+	if len(user.Roles) == 0 {
+		return []string{RolePatient}
+	}
+	return Normalize(user.Roles)
+}
+
+// Scopes returns the scopes granted to the user by their roles and additional permissions.
+func Scopes(user *db.AuthUser) []string {
+	var scopes []string
+	for _, role := range EffectiveRoles(user) {
+		scopes = append(scopes, roleScopes[role]...)
+	}
+	return Normalize(append(scopes, user.Permissions...))
+}
+
+// HasRole reports whether the user has role.
+func HasRole(user *db.AuthUser, role string) bool {
+	for _, r := range EffectiveRoles(user) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize returns values sorted, without duplicates and empty strings.
+func Normalize(values []string) []string {
+	set := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" && !set[value] {
+			set[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoAuditRepository is an AuditRepository backed by a MongoDB collection.
+type MongoAuditRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAuditRepository returns an AuditRepository operating on the given collection.
+func NewMongoAuditRepository(database *mongo.Database, collection string) *MongoAuditRepository {
+	return &MongoAuditRepository{
+		collection: database.Collection(collection),
+	}
+}
+
+func (r *MongoAuditRepository) Append(ctx context.Context, record db.AuditRecord) error {
+	if record.ID.IsZero() {
+		record.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, record)
+	return err
+}
+
+func (r *MongoAuditRepository) Find(ctx context.Context, filter AuditFilter, fn func(db.AuditRecord) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := r.collection.Find(ctx, mongoAuditFilter(filter), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var record db.AuditRecord
+		if err := cursor.Decode(&record); err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func mongoAuditFilter(filter AuditFilter) bson.M {
+	query := bson.M{}
+	if filter.UserID != "" {
+		query["userId"] = filter.UserID
+	}
+	if filter.Email != "" {
+		query["email"] = filter.Email
+	}
+	createdAt := bson.M{}
+	if !filter.From.IsZero() {
+		createdAt["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		createdAt["$lt"] = filter.To
+	}
+	if len(createdAt) > 0 {
+		query["createdAt"] = createdAt
+	}
+	return query
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoKeyRepository is a KeyRepository backed by a MongoDB collection.
+type MongoKeyRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoKeyRepository returns a KeyRepository that stores signing keys in the given collection.
+func NewMongoKeyRepository(database *mongo.Database, collection string) *MongoKeyRepository {
+	return &MongoKeyRepository{
+		collection: database.Collection(collection),
+	}
+}
+
+func (r *MongoKeyRepository) Create(ctx context.Context, key db.SigningKey) error {
+	_, err := r.collection.InsertOne(ctx, key)
+	return err
+}
+
+func (r *MongoKeyRepository) List(ctx context.Context) ([]db.SigningKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var keys []db.SigningKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *MongoKeyRepository) Retire(ctx context.Context, kid string, retiredAt time.Time) error {
+	update := bson.M{"$set": bson.M{"retiredAt": retiredAt}}
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": kid}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
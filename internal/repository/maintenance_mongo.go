@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoMaintenanceRepository is a MaintenanceRepository backed by MongoDB.
+type MongoMaintenanceRepository struct {
+	users          *mongo.Collection
+	tokens         *mongo.Collection
+	devices        *mongo.Collection
+	audit          *mongo.Collection
+	authorizations *mongo.Collection
+	assertions     *mongo.Collection
+	consents       *mongo.Collection
+}
+
+// NewMongoMaintenanceRepository returns a MaintenanceRepository operating on the given collections.
+func NewMongoMaintenanceRepository(database *mongo.Database, users, tokens, devices, audit, authorizations, assertions, consents string) *MongoMaintenanceRepository {
+	return &MongoMaintenanceRepository{
+		users:          database.Collection(users),
+		tokens:         database.Collection(tokens),
+		devices:        database.Collection(devices),
+		audit:          database.Collection(audit),
+		authorizations: database.Collection(authorizations),
+		assertions:     database.Collection(assertions),
+		consents:       database.Collection(consents),
+	}
+}
+
+func (r *MongoMaintenanceRepository) PurgeTokens(ctx context.Context, now time.Time, dryRun bool) (int64, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"expiresAt": bson.M{"$lt": now}},
+		bson.M{"isActive": false},
+	}}
+	return deleteOrCount(ctx, r.tokens, filter, dryRun)
+}
+
+func (r *MongoMaintenanceRepository) PurgeUnverifiedUsers(ctx context.Context, createdBefore time.Time, dryRun bool) (int64, error) {
+	// Users created before createdAt was introduced have no such field, so the
+	// creation time embedded in the ObjectID is used instead.
+	filter := bson.M{
+		"_id":           bson.M{"$lt": primitive.NewObjectIDFromTimestamp(createdBefore)},
+		"emailVerified": bson.M{"$ne": true},
+	}
+	return deleteOrCount(ctx, r.users, filter, dryRun)
+}
+
+func (r *MongoMaintenanceRepository) CompactDevices(ctx context.Context, dryRun bool) (int64, error) {
+	referenced, err := r.tokens.Distinct(ctx, "deviceInfoId", bson.M{"isActive": true})
+	if err != nil {
+		return 0, err
+	}
+	filter := bson.M{"_id": bson.M{"$nin": referenced}}
+	return deleteOrCount(ctx, r.devices, filter, dryRun)
+}
+
+func (r *MongoMaintenanceRepository) PurgeAuditRecords(ctx context.Context, createdBefore time.Time, dryRun bool) (int64, error) {
+	return deleteOrCount(ctx, r.audit, bson.M{"createdAt": bson.M{"$lt": createdBefore}}, dryRun)
+}
+
+func (r *MongoMaintenanceRepository) PurgeAuthorizations(ctx context.Context, now time.Time, dryRun bool) (int64, error) {
+	expired := bson.M{"expiresAt": bson.M{"$lt": now}}
+	authorizations, err := deleteOrCount(ctx, r.authorizations, expired, dryRun)
+	if err != nil {
+		return authorizations, err
+	}
+	assertions, err := deleteOrCount(ctx, r.assertions, expired, dryRun)
+	return authorizations + assertions, err
+}
+
+func (r *MongoMaintenanceRepository) PurgeUser(ctx context.Context, userID primitive.ObjectID, email string) error {
+	related := []struct {
+		collection *mongo.Collection
+		filter     bson.M
+	}{
+		{r.tokens, bson.M{"userId": userID}},
+		{r.devices, bson.M{"userId": userID}},
+		{r.consents, bson.M{"userId": userID}},
+		{r.authorizations, bson.M{"$or": bson.A{bson.M{"userId": userID}, bson.M{"email": email}}}},
+	}
+	for _, c := range related {
+		if _, err := c.collection.DeleteMany(ctx, c.filter); err != nil {
+			return err
+		}
+	}
+	_, err := r.users.DeleteOne(ctx, bson.M{"_id": userID})
+	return err
+}
+
+func (r *MongoMaintenanceRepository) AnonymiseAuditRecords(ctx context.Context, userID, email, pseudonym string) (int64, error) {
+	filter := bson.M{"$or": bson.A{bson.M{"userId": userID}, bson.M{"email": email}}}
+	update := bson.M{
+		"$set":   bson.M{"userId": pseudonym},
+		"$unset": bson.M{"email": "", "ip": "", "userAgent": ""},
+	}
+	res, err := r.audit.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	// The user is also the actor of its own actions and, as an administrator, of the
+	// actions recorded by the admin API
+	actors := bson.M{"actorId": bson.M{"$in": bson.A{userID, email, "user:" + userID}}}
+	if _, err := r.audit.UpdateMany(ctx, actors, bson.M{"$set": bson.M{"actorId": pseudonym}}); err != nil {
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+func deleteOrCount(ctx context.Context, collection *mongo.Collection, filter bson.M, dryRun bool) (int64, error) {
+	if dryRun {
+		return collection.CountDocuments(ctx, filter)
+	}
+	res, err := collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// MongoLeaseRepository is a LeaseRepository storing one document per lease.
+type MongoLeaseRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoLeaseRepository returns a LeaseRepository that stores leases in the given collection.
+func NewMongoLeaseRepository(database *mongo.Database, collection string) *MongoLeaseRepository {
+	return &MongoLeaseRepository{
+		collection: database.Collection(collection),
+	}
+}
+
+func (r *MongoLeaseRepository) TryAcquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	// Matches only a lease we already own or one that has expired. If another holder
+	// owns a live lease the upsert tries to insert a second document with the same
+	// _id and fails with a duplicate key error.
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"holder": holder},
+			bson.M{"expiresAt": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"holder": holder, "expiresAt": now.Add(ttl)}}
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *MongoLeaseRepository) Release(ctx context.Context, name, holder string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": name, "holder": holder})
+	return err
+}
@@ -0,0 +1,912 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryUserRepository is a thread-safe in-memory UserRepository.
+// It is intended for tests and local development without a database.
+type MemoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[string]db.AuthUser // keyed by email
+}
+
+// NewMemoryUserRepository returns an empty in-memory UserRepository.
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users: make(map[string]db.AuthUser),
+	}
+}
+
+func (r *MemoryUserRepository) FindByEmail(_ context.Context, email string) (*db.AuthUser, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[email]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) FindByID(_ context.Context, id primitive.ObjectID) (*db.AuthUser, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.ID == id {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryUserRepository) Search(_ context.Context, query string, limit int) ([]db.AuthUser, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	var users []db.AuthUser
+	for _, user := range r.users {
+		if strings.Contains(strings.ToLower(user.Email), query) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Email < users[j].Email
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (r *MemoryUserRepository) Create(_ context.Context, email, code string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.users[email] = db.AuthUser{
+		ID:        primitive.NewObjectID(),
+		Email:     email,
+		Code:      code,
+		CreatedAt: time.Now(),
+	}
+	return nil
+}
+
+func (r *MemoryUserRepository) SetEmailVerified(_ context.Context, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[email]
+	if !ok {
+		return nil
+	}
+	user.EmailVerified = true
+	r.users[email] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) SetAttemptCount(_ context.Context, email string, count int, lastAttemptTime time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[email]
+	if !ok {
+		return nil
+	}
+	user.AttemptCount = count
+	user.LastAttemptTime = lastAttemptTime
+	r.users[email] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) CountAttempt(_ context.Context, email string, max int, lockout time.Duration, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[email]
+	if !ok || (user.AttemptCount >= max && user.LastAttemptTime.After(now.Add(-lockout))) {
+		return ErrTooManyAttempts
+	}
+	user.AttemptCount++
+	user.LastAttemptTime = now
+	r.users[email] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) SetStatus(_ context.Context, email, status, reason string, changedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[email]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Status = status
+	user.StatusReason = reason
+	user.StatusChangedAt = changedAt
+	user.DeletionScheduledAt = time.Time{}
+	user.DeletionCancelHash = ""
+	r.users[email] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) ScheduleDeletion(_ context.Context, email, reason, cancelHash string, requestedAt, deleteAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[email]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Status = db.StatusPendingDeletion
+	user.StatusReason = reason
+	user.StatusChangedAt = requestedAt
+	user.DeletionScheduledAt = deleteAt
+	user.DeletionCancelHash = cancelHash
+	user.Code = ""
+	user.AttemptCount = 0
+	r.users[email] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) FindDueForDeletion(_ context.Context, now time.Time, limit int) ([]db.AuthUser, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []db.AuthUser
+	for _, user := range r.users {
+		if user.Status == db.StatusPendingDeletion && !user.DeletionScheduledAt.After(now) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].DeletionScheduledAt.Before(users[j].DeletionScheduledAt)
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (r *MemoryUserRepository) SetCode(_ context.Context, email, code string, sentAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[email]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Code = code
+	user.CodeSentAt = sentAt
+	user.AttemptCount = 0
+	r.users[email] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) SetPassword(_ context.Context, email, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[email]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = passwordHash
+	r.users[email] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) SetRoles(_ context.Context, email string, roles, permissions []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[email]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Roles = append([]string(nil), roles...)
+	user.Permissions = append([]string(nil), permissions...)
+	r.users[email] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) Delete(_ context.Context, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[email]; !ok {
+		return ErrNotFound
+	}
+	delete(r.users, email)
+	return nil
+}
+
+// MemoryTokenRepository is a thread-safe in-memory TokenRepository.
+// It is intended for tests and local development without a database.
+type MemoryTokenRepository struct {
+	mu     sync.RWMutex
+	tokens map[string]db.AuthToken // keyed by token value
+}
+
+// NewMemoryTokenRepository returns an empty in-memory TokenRepository.
+func NewMemoryTokenRepository() *MemoryTokenRepository {
+	return &MemoryTokenRepository{
+		tokens: make(map[string]db.AuthToken),
+	}
+}
+
+func (r *MemoryTokenRepository) Save(_ context.Context, token db.AuthToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens[token.Token] = token
+	return nil
+}
+
+func (r *MemoryTokenRepository) FindByToken(_ context.Context, token string) (*db.AuthToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	existing, ok := r.tokens[token]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &existing, nil
+}
+
+func (r *MemoryTokenRepository) Rotate(_ context.Context, oldToken, newToken string, createdAt, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.tokens[oldToken]
+	if !ok || !existing.IsActive || !existing.ExpiresAt.After(createdAt) {
+		return ErrNotFound
+	}
+	delete(r.tokens, oldToken)
+	existing.Token = newToken
+	existing.CreatedAt = createdAt
+	existing.ExpiresAt = expiresAt
+	r.tokens[newToken] = existing
+	return nil
+}
+
+func (r *MemoryTokenRepository) CountActive(_ context.Context, now time.Time) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var n int64
+	for _, token := range r.tokens {
+		if token.IsActive && !token.ExpiresAt.Before(now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryTokenRepository) FindActiveByUser(_ context.Context, userID primitive.ObjectID, now time.Time) ([]db.AuthToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tokens []db.AuthToken
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.IsActive && !token.ExpiresAt.Before(now) {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (r *MemoryTokenRepository) RevokeByUser(_ context.Context, userID primitive.ObjectID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	for key, token := range r.tokens {
+		if token.UserID == userID && token.IsActive {
+			token.IsActive = false
+			r.tokens[key] = token
+			n++
+		}
+	}
+	return n, nil
+}
+
+// MemoryVerificationRepository is a VerificationRepository operating on the in-memory repositories.
+type MemoryVerificationRepository struct {
+	users  *MemoryUserRepository
+	tokens *MemoryTokenRepository
+}
+
+// NewMemoryVerificationRepository returns a VerificationRepository operating on the given repositories.
+func NewMemoryVerificationRepository(users *MemoryUserRepository, tokens *MemoryTokenRepository) *MemoryVerificationRepository {
+	return &MemoryVerificationRepository{
+		users:  users,
+		tokens: tokens,
+	}
+}
+
+func (r *MemoryVerificationRepository) CompleteVerification(_ context.Context, email, code string, token db.AuthToken) error {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	r.tokens.mu.Lock()
+	defer r.tokens.mu.Unlock()
+
+	user, ok := r.users.users[email]
+	if !ok || user.EmailVerified || user.Code == "" || user.Code != code {
+		return ErrCodeConsumed
+	}
+	user.Code = ""
+	user.EmailVerified = true
+	user.AttemptCount = 0
+	user.LastAttemptTime = time.Time{}
+	r.users.users[email] = user
+	r.tokens.tokens[token.Token] = token
+	return nil
+}
+
+// MemoryMaintenanceRepository is a MaintenanceRepository operating on the in-memory repositories.
+// Device records are not kept in memory, so CompactDevices never removes anything.
+type MemoryMaintenanceRepository struct {
+	users          *MemoryUserRepository
+	tokens         *MemoryTokenRepository
+	audit          *MemoryAuditRepository
+	authorizations *MemoryAuthorizationRepository
+	clients        *MemoryClientRepository
+	consents       *MemoryConsentRepository
+}
+
+// NewMemoryMaintenanceRepository returns a MaintenanceRepository operating on the given repositories.
+func NewMemoryMaintenanceRepository(users *MemoryUserRepository, tokens *MemoryTokenRepository, audit *MemoryAuditRepository, authorizations *MemoryAuthorizationRepository, clients *MemoryClientRepository, consents *MemoryConsentRepository) *MemoryMaintenanceRepository {
+	return &MemoryMaintenanceRepository{
+		users:          users,
+		tokens:         tokens,
+		audit:          audit,
+		authorizations: authorizations,
+		clients:        clients,
+		consents:       consents,
+	}
+}
+
+func (r *MemoryMaintenanceRepository) PurgeTokens(_ context.Context, now time.Time, dryRun bool) (int64, error) {
+	r.tokens.mu.Lock()
+	defer r.tokens.mu.Unlock()
+
+	var n int64
+	for key, token := range r.tokens.tokens {
+		if token.ExpiresAt.Before(now) || !token.IsActive {
+			n++
+			if !dryRun {
+				delete(r.tokens.tokens, key)
+			}
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryMaintenanceRepository) PurgeUnverifiedUsers(_ context.Context, createdBefore time.Time, dryRun bool) (int64, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+
+	var n int64
+	for email, user := range r.users.users {
+		if !user.EmailVerified && user.CreatedAt.Before(createdBefore) {
+			n++
+			if !dryRun {
+				delete(r.users.users, email)
+			}
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryMaintenanceRepository) CompactDevices(context.Context, bool) (int64, error) {
+	return 0, nil
+}
+
+func (r *MemoryMaintenanceRepository) PurgeAuditRecords(_ context.Context, createdBefore time.Time, dryRun bool) (int64, error) {
+	r.audit.mu.Lock()
+	defer r.audit.mu.Unlock()
+
+	kept := r.audit.records[:0]
+	var n int64
+	for _, record := range r.audit.records {
+		if record.CreatedAt.Before(createdBefore) {
+			n++
+			if !dryRun {
+				continue
+			}
+		}
+		kept = append(kept, record)
+	}
+	r.audit.records = kept
+	return n, nil
+}
+
+func (r *MemoryMaintenanceRepository) PurgeAuthorizations(_ context.Context, now time.Time, dryRun bool) (int64, error) {
+	r.authorizations.mu.Lock()
+	defer r.authorizations.mu.Unlock()
+
+	var n int64
+	for id, authorization := range r.authorizations.authorizations {
+		if authorization.ExpiresAt.Before(now) {
+			n++
+			if !dryRun {
+				delete(r.authorizations.authorizations, id)
+			}
+		}
+	}
+
+	r.clients.mu.Lock()
+	defer r.clients.mu.Unlock()
+	for key, expiresAt := range r.clients.assertions {
+		if expiresAt.Before(now) {
+			n++
+			if !dryRun {
+				delete(r.clients.assertions, key)
+			}
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryMaintenanceRepository) PurgeUser(_ context.Context, userID primitive.ObjectID, email string) error {
+	r.tokens.mu.Lock()
+	for key, token := range r.tokens.tokens {
+		if token.UserID == userID {
+			delete(r.tokens.tokens, key)
+		}
+	}
+	r.tokens.mu.Unlock()
+
+	r.consents.mu.Lock()
+	for key, consent := range r.consents.consents {
+		if consent.UserID == userID {
+			delete(r.consents.consents, key)
+		}
+	}
+	r.consents.mu.Unlock()
+
+	r.authorizations.mu.Lock()
+	for id, authorization := range r.authorizations.authorizations {
+		if authorization.UserID == userID || authorization.Email == email {
+			delete(r.authorizations.authorizations, id)
+		}
+	}
+	r.authorizations.mu.Unlock()
+
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	for key, user := range r.users.users {
+		if user.ID == userID {
+			delete(r.users.users, key)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryMaintenanceRepository) AnonymiseAuditRecords(_ context.Context, userID, email, pseudonym string) (int64, error) {
+	r.audit.mu.Lock()
+	defer r.audit.mu.Unlock()
+
+	var n int64
+	for i := range r.audit.records {
+		record := &r.audit.records[i]
+		if record.UserID == userID || record.Email == email {
+			record.UserID = pseudonym
+			record.Email, record.IP, record.UserAgent = "", "", ""
+			n++
+		}
+		// The user is also the actor of its own actions and, as an administrator, of the
+		// actions recorded by the admin API
+		switch record.ActorID {
+		case userID, email, "user:" + userID:
+			record.ActorID = pseudonym
+		}
+	}
+	return n, nil
+}
+
+// MemoryLeaseRepository is a thread-safe in-memory LeaseRepository.
+type MemoryLeaseRepository struct {
+	mu     sync.Mutex
+	leases map[string]memoryLease
+}
+
+type memoryLease struct {
+	holder    string
+	expiresAt time.Time
+}
+
+// NewMemoryLeaseRepository returns an empty in-memory LeaseRepository.
+func NewMemoryLeaseRepository() *MemoryLeaseRepository {
+	return &MemoryLeaseRepository{
+		leases: make(map[string]memoryLease),
+	}
+}
+
+func (r *MemoryLeaseRepository) TryAcquire(_ context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if lease, ok := r.leases[name]; ok && lease.holder != holder && lease.expiresAt.After(now) {
+		return false, nil
+	}
+	r.leases[name] = memoryLease{holder: holder, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (r *MemoryLeaseRepository) Release(_ context.Context, name, holder string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if lease, ok := r.leases[name]; ok && lease.holder == holder {
+		delete(r.leases, name)
+	}
+	return nil
+}
+
+// MemoryAuditRepository is a thread-safe in-memory AuditRepository.
+type MemoryAuditRepository struct {
+	mu      sync.Mutex
+	records []db.AuditRecord
+}
+
+// NewMemoryAuditRepository returns an empty in-memory AuditRepository.
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+func (r *MemoryAuditRepository) Append(_ context.Context, record db.AuditRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if record.ID.IsZero() {
+		record.ID = primitive.NewObjectID()
+	}
+	r.records = append(r.records, record)
+	return nil
+}
+
+func (r *MemoryAuditRepository) Find(_ context.Context, filter AuditFilter, fn func(db.AuditRecord) error) error {
+	// Matching records are copied first so that fn may call back into the repository.
+	r.mu.Lock()
+	var matched []db.AuditRecord
+	for _, record := range r.records {
+		if filter.UserID != "" && record.UserID != filter.UserID ||
+			filter.Email != "" && record.Email != filter.Email ||
+			!filter.From.IsZero() && record.CreatedAt.Before(filter.From) ||
+			!filter.To.IsZero() && !record.CreatedAt.Before(filter.To) {
+			continue
+		}
+		matched = append(matched, record)
+	}
+	r.mu.Unlock()
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.Before(matched[j].CreatedAt)
+	})
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	for _, record := range matched {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryKeyRepository is a thread-safe in-memory KeyRepository.
+type MemoryKeyRepository struct {
+	mu   sync.Mutex
+	keys []db.SigningKey
+}
+
+// NewMemoryKeyRepository returns an empty in-memory KeyRepository.
+func NewMemoryKeyRepository() *MemoryKeyRepository {
+	return &MemoryKeyRepository{}
+}
+
+func (r *MemoryKeyRepository) Create(_ context.Context, key db.SigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+func (r *MemoryKeyRepository) List(context.Context) ([]db.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]db.SigningKey, len(r.keys))
+	copy(keys, r.keys)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (r *MemoryKeyRepository) Retire(_ context.Context, kid string, retiredAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.keys {
+		if r.keys[i].ID == kid {
+			r.keys[i].RetiredAt = retiredAt
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// MemoryClientRepository is a thread-safe in-memory ClientRepository.
+type MemoryClientRepository struct {
+	mu         sync.RWMutex
+	clients    map[string]db.OAuthClient
+	assertions map[string]time.Time // expiry of used assertions, keyed by client ID and jti
+}
+
+// NewMemoryClientRepository returns an empty in-memory ClientRepository.
+func NewMemoryClientRepository() *MemoryClientRepository {
+	return &MemoryClientRepository{
+		clients:    make(map[string]db.OAuthClient),
+		assertions: make(map[string]time.Time),
+	}
+}
+
+func (r *MemoryClientRepository) Create(_ context.Context, client db.OAuthClient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clients[client.ID] = client
+	return nil
+}
+
+func (r *MemoryClientRepository) FindByID(_ context.Context, id string) (*db.OAuthClient, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	client, ok := r.clients[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &client, nil
+}
+
+func (r *MemoryClientRepository) List(context.Context) ([]db.OAuthClient, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clients := make([]db.OAuthClient, 0, len(r.clients))
+	for _, client := range r.clients {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+	})
+	return clients, nil
+}
+
+func (r *MemoryClientRepository) Delete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.clients[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.clients, id)
+	return nil
+}
+
+func (r *MemoryClientRepository) UseAssertion(_ context.Context, clientID, jti string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := clientID + ":" + jti
+	if _, ok := r.assertions[key]; ok {
+		return ErrAssertionReplayed
+	}
+	r.assertions[key] = expiresAt
+	return nil
+}
+
+// MemoryAuthorizationRepository is a thread-safe in-memory AuthorizationRepository.
+type MemoryAuthorizationRepository struct {
+	mu             sync.Mutex
+	authorizations map[string]db.OAuthAuthorization
+}
+
+// NewMemoryAuthorizationRepository returns an empty in-memory AuthorizationRepository.
+func NewMemoryAuthorizationRepository() *MemoryAuthorizationRepository {
+	return &MemoryAuthorizationRepository{
+		authorizations: make(map[string]db.OAuthAuthorization),
+	}
+}
+
+func (r *MemoryAuthorizationRepository) Create(_ context.Context, authorization db.OAuthAuthorization) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.authorizations[authorization.ID] = authorization
+	return nil
+}
+
+func (r *MemoryAuthorizationRepository) Find(_ context.Context, id string) (*db.OAuthAuthorization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	authorization, ok := r.authorizations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &authorization, nil
+}
+
+func (r *MemoryAuthorizationRepository) SetLogin(_ context.Context, id, email, loginCode string) error {
+	return r.update(id, func(a *db.OAuthAuthorization) {
+		a.Email = email
+		a.LoginCode = loginCode
+		a.UserID = primitive.NilObjectID
+	})
+}
+
+func (r *MemoryAuthorizationRepository) CountAttempt(_ context.Context, id string, max int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	authorization, ok := r.authorizations[id]
+	if !ok || authorization.AttemptCount >= max {
+		return ErrTooManyAttempts
+	}
+	authorization.AttemptCount++
+	r.authorizations[id] = authorization
+	return nil
+}
+
+func (r *MemoryAuthorizationRepository) SetUser(_ context.Context, id string, userID primitive.ObjectID, authTime time.Time) error {
+	return r.update(id, func(a *db.OAuthAuthorization) {
+		a.UserID = userID
+		a.AuthTime = authTime
+		a.LoginCode = ""
+	})
+}
+
+func (r *MemoryAuthorizationRepository) update(id string, fn func(*db.OAuthAuthorization)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	authorization, ok := r.authorizations[id]
+	if !ok {
+		return ErrNotFound
+	}
+	fn(&authorization)
+	r.authorizations[id] = authorization
+	return nil
+}
+
+func (r *MemoryAuthorizationRepository) IssueCode(_ context.Context, id, codeHash string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	authorization, ok := r.authorizations[id]
+	if !ok || authorization.Consumed {
+		return ErrCodeConsumed
+	}
+	authorization.CodeHash = codeHash
+	authorization.CodeExpiresAt = expiresAt
+	r.authorizations[id] = authorization
+	return nil
+}
+
+func (r *MemoryAuthorizationRepository) ConsumeCode(_ context.Context, codeHash string, now time.Time) (*db.OAuthAuthorization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, authorization := range r.authorizations {
+		if authorization.CodeHash != codeHash || authorization.Consumed || !authorization.CodeExpiresAt.After(now) {
+			continue
+		}
+		authorization.Consumed = true
+		r.authorizations[id] = authorization
+		return &authorization, nil
+	}
+	return nil, ErrCodeConsumed
+}
+
+// MemoryConsentRepository is a thread-safe in-memory ConsentRepository.
+type MemoryConsentRepository struct {
+	mu       sync.Mutex
+	consents map[string]db.OAuthConsent // keyed by user ID and client ID
+}
+
+// NewMemoryConsentRepository returns an empty in-memory ConsentRepository.
+func NewMemoryConsentRepository() *MemoryConsentRepository {
+	return &MemoryConsentRepository{
+		consents: make(map[string]db.OAuthConsent),
+	}
+}
+
+func (r *MemoryConsentRepository) Find(_ context.Context, userID primitive.ObjectID, clientID string) (*db.OAuthConsent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	consent, ok := r.consents[userID.Hex()+"/"+clientID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	consent.Scopes = append([]string(nil), consent.Scopes...)
+	return &consent, nil
+}
+
+func (r *MemoryConsentRepository) Grant(_ context.Context, userID primitive.ObjectID, clientID string, scopes []string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := userID.Hex() + "/" + clientID
+	consent, ok := r.consents[key]
+	if !ok {
+		consent = db.OAuthConsent{UserID: userID, ClientID: clientID, GrantedAt: now}
+	}
+	granted := append([]string(nil), consent.Scopes...)
+	for _, scope := range scopes {
+		if !containsString(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	consent.Scopes = granted
+	consent.UpdatedAt = now
+	r.consents[key] = consent
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// NewMemoryStore returns a Store backed by empty in-memory repositories.
+func NewMemoryStore() *Store {
+	users := NewMemoryUserRepository()
+	tokens := NewMemoryTokenRepository()
+	audit := NewMemoryAuditRepository()
+	authorizations := NewMemoryAuthorizationRepository()
+	clients := NewMemoryClientRepository()
+	consents := NewMemoryConsentRepository()
+	return &Store{
+		Pinger:         memoryPinger{},
+		Users:          users,
+		Tokens:         tokens,
+		Verifications:  NewMemoryVerificationRepository(users, tokens),
+		Maintenance:    NewMemoryMaintenanceRepository(users, tokens, audit, authorizations, clients, consents),
+		Leases:         NewMemoryLeaseRepository(),
+		Audit:          audit,
+		Keys:           NewMemoryKeyRepository(),
+		Clients:        clients,
+		Authorizations: authorizations,
+		Consents:       consents,
+	}
+}
+
+type memoryPinger struct{}
+
+func (memoryPinger) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoClientRepository is a ClientRepository backed by a MongoDB collection.
+type MongoClientRepository struct {
+	collection *mongo.Collection
+	assertions *mongo.Collection
+}
+
+// NewMongoClientRepository returns a ClientRepository that stores OAuth clients in
+// the given collection and used client assertions in the assertions collection.
+func NewMongoClientRepository(database *mongo.Database, collection, assertions string) *MongoClientRepository {
+	return &MongoClientRepository{
+		collection: database.Collection(collection),
+		assertions: database.Collection(assertions),
+	}
+}
+
+func (r *MongoClientRepository) Create(ctx context.Context, client db.OAuthClient) error {
+	_, err := r.collection.InsertOne(ctx, client)
+	return err
+}
+
+func (r *MongoClientRepository) FindByID(ctx context.Context, id string) (*db.OAuthClient, error) {
+	var client db.OAuthClient
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&client)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *MongoClientRepository) List(ctx context.Context) ([]db.OAuthClient, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var clients []db.OAuthClient
+	if err := cursor.All(ctx, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *MongoClientRepository) Delete(ctx context.Context, id string) error {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoClientRepository) UseAssertion(ctx context.Context, clientID, jti string, expiresAt time.Time) error {
+	// The _id is unique, so a replayed assertion fails to insert
+	_, err := r.assertions.InsertOne(ctx, db.OAuthClientAssertion{
+		ID:        clientID + ":" + jti,
+		ClientID:  clientID,
+		JTI:       jti,
+		ExpiresAt: expiresAt,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAssertionReplayed
+	}
+	return err
+}
+
+// MongoAuthorizationRepository is an AuthorizationRepository backed by a MongoDB collection.
+type MongoAuthorizationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAuthorizationRepository returns an AuthorizationRepository that stores
+// authorization requests in the given collection.
+func NewMongoAuthorizationRepository(database *mongo.Database, collection string) *MongoAuthorizationRepository {
+	return &MongoAuthorizationRepository{
+		collection: database.Collection(collection),
+	}
+}
+
+func (r *MongoAuthorizationRepository) Create(ctx context.Context, authorization db.OAuthAuthorization) error {
+	_, err := r.collection.InsertOne(ctx, authorization)
+	return err
+}
+
+func (r *MongoAuthorizationRepository) Find(ctx context.Context, id string) (*db.OAuthAuthorization, error) {
+	var authorization db.OAuthAuthorization
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&authorization)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &authorization, nil
+}
+
+func (r *MongoAuthorizationRepository) SetLogin(ctx context.Context, id, email, loginCode string) error {
+	return r.update(ctx, id, bson.M{
+		"email":     email,
+		"loginCode": loginCode,
+		"userId":    primitive.NilObjectID,
+	})
+}
+
+func (r *MongoAuthorizationRepository) CountAttempt(ctx context.Context, id string, max int) error {
+	// Счетчик увеличивается только если лимит еще не исчерпан
+	res, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "attemptCount": bson.M{"$lt": max}},
+		bson.M{"$inc": bson.M{"attemptCount": 1}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+func (r *MongoAuthorizationRepository) SetUser(ctx context.Context, id string, userID primitive.ObjectID, authTime time.Time) error {
+	return r.update(ctx, id, bson.M{"userId": userID, "authTime": authTime, "loginCode": ""})
+}
+
+func (r *MongoAuthorizationRepository) update(ctx context.Context, id string, set bson.M) error {
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoAuthorizationRepository) IssueCode(ctx context.Context, id, codeHash string, expiresAt time.Time) error {
+	filter := bson.M{"_id": id, "consumed": false}
+	update := bson.M{"$set": bson.M{"codeHash": codeHash, "codeExpiresAt": expiresAt}}
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrCodeConsumed
+	}
+	return nil
+}
+
+func (r *MongoAuthorizationRepository) ConsumeCode(ctx context.Context, codeHash string, now time.Time) (*db.OAuthAuthorization, error) {
+	// The filter and the update are applied atomically, so of two concurrent
+	// exchanges of the same code only one matches.
+	filter := bson.M{
+		"codeHash":      codeHash,
+		"consumed":      false,
+		"codeExpiresAt": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"consumed": true}}
+
+	var authorization db.OAuthAuthorization
+	err := r.collection.FindOneAndUpdate(ctx, filter, update).Decode(&authorization)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrCodeConsumed
+	}
+	if err != nil {
+		return nil, err
+	}
+	authorization.Consumed = true
+	return &authorization, nil
+}
+
+// MongoConsentRepository is a ConsentRepository backed by a MongoDB collection
+// holding one document per user and client.
+type MongoConsentRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoConsentRepository returns a ConsentRepository that stores consents in the given collection.
+func NewMongoConsentRepository(database *mongo.Database, collection string) *MongoConsentRepository {
+	return &MongoConsentRepository{
+		collection: database.Collection(collection),
+	}
+}
+
+func (r *MongoConsentRepository) Find(ctx context.Context, userID primitive.ObjectID, clientID string) (*db.OAuthConsent, error) {
+	var consent db.OAuthConsent
+	err := r.collection.FindOne(ctx, bson.M{"userId": userID, "clientId": clientID}).Decode(&consent)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (r *MongoConsentRepository) Grant(ctx context.Context, userID primitive.ObjectID, clientID string, scopes []string, now time.Time) error {
+	filter := bson.M{"userId": userID, "clientId": clientID}
+	update := bson.M{
+		"$addToSet":    bson.M{"scopes": bson.M{"$each": scopes}},
+		"$set":         bson.M{"updatedAt": now},
+		"$setOnInsert": bson.M{"grantedAt": now},
+	}
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
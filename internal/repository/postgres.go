@@ -0,0 +1,929 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PostgresUserRepository is a UserRepository backed by the auth_users table.
+type PostgresUserRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresUserRepository returns a UserRepository operating on the given connection pool.
+func NewPostgresUserRepository(db *sql.DB) *PostgresUserRepository {
+	return &PostgresUserRepository{db: db}
+}
+
+const selectUserColumns = `SELECT id, email, code, email_verified, attempt_count, last_attempt_time, password, created_at,
+	status, status_reason, status_changed_at, roles, permissions, code_sent_at, deletion_scheduled_at, deletion_cancel_hash FROM auth_users`
+
+func (r *PostgresUserRepository) FindByEmail(ctx context.Context, email string) (*db.AuthUser, error) {
+	row := r.db.QueryRowContext(ctx, selectUserColumns+` WHERE email = $1`, email)
+	return scanUser(row)
+}
+
+func (r *PostgresUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*db.AuthUser, error) {
+	row := r.db.QueryRowContext(ctx, selectUserColumns+` WHERE id = $1`, id.Hex())
+	return scanUser(row)
+}
+
+func (r *PostgresUserRepository) Search(ctx context.Context, query string, limit int) ([]db.AuthUser, error) {
+	rows, err := r.db.QueryContext(ctx,
+		selectUserColumns+` WHERE strpos(lower(email), lower($1)) > 0 ORDER BY email LIMIT $2`, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []db.AuthUser
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (r *PostgresUserRepository) Create(ctx context.Context, email, code string) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO auth_users (id, email, code) VALUES ($1, $2, $3)`,
+		primitive.NewObjectID().Hex(), email, code)
+	return err
+}
+
+func (r *PostgresUserRepository) SetEmailVerified(ctx context.Context, email string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE auth_users SET email_verified = TRUE WHERE email = $1`, email)
+	return err
+}
+
+func (r *PostgresUserRepository) SetAttemptCount(ctx context.Context, email string, count int, lastAttemptTime time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE auth_users SET attempt_count = $2, last_attempt_time = $3 WHERE email = $1`,
+		email, count, lastAttemptTime)
+	return err
+}
+
+func (r *PostgresUserRepository) CountAttempt(ctx context.Context, email string, max int, lockout time.Duration, now time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE auth_users SET attempt_count = attempt_count + 1, last_attempt_time = $3
+			WHERE email = $1 AND (attempt_count < $2 OR last_attempt_time <= $4)`,
+		email, max, now, now.Add(-lockout))
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res); errors.Is(err, ErrNotFound) {
+		return ErrTooManyAttempts
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) SetCode(ctx context.Context, email, code string, sentAt time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE auth_users SET code = $2, code_sent_at = $3, attempt_count = 0 WHERE email = $1`, email, code, sentAt)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (r *PostgresUserRepository) SetPassword(ctx context.Context, email, passwordHash string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE auth_users SET password = $2 WHERE email = $1`, email, passwordHash)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (r *PostgresUserRepository) SetStatus(ctx context.Context, email, status, reason string, changedAt time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE auth_users SET status = $2, status_reason = $3, status_changed_at = $4,
+			deletion_scheduled_at = NULL, deletion_cancel_hash = '' WHERE email = $1`,
+		email, status, reason, changedAt)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (r *PostgresUserRepository) ScheduleDeletion(ctx context.Context, email, reason, cancelHash string, requestedAt, deleteAt time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE auth_users SET status = $2, status_reason = $3, status_changed_at = $4,
+			deletion_scheduled_at = $5, deletion_cancel_hash = $6, code = '', attempt_count = 0 WHERE email = $1`,
+		email, db.StatusPendingDeletion, reason, requestedAt, deleteAt, cancelHash)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (r *PostgresUserRepository) FindDueForDeletion(ctx context.Context, now time.Time, limit int) ([]db.AuthUser, error) {
+	rows, err := r.db.QueryContext(ctx,
+		selectUserColumns+` WHERE status = $1 AND deletion_scheduled_at <= $2 ORDER BY deletion_scheduled_at LIMIT $3`,
+		db.StatusPendingDeletion, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []db.AuthUser
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (r *PostgresUserRepository) SetRoles(ctx context.Context, email string, roles, permissions []string) error {
+	rolesJSON, err := json.Marshal(nonNil(roles))
+	if err != nil {
+		return err
+	}
+	permissionsJSON, err := json.Marshal(nonNil(permissions))
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE auth_users SET roles = $2, permissions = $3 WHERE email = $1`, email, rolesJSON, permissionsJSON)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (r *PostgresUserRepository) Delete(ctx context.Context, email string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM auth_users WHERE email = $1`, email)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// PostgresTokenRepository is a TokenRepository backed by the auth_tokens table.
+type PostgresTokenRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresTokenRepository returns a TokenRepository operating on the given connection pool.
+func NewPostgresTokenRepository(db *sql.DB) *PostgresTokenRepository {
+	return &PostgresTokenRepository{db: db}
+}
+
+func (r *PostgresTokenRepository) Save(ctx context.Context, token db.AuthToken) error {
+	return insertToken(ctx, r.db, token)
+}
+
+func (r *PostgresTokenRepository) FindByToken(ctx context.Context, token string) (*db.AuthToken, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT user_id, device_info_id, token, created_at, expires_at, is_active FROM auth_tokens WHERE token = $1`,
+		token)
+
+	var userID, deviceInfoID string
+	var existing db.AuthToken
+	err := row.Scan(&userID, &deviceInfoID, &existing.Token, &existing.CreatedAt, &existing.ExpiresAt, &existing.IsActive)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if existing.UserID, err = primitive.ObjectIDFromHex(userID); err != nil {
+		return nil, err
+	}
+	if existing.DeviceInfoID, err = primitive.ObjectIDFromHex(deviceInfoID); err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (r *PostgresTokenRepository) Rotate(ctx context.Context, oldToken, newToken string, createdAt, expiresAt time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE auth_tokens SET token = $2, created_at = $3, expires_at = $4
+		WHERE token = $1 AND is_active AND expires_at > $3`,
+		oldToken, newToken, createdAt, expiresAt)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (r *PostgresTokenRepository) CountActive(ctx context.Context, now time.Time) (int64, error) {
+	var n int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT count(*) FROM auth_tokens WHERE is_active AND expires_at >= $1`, now).Scan(&n)
+	return n, err
+}
+
+func (r *PostgresTokenRepository) FindActiveByUser(ctx context.Context, userID primitive.ObjectID, now time.Time) ([]db.AuthToken, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT device_info_id, token, created_at, expires_at FROM auth_tokens
+		WHERE user_id = $1 AND is_active AND expires_at >= $2 ORDER BY created_at DESC`, userID.Hex(), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []db.AuthToken
+	for rows.Next() {
+		token := db.AuthToken{UserID: userID, IsActive: true}
+		var deviceInfoID string
+		if err := rows.Scan(&deviceInfoID, &token.Token, &token.CreatedAt, &token.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if token.DeviceInfoID, err = primitive.ObjectIDFromHex(deviceInfoID); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *PostgresTokenRepository) RevokeByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE auth_tokens SET is_active = FALSE WHERE user_id = $1 AND is_active`, userID.Hex())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// PostgresVerificationRepository is a VerificationRepository that completes
+// the verification inside a single PostgreSQL transaction.
+type PostgresVerificationRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresVerificationRepository returns a VerificationRepository operating on the given connection pool.
+func NewPostgresVerificationRepository(db *sql.DB) *PostgresVerificationRepository {
+	return &PostgresVerificationRepository{db: db}
+}
+
+func (r *PostgresVerificationRepository) CompleteVerification(ctx context.Context, email, code string, token db.AuthToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The row lock taken by the conditional update serialises concurrent submissions
+	// of the same code: only the first one matches, the others affect no rows.
+	res, err := tx.ExecContext(ctx,
+		`UPDATE auth_users SET email_verified = TRUE, code = '', attempt_count = 0, last_attempt_time = $3
+		 WHERE email = $1 AND code = $2 AND code <> '' AND NOT email_verified`,
+		email, code, time.Time{})
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res); errors.Is(err, ErrNotFound) {
+		return ErrCodeConsumed
+	} else if err != nil {
+		return err
+	}
+	if err := insertToken(ctx, tx, token); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PostgresMaintenanceRepository is a MaintenanceRepository backed by PostgreSQL.
+type PostgresMaintenanceRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresMaintenanceRepository returns a MaintenanceRepository operating on the given connection pool.
+func NewPostgresMaintenanceRepository(db *sql.DB) *PostgresMaintenanceRepository {
+	return &PostgresMaintenanceRepository{db: db}
+}
+
+func (r *PostgresMaintenanceRepository) PurgeTokens(ctx context.Context, now time.Time, dryRun bool) (int64, error) {
+	return r.deleteOrCount(ctx, `auth_tokens WHERE expires_at < $1 OR NOT is_active`, dryRun, now)
+}
+
+func (r *PostgresMaintenanceRepository) PurgeUnverifiedUsers(ctx context.Context, createdBefore time.Time, dryRun bool) (int64, error) {
+	return r.deleteOrCount(ctx, `auth_users WHERE created_at < $1 AND NOT email_verified`, dryRun, createdBefore)
+}
+
+func (r *PostgresMaintenanceRepository) CompactDevices(ctx context.Context, dryRun bool) (int64, error) {
+	return r.deleteOrCount(ctx,
+		`auth_devices d WHERE NOT EXISTS (SELECT 1 FROM auth_tokens t WHERE t.device_info_id = d.id AND t.is_active)`,
+		dryRun)
+}
+
+func (r *PostgresMaintenanceRepository) PurgeAuditRecords(ctx context.Context, createdBefore time.Time, dryRun bool) (int64, error) {
+	return r.deleteOrCount(ctx, `auth_audit WHERE created_at < $1`, dryRun, createdBefore)
+}
+
+func (r *PostgresMaintenanceRepository) PurgeAuthorizations(ctx context.Context, now time.Time, dryRun bool) (int64, error) {
+	authorizations, err := r.deleteOrCount(ctx, `oauth_authorizations WHERE expires_at < $1`, dryRun, now)
+	if err != nil {
+		return authorizations, err
+	}
+	assertions, err := r.deleteOrCount(ctx, `oauth_client_assertions WHERE expires_at < $1`, dryRun, now)
+	return authorizations + assertions, err
+}
+
+func (r *PostgresMaintenanceRepository) PurgeUser(ctx context.Context, userID primitive.ObjectID, email string) error {
+	// Refresh tokens, devices, consents and authorization requests of the user are
+	// removed by ON DELETE CASCADE; requests that never got past the login code
+	// reference the user only by email
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oauth_authorizations WHERE email = $1`, email); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM auth_users WHERE id = $1`, userID.Hex()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresMaintenanceRepository) AnonymiseAuditRecords(ctx context.Context, userID, email, pseudonym string) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE auth_audit SET user_id = $3, email = '', ip = '', user_agent = '' WHERE user_id = $1 OR email = $2`,
+		userID, email, pseudonym)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	// The user is also the actor of its own actions and, as an administrator, of the
+	// actions recorded by the admin API
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE auth_audit SET actor_id = $4 WHERE actor_id IN ($1, $2, $3)`,
+		userID, email, "user:"+userID, pseudonym); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// deleteOrCount runs DELETE FROM or SELECT count(*) FROM the given table and condition.
+func (r *PostgresMaintenanceRepository) deleteOrCount(ctx context.Context, from string, dryRun bool, args ...any) (int64, error) {
+	if dryRun {
+		var n int64
+		err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM `+from, args...).Scan(&n)
+		return n, err
+	}
+	res, err := r.db.ExecContext(ctx, `DELETE FROM `+from, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// PostgresLeaseRepository is a LeaseRepository backed by the leases table.
+type PostgresLeaseRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresLeaseRepository returns a LeaseRepository operating on the given connection pool.
+func NewPostgresLeaseRepository(db *sql.DB) *PostgresLeaseRepository {
+	return &PostgresLeaseRepository{db: db}
+}
+
+func (r *PostgresLeaseRepository) TryAcquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	// The conflicting row is only updated when we own it or it has expired;
+	// otherwise no row is returned.
+	var owner string
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO leases (name, holder, expires_at) VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+		ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE leases.holder = EXCLUDED.holder OR leases.expires_at < now()
+		RETURNING holder`,
+		name, holder, ttl.Milliseconds()).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *PostgresLeaseRepository) Release(ctx context.Context, name, holder string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM leases WHERE name = $1 AND holder = $2`, name, holder)
+	return err
+}
+
+// PostgresAuditRepository is an AuditRepository backed by the auth_audit table.
+type PostgresAuditRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresAuditRepository returns an AuditRepository operating on the given connection pool.
+func NewPostgresAuditRepository(db *sql.DB) *PostgresAuditRepository {
+	return &PostgresAuditRepository{db: db}
+}
+
+func (r *PostgresAuditRepository) Append(ctx context.Context, record db.AuditRecord) error {
+	if record.ID.IsZero() {
+		record.ID = primitive.NewObjectID()
+	}
+	details, err := json.Marshal(record.Details)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO auth_audit (id, action, outcome, reason, actor_id, user_id, email, ip, user_agent, request_id, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		record.ID.Hex(), record.Action, record.Outcome, record.Reason, record.ActorID, record.UserID, record.Email,
+		record.IP, record.UserAgent, record.RequestID, details, record.CreatedAt)
+	return err
+}
+
+func (r *PostgresAuditRepository) Find(ctx context.Context, filter AuditFilter, fn func(db.AuditRecord) error) error {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.UserID != "" {
+		add("user_id = $%d", filter.UserID)
+	}
+	if filter.Email != "" {
+		add("email = $%d", filter.Email)
+	}
+	if !filter.From.IsZero() {
+		add("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("created_at < $%d", filter.To)
+	}
+
+	query := `SELECT id, action, outcome, reason, actor_id, user_id, email, ip, user_agent, request_id, details, created_at FROM auth_audit`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	query += ` ORDER BY created_at, id`
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d`, filter.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var details []byte
+		var record db.AuditRecord
+		err := rows.Scan(&id, &record.Action, &record.Outcome, &record.Reason, &record.ActorID, &record.UserID, &record.Email,
+			&record.IP, &record.UserAgent, &record.RequestID, &details, &record.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if record.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(details, &record.Details); err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// PostgresKeyRepository is a KeyRepository backed by the signing_keys table.
+type PostgresKeyRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresKeyRepository returns a KeyRepository operating on the given connection pool.
+func NewPostgresKeyRepository(db *sql.DB) *PostgresKeyRepository {
+	return &PostgresKeyRepository{db: db}
+}
+
+func (r *PostgresKeyRepository) Create(ctx context.Context, key db.SigningKey) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO signing_keys (kid, algorithm, private_key, public_key, created_at, retired_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		key.ID, key.Algorithm, key.PrivateKey, key.PublicKey, key.CreatedAt, nullTime(key.RetiredAt))
+	return err
+}
+
+func (r *PostgresKeyRepository) List(ctx context.Context) ([]db.SigningKey, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT kid, algorithm, private_key, public_key, created_at, retired_at FROM signing_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []db.SigningKey
+	for rows.Next() {
+		var key db.SigningKey
+		var retiredAt sql.NullTime
+		if err := rows.Scan(&key.ID, &key.Algorithm, &key.PrivateKey, &key.PublicKey, &key.CreatedAt, &retiredAt); err != nil {
+			return nil, err
+		}
+		key.RetiredAt = retiredAt.Time
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *PostgresKeyRepository) Retire(ctx context.Context, kid string, retiredAt time.Time) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE signing_keys SET retired_at = $2 WHERE kid = $1`, kid, retiredAt)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// PostgresClientRepository is a ClientRepository backed by the oauth_clients table.
+type PostgresClientRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresClientRepository returns a ClientRepository operating on the given connection pool.
+func NewPostgresClientRepository(db *sql.DB) *PostgresClientRepository {
+	return &PostgresClientRepository{db: db}
+}
+
+const selectClientColumns = `SELECT id, name, type, auth_method, secret_hash, public_key, redirect_uris, allowed_scopes, created_at
+	FROM oauth_clients`
+
+func (r *PostgresClientRepository) Create(ctx context.Context, client db.OAuthClient) error {
+	redirectURIs, err := json.Marshal(client.RedirectURIs)
+	if err != nil {
+		return err
+	}
+	scopes, err := json.Marshal(client.AllowedScopes)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO oauth_clients (id, name, type, auth_method, secret_hash, public_key, redirect_uris, allowed_scopes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		client.ID, client.Name, client.Type, client.AuthMethod, client.SecretHash, client.PublicKey,
+		redirectURIs, scopes, client.CreatedAt)
+	return err
+}
+
+func (r *PostgresClientRepository) FindByID(ctx context.Context, id string) (*db.OAuthClient, error) {
+	client, err := scanClient(r.db.QueryRowContext(ctx, selectClientColumns+` WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return client, err
+}
+
+func (r *PostgresClientRepository) List(ctx context.Context) ([]db.OAuthClient, error) {
+	rows, err := r.db.QueryContext(ctx, selectClientColumns+` ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []db.OAuthClient
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, rows.Err()
+}
+
+func (r *PostgresClientRepository) Delete(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM oauth_clients WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (r *PostgresClientRepository) UseAssertion(ctx context.Context, clientID, jti string, expiresAt time.Time) error {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO oauth_client_assertions (client_id, jti, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (client_id, jti) DO NOTHING`,
+		clientID, jti, expiresAt)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res); errors.Is(err, ErrNotFound) {
+		return ErrAssertionReplayed
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func scanClient(row scanner) (*db.OAuthClient, error) {
+	var client db.OAuthClient
+	var redirectURIs, scopes []byte
+	err := row.Scan(&client.ID, &client.Name, &client.Type, &client.AuthMethod, &client.SecretHash, &client.PublicKey,
+		&redirectURIs, &scopes, &client.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(redirectURIs, &client.RedirectURIs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(scopes, &client.AllowedScopes); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// PostgresAuthorizationRepository is an AuthorizationRepository backed by the oauth_authorizations table.
+type PostgresAuthorizationRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresAuthorizationRepository returns an AuthorizationRepository operating on the given connection pool.
+func NewPostgresAuthorizationRepository(db *sql.DB) *PostgresAuthorizationRepository {
+	return &PostgresAuthorizationRepository{db: db}
+}
+
+const authorizationColumns = `id, client_id, redirect_uri, scopes, state, code_challenge, code_challenge_method, nonce,
+	email, login_code, attempt_count, user_id, auth_time, code_hash, code_expires_at, consumed, created_at, expires_at`
+
+func (r *PostgresAuthorizationRepository) Create(ctx context.Context, a db.OAuthAuthorization) error {
+	scopes, err := json.Marshal(a.Scopes)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `INSERT INTO oauth_authorizations (`+authorizationColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+		a.ID, a.ClientID, a.RedirectURI, scopes, a.State, a.CodeChallenge, a.CodeChallengeMethod, a.Nonce,
+		a.Email, a.LoginCode, a.AttemptCount, nullObjectID(a.UserID), nullTime(a.AuthTime), nullString(a.CodeHash),
+		nullTime(a.CodeExpiresAt), a.Consumed, a.CreatedAt, a.ExpiresAt)
+	return err
+}
+
+func (r *PostgresAuthorizationRepository) Find(ctx context.Context, id string) (*db.OAuthAuthorization, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+authorizationColumns+` FROM oauth_authorizations WHERE id = $1`, id)
+	a, err := scanAuthorization(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return a, err
+}
+
+func (r *PostgresAuthorizationRepository) SetLogin(ctx context.Context, id, email, loginCode string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE oauth_authorizations SET email = $2, login_code = $3, user_id = NULL WHERE id = $1`,
+		id, email, loginCode)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (r *PostgresAuthorizationRepository) CountAttempt(ctx context.Context, id string, max int) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE oauth_authorizations SET attempt_count = attempt_count + 1 WHERE id = $1 AND attempt_count < $2`,
+		id, max)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res); errors.Is(err, ErrNotFound) {
+		return ErrTooManyAttempts
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresAuthorizationRepository) SetUser(ctx context.Context, id string, userID primitive.ObjectID, authTime time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE oauth_authorizations SET user_id = $2, auth_time = $3, login_code = '' WHERE id = $1`,
+		id, userID.Hex(), authTime)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (r *PostgresAuthorizationRepository) IssueCode(ctx context.Context, id, codeHash string, expiresAt time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE oauth_authorizations SET code_hash = $2, code_expires_at = $3 WHERE id = $1 AND NOT consumed`,
+		id, codeHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res); errors.Is(err, ErrNotFound) {
+		return ErrCodeConsumed
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresAuthorizationRepository) ConsumeCode(ctx context.Context, codeHash string, now time.Time) (*db.OAuthAuthorization, error) {
+	// The row is locked by the UPDATE, so of two concurrent exchanges of the same
+	// code the second one no longer matches NOT consumed.
+	row := r.db.QueryRowContext(ctx, `
+		UPDATE oauth_authorizations SET consumed = TRUE
+		WHERE code_hash = $1 AND NOT consumed AND code_expires_at > $2
+		RETURNING `+authorizationColumns,
+		codeHash, now)
+	a, err := scanAuthorization(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCodeConsumed
+	}
+	return a, err
+}
+
+func scanAuthorization(row scanner) (*db.OAuthAuthorization, error) {
+	var a db.OAuthAuthorization
+	var scopes []byte
+	var userID, codeHash sql.NullString
+	var authTime, codeExpiresAt sql.NullTime
+	err := row.Scan(&a.ID, &a.ClientID, &a.RedirectURI, &scopes, &a.State, &a.CodeChallenge, &a.CodeChallengeMethod, &a.Nonce,
+		&a.Email, &a.LoginCode, &a.AttemptCount, &userID, &authTime, &codeHash, &codeExpiresAt, &a.Consumed, &a.CreatedAt, &a.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(scopes, &a.Scopes); err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		if a.UserID, err = primitive.ObjectIDFromHex(userID.String); err != nil {
+			return nil, err
+		}
+	}
+	a.AuthTime = authTime.Time
+	a.CodeHash = codeHash.String
+	a.CodeExpiresAt = codeExpiresAt.Time
+	return &a, nil
+}
+
+// PostgresConsentRepository is a ConsentRepository backed by the oauth_consents table.
+type PostgresConsentRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresConsentRepository returns a ConsentRepository operating on the given connection pool.
+func NewPostgresConsentRepository(db *sql.DB) *PostgresConsentRepository {
+	return &PostgresConsentRepository{db: db}
+}
+
+func (r *PostgresConsentRepository) Find(ctx context.Context, userID primitive.ObjectID, clientID string) (*db.OAuthConsent, error) {
+	consent := db.OAuthConsent{UserID: userID, ClientID: clientID}
+	var scopes []byte
+	err := r.db.QueryRowContext(ctx,
+		`SELECT scopes, granted_at, updated_at FROM oauth_consents WHERE user_id = $1 AND client_id = $2`,
+		userID.Hex(), clientID).Scan(&scopes, &consent.GrantedAt, &consent.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(scopes, &consent.Scopes); err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (r *PostgresConsentRepository) Grant(ctx context.Context, userID primitive.ObjectID, clientID string, scopes []string, now time.Time) error {
+	granted, err := json.Marshal(scopes)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO oauth_consents (user_id, client_id, scopes, granted_at, updated_at) VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET
+			scopes = (SELECT jsonb_agg(DISTINCT s) FROM jsonb_array_elements_text(oauth_consents.scopes || EXCLUDED.scopes) AS s),
+			updated_at = EXCLUDED.updated_at`,
+		userID.Hex(), clientID, granted, now)
+	return err
+}
+
+// NewPostgresStore returns a Store whose repositories use the given connection pool.
+func NewPostgresStore(db *sql.DB) *Store {
+	return &Store{
+		Pinger:         postgresPinger{db: db},
+		Users:          NewPostgresUserRepository(db),
+		Tokens:         NewPostgresTokenRepository(db),
+		Verifications:  NewPostgresVerificationRepository(db),
+		Maintenance:    NewPostgresMaintenanceRepository(db),
+		Leases:         NewPostgresLeaseRepository(db),
+		Audit:          NewPostgresAuditRepository(db),
+		Keys:           NewPostgresKeyRepository(db),
+		Clients:        NewPostgresClientRepository(db),
+		Authorizations: NewPostgresAuthorizationRepository(db),
+		Consents:       NewPostgresConsentRepository(db),
+	}
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertToken(ctx context.Context, e execer, token db.AuthToken) error {
+	_, err := e.ExecContext(ctx,
+		`INSERT INTO auth_tokens (token, user_id, device_info_id, created_at, expires_at, is_active) VALUES ($1, $2, $3, $4, $5, $6)`,
+		token.Token, token.UserID.Hex(), token.DeviceInfoID.Hex(), token.CreatedAt, token.ExpiresAt, token.IsActive)
+	return err
+}
+
+func scanUser(row scanner) (*db.AuthUser, error) {
+	var id string
+	var user db.AuthUser
+	var roles, permissions []byte
+	var deletionScheduledAt sql.NullTime
+	err := row.Scan(&id, &user.Email, &user.Code, &user.EmailVerified, &user.AttemptCount, &user.LastAttemptTime, &user.Password, &user.CreatedAt,
+		&user.Status, &user.StatusReason, &user.StatusChangedAt, &roles, &permissions, &user.CodeSentAt, &deletionScheduledAt, &user.DeletionCancelHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(roles, &user.Roles); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(permissions, &user.Permissions); err != nil {
+		return nil, err
+	}
+	user.DeletionScheduledAt = deletionScheduledAt.Time
+	if user.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// nonNil stores a nil slice as an empty JSON array rather than null.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// nullString maps the empty string to NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullObjectID maps the zero ObjectID to NULL.
+func nullObjectID(id primitive.ObjectID) sql.NullString {
+	if id.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: id.Hex(), Valid: true}
+}
+
+// nullTime maps the zero time to NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type postgresPinger struct {
+	db *sql.DB
+}
+
+func (p postgresPinger) Ping(ctx context.Context) error {
+	return p.db.PingContext(ctx)
+}
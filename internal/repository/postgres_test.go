@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/database/postgres"
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+)
+
+// The Postgres tests run against the server given by KSA_TEST_POSTGRES_DSN.
+// Without it an embedded Postgres is downloaded and started for the test binary;
+// when that is not possible either, the tests are skipped.
+const postgresDSNEnv = "KSA_TEST_POSTGRES_DSN"
+
+var testPostgres struct {
+	once     sync.Once
+	dsn      string
+	embedded *embeddedpostgres.EmbeddedPostgres
+	err      error
+}
+
+var testDatabases atomic.Int64
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if testPostgres.embedded != nil {
+		if err := testPostgres.embedded.Stop(); err != nil {
+			fmt.Fprintln(os.Stderr, "stopping embedded postgres:", err)
+		}
+	}
+	os.Exit(code)
+}
+
+// postgresServer returns the DSN of the test server, starting the embedded one on first use.
+func postgresServer(t *testing.T) string {
+	t.Helper()
+	testPostgres.once.Do(func() {
+		if dsn := os.Getenv(postgresDSNEnv); dsn != "" {
+			testPostgres.dsn = dsn
+			return
+		}
+		port, err := freePort()
+		if err != nil {
+			testPostgres.err = err
+			return
+		}
+		dir, err := os.MkdirTemp("", "kidneysmart-auth-postgres")
+		if err != nil {
+			testPostgres.err = err
+			return
+		}
+		cfg := embeddedpostgres.DefaultConfig().
+			Port(uint32(port)).
+			RuntimePath(dir).
+			Logger(io.Discard)
+		server := embeddedpostgres.NewDatabase(cfg)
+		if err := server.Start(); err != nil {
+			testPostgres.err = err
+			return
+		}
+		testPostgres.embedded = server
+		testPostgres.dsn = cfg.GetConnectionURL() + "?sslmode=disable"
+	})
+	if testPostgres.err != nil {
+		t.Skipf("no Postgres for the tests, set %s to run them: %v", postgresDSNEnv, testPostgres.err)
+	}
+	return testPostgres.dsn
+}
+
+// newPostgresDB creates an empty database on the test server and returns a connection to it.
+func newPostgresDB(t *testing.T) *sql.DB {
+	t.Helper()
+	ctx := context.Background()
+	dsn := postgresServer(t)
+
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	name := fmt.Sprintf("kidneysmart_test_%d_%d", os.Getpid(), testDatabases.Add(1))
+	if _, err := admin.ExecContext(ctx, `CREATE DATABASE `+name); err != nil {
+		t.Fatalf("create database: %v", err)
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Path = "/" + name
+	conn, err := sql.Open("pgx", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		if admin, err := sql.Open("pgx", dsn); err == nil {
+			admin.ExecContext(ctx, `DROP DATABASE IF EXISTS `+name)
+			admin.Close()
+		}
+	})
+	return conn
+}
+
+func newPostgresStore(t *testing.T) *Store {
+	t.Helper()
+	conn := newPostgresDB(t)
+	if err := postgres.Migrate(context.Background(), conn); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return NewPostgresStore(conn)
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func TestPostgresStore(t *testing.T) {
+	runStoreTests(t, newPostgresStore)
+}
+
+func TestPostgresMigrate(t *testing.T) {
+	ctx := context.Background()
+	conn := newPostgresDB(t)
+
+	// Migrations are recorded, so running them again changes nothing
+	for i := 0; i < 2; i++ {
+		if err := postgres.Migrate(ctx, conn); err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+	}
+
+	var versions []string
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob("../../database/postgres/migrations/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, file := range files {
+		want = append(want, strings.TrimSuffix(filepath.Base(file), ".sql"))
+	}
+	if len(want) == 0 || strings.Join(versions, ",") != strings.Join(want, ",") {
+		t.Fatalf("applied migrations %v, want %v", versions, want)
+	}
+
+	// Every table used by the repositories exists
+	for _, table := range []string{
+		"auth_users", "auth_tokens", "auth_devices", "auth_audit", "leases", "signing_keys",
+		"oauth_clients", "oauth_authorizations", "oauth_consents", "oauth_client_assertions",
+	} {
+		var exists bool
+		if err := conn.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Errorf("table %s was not created", table)
+		}
+	}
+}
+
+func TestPostgresMigrateConcurrently(t *testing.T) {
+	ctx := context.Background()
+	conn := newPostgresDB(t)
+
+	// Several replicas starting at the same time apply every migration once
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- postgres.Migrate(ctx, conn) }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var duplicates int
+	err := conn.QueryRowContext(ctx,
+		`SELECT count(*) FROM (SELECT version FROM schema_migrations GROUP BY version HAVING count(*) > 1) d`).Scan(&duplicates)
+	if err != nil || duplicates != 0 {
+		t.Errorf("%d migrations applied more than once (%v)", duplicates, err)
+	}
+}
+
+func TestPostgresCompleteVerificationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	store := newPostgresStore(t)
+	user := createUser(t, store, "1234")
+	if err := store.Tokens.Save(ctx, newToken(user.ID, "taken")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Storing the session fails, so the code must stay unused
+	err := store.Verifications.CompleteVerification(ctx, testEmail, "1234", newToken(user.ID, "taken"))
+	if err == nil || errors.Is(err, ErrCodeConsumed) {
+		t.Fatalf("got %v, want the error of the token insert", err)
+	}
+	unchanged, err := store.Users.FindByEmail(ctx, testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unchanged.EmailVerified || unchanged.Code != "1234" {
+		t.Fatalf("user verified=%v code=%q after a failed verification, want it unchanged", unchanged.EmailVerified, unchanged.Code)
+	}
+
+	if err := store.Verifications.CompleteVerification(ctx, testEmail, "1234", newToken(user.ID, "fresh")); err != nil {
+		t.Errorf("retry with the same code: %v", err)
+	}
+}
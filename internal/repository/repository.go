@@ -0,0 +1,225 @@
+// Package repository defines the storage contracts used by the HTTP handlers
+// together with their MongoDB and in-memory implementations.
+//
+// Handlers depend only on the interfaces declared here, which keeps them free
+// of driver specific code and allows them to run against the in-memory
+// implementation when no database is available.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("record not found")
+	// ErrCodeConsumed is returned when a verification code does not match or has already been used.
+	ErrCodeConsumed = errors.New("verification code is invalid or already used")
+	// ErrAssertionReplayed is returned when a client assertion has already been used.
+	ErrAssertionReplayed = errors.New("client assertion has already been used")
+	// ErrTooManyAttempts is returned when no more attempts to enter a code are allowed.
+	ErrTooManyAttempts = errors.New("too many attempts")
+)
+
+// UserRepository provides access to the authUser collection.
+type UserRepository interface {
+	// FindByEmail returns the user registered with the given email or ErrNotFound.
+	FindByEmail(ctx context.Context, email string) (*db.AuthUser, error)
+	// FindByID returns the user with the given ID or ErrNotFound.
+	FindByID(ctx context.Context, id primitive.ObjectID) (*db.AuthUser, error)
+	// Search returns up to limit users whose email contains query, ignoring case, ordered by email.
+	Search(ctx context.Context, query string, limit int) ([]db.AuthUser, error)
+	// Create registers a new unverified user with the given verification code.
+	Create(ctx context.Context, email, code string) error
+	// SetEmailVerified marks the email of the user as verified.
+	SetEmailVerified(ctx context.Context, email string) error
+	// SetAttemptCount stores the number of failed verification attempts and the time of the last one.
+	SetAttemptCount(ctx context.Context, email string, count int, lastAttemptTime time.Time) error
+	// CountAttempt counts an attempt to enter the code of the user at now. The attempt
+	// is counted only while fewer than max were made or the last one is at least
+	// lockout ago, as a single atomic update, so parallel guesses cannot exceed max;
+	// otherwise ErrTooManyAttempts is returned.
+	CountAttempt(ctx context.Context, email string, max int, lockout time.Duration, now time.Time) error
+	// SetCode replaces the verification code of the user, records when it was sent and
+	// resets its attempt counter. It returns ErrNotFound for an unknown email.
+	SetCode(ctx context.Context, email, code string, sentAt time.Time) error
+	// SetPassword stores the password hash of the user. It returns ErrNotFound for an unknown email.
+	SetPassword(ctx context.Context, email, passwordHash string) error
+	// SetStatus changes the status of the account (db.StatusActive or db.StatusSuspended)
+	// and records the reason. A scheduled deletion is cancelled. It returns ErrNotFound
+	// for an unknown email.
+	SetStatus(ctx context.Context, email, status, reason string, changedAt time.Time) error
+	// ScheduleDeletion puts the account into db.StatusPendingDeletion until deleteAt,
+	// stores the hash of the token that cancels the deletion and consumes the
+	// verification code, resetting its attempt counter. It returns ErrNotFound for an unknown email.
+	ScheduleDeletion(ctx context.Context, email, reason, cancelHash string, requestedAt, deleteAt time.Time) error
+	// FindDueForDeletion returns up to limit accounts pending deletion whose deletion
+	// time is not after now, the longest overdue first.
+	FindDueForDeletion(ctx context.Context, now time.Time, limit int) ([]db.AuthUser, error)
+	// SetRoles replaces the roles and additional permissions of the user. It returns ErrNotFound for an unknown email.
+	SetRoles(ctx context.Context, email string, roles, permissions []string) error
+	// Delete removes the user. It returns ErrNotFound for an unknown email.
+	Delete(ctx context.Context, email string) error
+}
+
+// TokenRepository provides access to the authToken collection.
+type TokenRepository interface {
+	// Save stores a new refresh token.
+	Save(ctx context.Context, token db.AuthToken) error
+	// FindByToken returns the refresh token record or ErrNotFound.
+	FindByToken(ctx context.Context, token string) (*db.AuthToken, error)
+	// Rotate replaces a refresh token with a new one and updates its lifetime. Only a
+	// token that is active and has not expired at createdAt is replaced, as a single
+	// atomic update; otherwise ErrNotFound is returned.
+	Rotate(ctx context.Context, oldToken, newToken string, createdAt, expiresAt time.Time) error
+	// CountActive returns the number of active refresh tokens that have not expired at now.
+	CountActive(ctx context.Context, now time.Time) (int64, error)
+	// FindActiveByUser returns the active refresh tokens of the user that have not expired at now, newest first.
+	FindActiveByUser(ctx context.Context, userID primitive.ObjectID, now time.Time) ([]db.AuthToken, error)
+	// RevokeByUser deactivates every refresh token of the user and returns how many were active.
+	RevokeByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+}
+
+// VerificationRepository completes the email verification of a user.
+type VerificationRepository interface {
+	// CompleteVerification consumes the verification code, marks the email of the user
+	// as verified, resets its attempt counter and stores the refresh token issued for the
+	// new session as a single unit of work. The code can be consumed only once: concurrent
+	// or repeated calls with the same code fail with ErrCodeConsumed.
+	CompleteVerification(ctx context.Context, email, code string, token db.AuthToken) error
+}
+
+// MaintenanceRepository removes records that are no longer needed.
+// When dryRun is set the methods only count the matching records.
+type MaintenanceRepository interface {
+	// PurgeTokens removes refresh tokens that expired before now or were deactivated.
+	PurgeTokens(ctx context.Context, now time.Time, dryRun bool) (int64, error)
+	// PurgeUnverifiedUsers removes users that registered before createdBefore and never verified their email.
+	PurgeUnverifiedUsers(ctx context.Context, createdBefore time.Time, dryRun bool) (int64, error)
+	// CompactDevices removes device records that are no longer referenced by an active refresh token.
+	CompactDevices(ctx context.Context, dryRun bool) (int64, error)
+	// PurgeAuditRecords removes audit records created before createdBefore.
+	PurgeAuditRecords(ctx context.Context, createdBefore time.Time, dryRun bool) (int64, error)
+	// PurgeAuthorizations removes OAuth authorization requests and used client
+	// assertions that expired before now.
+	PurgeAuthorizations(ctx context.Context, now time.Time, dryRun bool) (int64, error)
+	// PurgeUser removes the user together with its refresh tokens, devices, OAuth
+	// consents and authorization requests. The user record is removed last, so a purge
+	// that failed part way can be repeated.
+	PurgeUser(ctx context.Context, userID primitive.ObjectID, email string) error
+	// AnonymiseAuditRecords replaces the user ID and actor of the audit records of the
+	// user with pseudonym and removes the email, IP address and user agent. It returns
+	// the number of records about the user.
+	AnonymiseAuditRecords(ctx context.Context, userID, email, pseudonym string) (int64, error)
+}
+
+// AuditFilter selects audit records. Zero fields do not restrict the result.
+type AuditFilter struct {
+	UserID string
+	Email  string
+	From   time.Time // Inclusive
+	To     time.Time // Exclusive
+	Limit  int
+}
+
+// AuditRepository stores the security audit log. It is append-only: records can
+// be added and read but never changed. Only the personal data of deleted users is
+// removed, through MaintenanceRepository.AnonymiseAuditRecords.
+type AuditRepository interface {
+	// Append stores a new audit record.
+	Append(ctx context.Context, record db.AuditRecord) error
+	// Find calls fn for every record matching filter, oldest first, and stops at the first error.
+	Find(ctx context.Context, filter AuditFilter, fn func(db.AuditRecord) error) error
+}
+
+// LeaseRepository implements leader election with expiring lease records.
+type LeaseRepository interface {
+	// TryAcquire takes the named lease for holder, or renews it if holder already owns it.
+	// It reports false when another holder owns a lease that has not expired yet.
+	TryAcquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	// Release gives up the named lease if it is owned by holder.
+	Release(ctx context.Context, name, holder string) error
+}
+
+// KeyRepository stores the keys used to sign access and refresh tokens.
+type KeyRepository interface {
+	// Create stores a new signing key.
+	Create(ctx context.Context, key db.SigningKey) error
+	// List returns all stored keys, newest first.
+	List(ctx context.Context) ([]db.SigningKey, error)
+	// Retire marks the key as no longer used for signing. It stays available for
+	// verifying the tokens it has already signed.
+	Retire(ctx context.Context, kid string, retiredAt time.Time) error
+}
+
+// ClientRepository is the registry of OAuth clients.
+type ClientRepository interface {
+	// Create registers a new client.
+	Create(ctx context.Context, client db.OAuthClient) error
+	// FindByID returns the client with the given client_id or ErrNotFound.
+	FindByID(ctx context.Context, id string) (*db.OAuthClient, error)
+	// List returns all registered clients, oldest first.
+	List(ctx context.Context) ([]db.OAuthClient, error)
+	// Delete removes the client. It returns ErrNotFound for an unknown client_id.
+	Delete(ctx context.Context, id string) error
+	// UseAssertion records the jti of a private_key_jwt assertion of the client until
+	// expiresAt. It returns ErrAssertionReplayed if the jti has been used before.
+	UseAssertion(ctx context.Context, clientID, jti string, expiresAt time.Time) error
+}
+
+// AuthorizationRepository stores OAuth authorization requests and their authorization codes.
+type AuthorizationRepository interface {
+	// Create stores a new authorization request.
+	Create(ctx context.Context, authorization db.OAuthAuthorization) error
+	// Find returns the authorization request or ErrNotFound.
+	Find(ctx context.Context, id string) (*db.OAuthAuthorization, error)
+	// SetLogin stores the email and the login code sent to it. The attempt counter is
+	// kept, so sending a new code does not allow more guesses.
+	SetLogin(ctx context.Context, id, email, loginCode string) error
+	// CountAttempt counts an attempt to enter the login code. The attempt is counted
+	// only while fewer than max were made, as a single atomic update, so parallel
+	// guesses cannot exceed max; otherwise ErrTooManyAttempts is returned.
+	CountAttempt(ctx context.Context, id string, max int) error
+	// SetUser records the user authenticated at authTime and clears the login code.
+	SetUser(ctx context.Context, id string, userID primitive.ObjectID, authTime time.Time) error
+	// IssueCode stores the hash of a new authorization code. It fails with
+	// ErrCodeConsumed if a code of the request has already been exchanged.
+	IssueCode(ctx context.Context, id, codeHash string, expiresAt time.Time) error
+	// ConsumeCode marks the authorization code as exchanged and returns its request.
+	// A code can be consumed only once and only before it expires at now; otherwise
+	// ErrCodeConsumed is returned.
+	ConsumeCode(ctx context.Context, codeHash string, now time.Time) (*db.OAuthAuthorization, error)
+}
+
+// ConsentRepository stores the scopes users have granted to OAuth clients.
+type ConsentRepository interface {
+	// Find returns the consent of the user for the client or ErrNotFound.
+	Find(ctx context.Context, userID primitive.ObjectID, clientID string) (*db.OAuthConsent, error)
+	// Grant adds scopes to the consent of the user for the client, creating it if needed.
+	Grant(ctx context.Context, userID primitive.ObjectID, clientID string, scopes []string, now time.Time) error
+}
+
+// Pinger reports whether the storage backend is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Store groups the repositories of a single storage backend.
+type Store struct {
+	Pinger         Pinger
+	Users          UserRepository
+	Tokens         TokenRepository
+	Verifications  VerificationRepository
+	Maintenance    MaintenanceRepository
+	Leases         LeaseRepository
+	Audit          AuditRepository
+	Keys           KeyRepository
+	Clients        ClientRepository
+	Authorizations AuthorizationRepository
+	Consents       ConsentRepository
+}
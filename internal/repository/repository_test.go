@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The tests in this file describe the behaviour every Store has to provide.
+// They are run against each backend available to the test binary.
+
+func TestMemoryStore(t *testing.T) {
+	runStoreTests(t, func(*testing.T) *Store { return NewMemoryStore() })
+}
+
+func runStoreTests(t *testing.T, newStore func(t *testing.T) *Store) {
+	t.Run("CompleteVerification", func(t *testing.T) { testCompleteVerification(t, newStore(t)) })
+	t.Run("CompleteVerificationOnce", func(t *testing.T) { testCompleteVerificationOnce(t, newStore(t)) })
+	t.Run("Rotate", func(t *testing.T) { testRotate(t, newStore(t)) })
+	t.Run("CountAttempt", func(t *testing.T) { testCountAttempt(t, newStore(t)) })
+	t.Run("CountUserAttempt", func(t *testing.T) { testCountUserAttempt(t, newStore(t)) })
+}
+
+const testEmail = "user@example.com"
+
+func createUser(t *testing.T, store *Store, code string) *db.AuthUser {
+	t.Helper()
+	ctx := context.Background()
+	if err := store.Users.Create(ctx, testEmail, code); err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.Users.FindByEmail(ctx, testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func newToken(userID primitive.ObjectID, token string) db.AuthToken {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return db.AuthToken{
+		UserID:       userID,
+		DeviceInfoID: primitive.NilObjectID,
+		Token:        token,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(24 * time.Hour),
+		IsActive:     true,
+	}
+}
+
+func testCompleteVerification(t *testing.T, store *Store) {
+	ctx := context.Background()
+	user := createUser(t, store, "1234")
+	if err := store.Users.SetAttemptCount(ctx, testEmail, 2, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		code    string
+		token   string
+		wantErr error
+	}{
+		{name: "wrong code", code: "4321", token: "t1", wantErr: ErrCodeConsumed},
+		{name: "empty code", code: "", token: "t2", wantErr: ErrCodeConsumed},
+		{name: "correct code", code: "1234", token: "t3"},
+		{name: "code already used", code: "1234", token: "t4", wantErr: ErrCodeConsumed},
+	}
+	for _, tt := range tests {
+		err := store.Verifications.CompleteVerification(ctx, testEmail, tt.code, newToken(user.ID, tt.token))
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: got %v, want %v", tt.name, err, tt.wantErr)
+		}
+		_, err = store.Tokens.FindByToken(ctx, tt.token)
+		if tt.wantErr == nil && err != nil {
+			t.Errorf("%s: token of the session not stored: %v", tt.name, err)
+		} else if tt.wantErr != nil && !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: token stored for a failed verification (%v)", tt.name, err)
+		}
+	}
+
+	verified, err := store.Users.FindByEmail(ctx, testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified.EmailVerified || verified.Code != "" || verified.AttemptCount != 0 {
+		t.Errorf("user verified=%v code=%q attempts=%d, want verified with the code consumed",
+			verified.EmailVerified, verified.Code, verified.AttemptCount)
+	}
+}
+
+func testCompleteVerificationOnce(t *testing.T, store *Store) {
+	ctx := context.Background()
+	user := createUser(t, store, "1234")
+
+	const submissions = 20
+	errs := make([]error, submissions)
+	var wg sync.WaitGroup
+	for i := 0; i < submissions; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token := newToken(user.ID, primitive.NewObjectID().Hex())
+			errs[i] = store.Verifications.CompleteVerification(ctx, testEmail, "1234", token)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrCodeConsumed):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d submissions consumed the code, want exactly one", succeeded)
+	}
+	if n, err := store.Tokens.CountActive(ctx, time.Now()); err != nil || n != 1 {
+		t.Errorf("%d sessions created (%v), want 1", n, err)
+	}
+}
+
+func testRotate(t *testing.T, store *Store) {
+	ctx := context.Background()
+	user := createUser(t, store, "1234")
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	active := newToken(user.ID, "active")
+	revoked := newToken(user.ID, "revoked")
+	revoked.IsActive = false
+	expired := newToken(user.ID, "expired")
+	expired.ExpiresAt = now.Add(-time.Minute)
+	for _, token := range []db.AuthToken{active, revoked, expired} {
+		if err := store.Tokens.Save(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		wantErr error
+	}{
+		{name: "unknown token", old: "unknown", new: "n1", wantErr: ErrNotFound},
+		{name: "revoked token", old: "revoked", new: "n2", wantErr: ErrNotFound},
+		{name: "expired token", old: "expired", new: "n3", wantErr: ErrNotFound},
+		{name: "active token", old: "active", new: "n4"},
+		{name: "already rotated", old: "active", new: "n5", wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		err := store.Tokens.Rotate(ctx, tt.old, tt.new, now, now.Add(time.Hour))
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	rotated, err := store.Tokens.FindByToken(ctx, "n4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rotated.IsActive || rotated.UserID != user.ID || !rotated.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("rotated token %+v, want an active token of the user expiring in an hour", rotated)
+	}
+
+	// A session revoked after it was read must not be rotated
+	if _, err := store.Tokens.RevokeByUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Tokens.Rotate(ctx, "n4", "n6", now, now.Add(time.Hour)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("rotating a revoked session: got %v, want ErrNotFound", err)
+	}
+}
+
+func testCountAttempt(t *testing.T, store *Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if err := store.Clients.Create(ctx, db.OAuthClient{ID: "client", Name: "Client", Type: "public", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	err := store.Authorizations.Create(ctx, db.OAuthAuthorization{
+		ID:        "request",
+		ClientID:  "client",
+		Scopes:    []string{"openid"},
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Parallel guesses are counted one by one and stop at the limit
+	const max, guesses = 5, 20
+	errs := make([]error, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = store.Authorizations.CountAttempt(ctx, "request", max)
+		}(i)
+	}
+	wg.Wait()
+
+	counted := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			counted++
+		case !errors.Is(err, ErrTooManyAttempts):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if counted != max {
+		t.Errorf("%d attempts counted, want %d", counted, max)
+	}
+	authorization, err := store.Authorizations.Find(ctx, "request")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorization.AttemptCount != max {
+		t.Errorf("attempt count = %d, want %d", authorization.AttemptCount, max)
+	}
+	if err := store.Authorizations.CountAttempt(ctx, "unknown", max); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("unknown request: got %v, want ErrTooManyAttempts", err)
+	}
+}
+
+func testCountUserAttempt(t *testing.T, store *Store) {
+	ctx := context.Background()
+	createUser(t, store, "1234")
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	// Parallel guesses are counted one by one and stop at the limit
+	const max, guesses = 5, 20
+	errs := make([]error, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = store.Users.CountAttempt(ctx, testEmail, max, time.Hour, now)
+		}(i)
+	}
+	wg.Wait()
+
+	counted := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			counted++
+		case !errors.Is(err, ErrTooManyAttempts):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if counted != max {
+		t.Errorf("%d attempts counted, want %d", counted, max)
+	}
+
+	// After the lockout one more attempt is allowed
+	later := now.Add(time.Hour)
+	if err := store.Users.CountAttempt(ctx, testEmail, max, time.Hour, later); err != nil {
+		t.Errorf("attempt after the lockout: %v", err)
+	}
+	if err := store.Users.CountAttempt(ctx, testEmail, max, time.Hour, later); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("second attempt after the lockout: got %v, want ErrTooManyAttempts", err)
+	}
+	if err := store.Users.CountAttempt(ctx, "unknown@example.com", max, time.Hour, now); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("unknown user: got %v, want ErrTooManyAttempts", err)
+	}
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/config"
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// NewMongoStore returns a Store whose repositories use the collections configured for the given database.
+func NewMongoStore(database *mongo.Database, collections config.CollectionsConfig) *Store {
+	users := NewMongoUserRepository(database, collections.AuthUser)
+	tokens := NewMongoTokenRepository(database, collections.AuthToken)
+	return &Store{
+		Pinger:         mongoPinger{client: database.Client()},
+		Users:          users,
+		Tokens:         tokens,
+		Verifications:  NewMongoVerificationRepository(users, tokens),
+		Maintenance:    NewMongoMaintenanceRepository(database, collections.AuthUser, collections.AuthToken, collections.DeviceInfo, collections.Audit, collections.OAuthAuthorization, collections.OAuthAssertion, collections.OAuthConsent),
+		Leases:         NewMongoLeaseRepository(database, collections.Lease),
+		Audit:          NewMongoAuditRepository(database, collections.Audit),
+		Keys:           NewMongoKeyRepository(database, collections.SigningKey),
+		Clients:        NewMongoClientRepository(database, collections.OAuthClient, collections.OAuthAssertion),
+		Authorizations: NewMongoAuthorizationRepository(database, collections.OAuthAuthorization),
+		Consents:       NewMongoConsentRepository(database, collections.OAuthConsent),
+	}
+}
+
+// MigrateMongo converts documents written by earlier versions, like the Postgres
+// migrations do for their tables. Users disabled before the account status existed
+// become suspended. It is safe to run on every start.
+func MigrateMongo(ctx context.Context, database *mongo.Database, collections config.CollectionsConfig) error {
+	users := database.Collection(collections.AuthUser)
+	_, err := users.UpdateMany(ctx,
+		bson.M{"disabled": true, "status": bson.M{"$in": bson.A{"", nil}}},
+		bson.M{"$set": bson.M{"status": db.StatusSuspended, "statusReason": "disabled"}})
+	if err != nil {
+		return fmt.Errorf("error migrating disabled users: %w", err)
+	}
+	if _, err := users.UpdateMany(ctx, bson.M{"disabled": bson.M{"$exists": true}}, bson.M{"$unset": bson.M{"disabled": ""}}); err != nil {
+		return fmt.Errorf("error removing the disabled flag: %w", err)
+	}
+	return nil
+}
+
+type mongoPinger struct {
+	client *mongo.Client
+}
+
+func (p mongoPinger) Ping(ctx context.Context) error {
+	return p.client.Ping(ctx, readpref.Primary())
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoTokenRepository is a TokenRepository backed by a MongoDB collection.
+type MongoTokenRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoTokenRepository returns a TokenRepository that stores refresh tokens in the given collection.
+func NewMongoTokenRepository(database *mongo.Database, collection string) *MongoTokenRepository {
+	return &MongoTokenRepository{
+		collection: database.Collection(collection),
+	}
+}
+
+func (r *MongoTokenRepository) Save(ctx context.Context, token db.AuthToken) error {
+	_, err := r.collection.InsertOne(ctx, token)
+	return err
+}
+
+func (r *MongoTokenRepository) FindByToken(ctx context.Context, token string) (*db.AuthToken, error) {
+	var existing db.AuthToken
+	err := r.collection.FindOne(ctx, bson.M{"token": token}).Decode(&existing)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (r *MongoTokenRepository) Rotate(ctx context.Context, oldToken, newToken string, createdAt, expiresAt time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"token":     newToken,
+			"createdAt": createdAt,
+			"expiresAt": expiresAt,
+		},
+	}
+	// Проверка активности и срока действия входит в фильтр, поэтому отозванный
+	// или истекший токен не может быть обновлен
+	filter := bson.M{"token": oldToken, "isActive": true, "expiresAt": bson.M{"$gt": createdAt}}
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoTokenRepository) CountActive(ctx context.Context, now time.Time) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"isActive": true, "expiresAt": bson.M{"$gte": now}})
+}
+
+func (r *MongoTokenRepository) FindActiveByUser(ctx context.Context, userID primitive.ObjectID, now time.Time) ([]db.AuthToken, error) {
+	filter := bson.M{"userId": userID, "isActive": true, "expiresAt": bson.M{"$gte": now}}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []db.AuthToken
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *MongoTokenRepository) RevokeByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	update := bson.M{"$set": bson.M{"isActive": false}}
+	res, err := r.collection.UpdateMany(ctx, bson.M{"userId": userID, "isActive": true}, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoUserRepository is a UserRepository backed by a MongoDB collection.
+type MongoUserRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoUserRepository returns a UserRepository that stores users in the given collection.
+func NewMongoUserRepository(database *mongo.Database, collection string) *MongoUserRepository {
+	return &MongoUserRepository{
+		collection: database.Collection(collection),
+	}
+}
+
+func (r *MongoUserRepository) FindByEmail(ctx context.Context, email string) (*db.AuthUser, error) {
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+func (r *MongoUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*db.AuthUser, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *MongoUserRepository) Search(ctx context.Context, query string, limit int) ([]db.AuthUser, error) {
+	filter := bson.M{"email": bson.M{"$regex": regexp.QuoteMeta(query), "$options": "i"}}
+	opts := options.Find().SetSort(bson.D{{Key: "email", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var users []db.AuthUser
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *MongoUserRepository) findOne(ctx context.Context, filter bson.M) (*db.AuthUser, error) {
+	var user db.AuthUser
+	err := r.collection.FindOne(ctx, filter).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *MongoUserRepository) Create(ctx context.Context, email, code string) error {
+	newUser := bson.M{
+		"email":     email,
+		"code":      code,
+		"createdAt": time.Now(),
+	}
+	_, err := r.collection.InsertOne(ctx, newUser)
+	return err
+}
+
+func (r *MongoUserRepository) SetEmailVerified(ctx context.Context, email string) error {
+	update := bson.M{"$set": bson.M{"emailVerified": true}}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	return err
+}
+
+func (r *MongoUserRepository) SetAttemptCount(ctx context.Context, email string, count int, lastAttemptTime time.Time) error {
+	update := bson.M{"$set": bson.M{"attemptCount": count, "lastAttemptTime": lastAttemptTime}}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	return err
+}
+
+func (r *MongoUserRepository) CountAttempt(ctx context.Context, email string, max int, lockout time.Duration, now time.Time) error {
+	// Попытка засчитывается, только пока лимит не исчерпан или блокировка истекла
+	filter := bson.M{
+		"email": email,
+		"$or": bson.A{
+			bson.M{"attemptCount": bson.M{"$lt": max}},
+			bson.M{"lastAttemptTime": bson.M{"$lte": now.Add(-lockout)}},
+		},
+	}
+	update := bson.M{"$inc": bson.M{"attemptCount": 1}, "$set": bson.M{"lastAttemptTime": now}}
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) SetCode(ctx context.Context, email, code string, sentAt time.Time) error {
+	update := bson.M{"$set": bson.M{"code": code, "codeSentAt": sentAt, "attemptCount": 0}}
+	res, err := r.collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) SetPassword(ctx context.Context, email, passwordHash string) error {
+	res, err := r.collection.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{"password": passwordHash}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) SetStatus(ctx context.Context, email, status, reason string, changedAt time.Time) error {
+	update := bson.M{
+		"$set":   bson.M{"status": status, "statusReason": reason, "statusChangedAt": changedAt},
+		"$unset": bson.M{"deletionScheduledAt": "", "deletionCancelHash": ""},
+	}
+	res, err := r.collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) ScheduleDeletion(ctx context.Context, email, reason, cancelHash string, requestedAt, deleteAt time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":              db.StatusPendingDeletion,
+			"statusReason":        reason,
+			"statusChangedAt":     requestedAt,
+			"deletionScheduledAt": deleteAt,
+			"deletionCancelHash":  cancelHash,
+			"code":                "",
+			"attemptCount":        0,
+		},
+	}
+	res, err := r.collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) FindDueForDeletion(ctx context.Context, now time.Time, limit int) ([]db.AuthUser, error) {
+	filter := bson.M{"status": db.StatusPendingDeletion, "deletionScheduledAt": bson.M{"$lte": now}}
+	opts := options.Find().SetSort(bson.D{{Key: "deletionScheduledAt", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var users []db.AuthUser
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *MongoUserRepository) SetRoles(ctx context.Context, email string, roles, permissions []string) error {
+	update := bson.M{"$set": bson.M{"roles": roles, "permissions": permissions}}
+	res, err := r.collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) Delete(ctx context.Context, email string) error {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"email": email})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/model/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoVerificationRepository is a VerificationRepository backed by MongoDB.
+//
+// On replica sets and sharded clusters the verification runs inside a multi-document
+// transaction. Standalone servers do not support transactions, so there the token
+// insert is compensated by restoring every field of the user document that
+// consuming the code changed.
+type MongoVerificationRepository struct {
+	users  *MongoUserRepository
+	tokens *MongoTokenRepository
+
+	mu            sync.Mutex
+	topologyKnown bool
+	supportsTxn   bool
+}
+
+// NewMongoVerificationRepository returns a VerificationRepository operating on the given repositories.
+func NewMongoVerificationRepository(users *MongoUserRepository, tokens *MongoTokenRepository) *MongoVerificationRepository {
+	return &MongoVerificationRepository{
+		users:  users,
+		tokens: tokens,
+	}
+}
+
+func (r *MongoVerificationRepository) CompleteVerification(ctx context.Context, email, code string, token db.AuthToken) error {
+	if !r.supportsTransactions(ctx) {
+		return r.completeWithCompensation(ctx, email, code, token)
+	}
+
+	client := r.users.collection.Database().Client()
+	return client.UseSession(ctx, func(sc mongo.SessionContext) error {
+		_, err := sc.WithTransaction(sc, func(sc mongo.SessionContext) (interface{}, error) {
+			if err := r.consumeCode(sc, email, code); err != nil {
+				return nil, err
+			}
+			return nil, r.tokens.Save(sc, token)
+		})
+		return err
+	})
+}
+
+// completeWithCompensation consumes the code and, if the token cannot be stored,
+// puts the code, the verification flag and the attempt counters back as they were
+// so the code can be retried.
+func (r *MongoVerificationRepository) completeWithCompensation(ctx context.Context, email, code string, token db.AuthToken) error {
+	before, err := r.consumeCodeReturningPrevious(ctx, email, code)
+	if err != nil {
+		return err
+	}
+
+	if err := r.tokens.Save(ctx, token); err != nil {
+		set := bson.M{"emailVerified": false, "code": code}
+		unset := bson.M{}
+		for _, field := range []string{"attemptCount", "lastAttemptTime"} {
+			if value, ok := before[field]; ok {
+				set[field] = value
+			} else {
+				unset[field] = ""
+			}
+		}
+		restore := bson.M{"$set": set}
+		if len(unset) > 0 {
+			restore["$unset"] = unset
+		}
+		// The compensation must run even if the request context has been cancelled.
+		if _, undoErr := r.users.collection.UpdateOne(context.Background(), bson.M{"email": email}, restore); undoErr != nil {
+			return errors.Join(err, undoErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// consumeCode atomically marks the email as verified and removes the code. The filter
+// matches only while the code is still unused, so the code is consumed exactly once.
+func (r *MongoVerificationRepository) consumeCode(ctx context.Context, email, code string) error {
+	res, err := r.users.collection.UpdateOne(ctx, consumeCodeFilter(email, code), consumeCodeUpdate)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrCodeConsumed
+	}
+	return nil
+}
+
+// consumeCodeReturningPrevious consumes the code like consumeCode and returns the
+// attempt fields as they were before, for the compensation to put back.
+func (r *MongoVerificationRepository) consumeCodeReturningPrevious(ctx context.Context, email, code string) (bson.M, error) {
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetProjection(bson.M{"attemptCount": 1, "lastAttemptTime": 1})
+	var before bson.M
+	err := r.users.collection.FindOneAndUpdate(ctx, consumeCodeFilter(email, code), consumeCodeUpdate, opts).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrCodeConsumed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return before, nil
+}
+
+// consumeCodeFilter matches the user only while the code is still unused.
+func consumeCodeFilter(email, code string) bson.M {
+	return bson.M{
+		"email":         email,
+		"code":          code,
+		"emailVerified": bson.M{"$ne": true},
+	}
+}
+
+// consumeCodeUpdate marks the email as verified, resets the attempts and removes the code.
+var consumeCodeUpdate = bson.M{
+	"$set":   bson.M{"emailVerified": true, "attemptCount": 0, "lastAttemptTime": time.Time{}},
+	"$unset": bson.M{"code": ""},
+}
+
+// supportsTransactions reports whether the server is a replica set member or a mongos.
+// The answer is cached after the first successful check.
+func (r *MongoVerificationRepository) supportsTransactions(ctx context.Context) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.topologyKnown {
+		return r.supportsTxn
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	admin := r.users.collection.Database().Client().Database("admin")
+	if err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false
+	}
+
+	r.topologyKnown = true
+	r.supportsTxn = hello.SetName != "" || hello.Msg == "isdbgrid"
+	return r.supportsTxn
+}
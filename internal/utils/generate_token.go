@@ -16,6 +16,9 @@ var (
 	ErrUserIDNotFound       = errors.New("userID not found in token")
 	ErrTokenClaimsInvalid   = errors.New("token claims are invalid")
 	ErrTokenSignatureInvalid = errors.New("token signature is invalid")
+	ErrServiceNotFound       = errors.New("service not found in token")
+	ErrAccountSuspended      = errors.New("account is suspended")
+	ErrAccountPendingDeletion = errors.New("account is pending deletion")
 )
 
 // CalculateAccessTokenExpiryTime возвращает время истечения access токена в UTC.
@@ -28,63 +31,200 @@ func CalculateRefreshTokenExpiryTime(days int) time.Time {
 	return time.Now().UTC().Add(time.Duration(days) * 24 * time.Hour)
 }
 
+// TokenSigner подписывает JWT.
+type TokenSigner interface {
+	SignToken(claims jwt.Claims) (string, error)
+}
+
+// TokenVerifier возвращает ключ для проверки подписи JWT. Должен отклонять
+// неизвестные алгоритмы ошибкой ErrTokenSignatureInvalid.
+type TokenVerifier interface {
+	VerificationKey(token *jwt.Token) (interface{}, error)
+}
+
+// HMACSecret подписывает и проверяет токены общим секретом (HS256).
+type HMACSecret []byte
+
+func (s HMACSecret) SignToken(claims jwt.Claims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s))
+}
+
+func (s HMACSecret) VerificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, ErrTokenSignatureInvalid
+	}
+	return []byte(s), nil
+}
+
 // GenerateAccessToken создает JWT access токен для верифицированного пользователя.
-func GenerateAccessToken(userID string, jwtSecret string, accessTokenExpiryHours int) (string, error) {
+// Роли пользователя передаются массивом в claim "roles", scope - через пробел в claim "scope".
+func GenerateAccessToken(userID string, roles, scopes []string, signer TokenSigner, accessTokenExpiryHours int) (string, error) {
 	claims := jwt.MapClaims{
 		"userID": userID,
 		"type":   "access",
+		"roles":  roles,
+		"scope":  strings.Join(scopes, " "),
 		// "exp":    CalculateAccessTokenExpiryTime(accessTokenExpiryHours).Unix(),
 		"exp": time.Now().Add(time.Duration(1) * time.Minute).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(jwtSecret))
+	return signer.SignToken(claims)
 }
 
 // GenerateRefreshToken создает JWT refresh токен для верифицированного пользователя.
-func GenerateRefreshToken(userID string, jwtSecret string, refreshTokenExpiryDays int) (string, error) {
+func GenerateRefreshToken(userID string, signer TokenSigner, refreshTokenExpiryDays int) (string, error) {
 	claims := jwt.MapClaims{
 		"userID": userID,
 		"type":   "refresh",
 		"exp":    CalculateRefreshTokenExpiryTime(refreshTokenExpiryDays).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(jwtSecret))
+	return signer.SignToken(claims)
+}
+
+// GenerateOAuthAccessToken создает access токен, выданный OAuth клиенту clientID от имени
+// пользователя. Выданные scope перечисляются через пробел в claim "scope".
+func GenerateOAuthAccessToken(userID, clientID string, scopes []string, signer TokenSigner, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"userID":    userID,
+		"type":      "access",
+		"client_id": clientID,
+		"scope":     strings.Join(scopes, " "),
+		"exp":       expiresAt.Unix(),
+	}
+
+	return signer.SignToken(claims)
+}
+
+// GenerateClientAccessToken создает access токен машинного клиента (client_credentials).
+// Токен не представляет пользователя: вместо userID субъектом является client_id.
+func GenerateClientAccessToken(clientID string, scopes []string, signer TokenSigner, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":       clientID,
+		"client_id": clientID,
+		"type":      "access",
+		"scope":     strings.Join(scopes, " "),
+		"exp":       expiresAt.Unix(),
+	}
+
+	return signer.SignToken(claims)
+}
+
+// IDTokenClaims описывает пользователя в ID токене OpenID Connect.
+type IDTokenClaims struct {
+	Issuer   string    // iss
+	Subject  string    // sub, ID пользователя
+	Audience string    // aud, client_id клиента
+	Nonce    string    // nonce из запроса авторизации, пустой не включается
+	AuthTime time.Time // auth_time, время входа пользователя
+	AMR      []string  // amr, способы аутентификации (RFC 8176)
+	// Email и EmailVerified включаются только при выданном scope email
+	Email         string
+	EmailVerified bool
+	IncludeEmail  bool
+}
+
+// GenerateIDToken создает ID токен OpenID Connect. Тип "id" не позволяет
+// использовать его как access токен.
+func GenerateIDToken(c IDTokenClaims, signer TokenSigner, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"iss":       c.Issuer,
+		"sub":       c.Subject,
+		"aud":       c.Audience,
+		"type":      "id",
+		"auth_time": c.AuthTime.Unix(),
+		"amr":       c.AMR,
+		"iat":       time.Now().Unix(),
+		"exp":       expiresAt.Unix(),
+	}
+	if c.Nonce != "" {
+		claims["nonce"] = c.Nonce
+	}
+	if c.IncludeEmail {
+		claims["email"] = c.Email
+		claims["email_verified"] = c.EmailVerified
+	}
+
+	return signer.SignToken(claims)
+}
+
+// GenerateServiceToken создает JWT для внутреннего сервиса с именем service.
+func GenerateServiceToken(service string, signer TokenSigner, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"service": service,
+		"type":    "service",
+		"exp":     expiresAt.Unix(),
+	}
+
+	return signer.SignToken(claims)
 }
 
 // ParseToken парсит и валидирует JWT, извлекая userID и проверяя срок действия.
-func ParseToken(tokenString, jwtSecret, expectedTokenType string) (string, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrTokenSignatureInvalid
-		}
-		return []byte(jwtSecret), nil
-	})
+func ParseToken(tokenString string, verifier TokenVerifier, expectedTokenType string) (string, error) {
+	return parseSubject(tokenString, verifier, expectedTokenType, "userID", ErrUserIDNotFound)
+}
+
+// ParseServiceToken парсит и валидирует токен сервиса, возвращая имя сервиса.
+func ParseServiceToken(tokenString string, verifier TokenVerifier) (string, error) {
+	return parseSubject(tokenString, verifier, "service", "service", ErrServiceNotFound)
+}
+
+// parseSubject проверяет токен и возвращает строковый claim subjectClaim.
+func parseSubject(tokenString string, verifier TokenVerifier, expectedTokenType, subjectClaim string, errNotFound error) (string, error) {
+	claims, err := ParseClaims(tokenString, verifier, expectedTokenType)
+	if err != nil {
+		return "", err
+	}
+	if subject, ok := claims[subjectClaim].(string); ok {
+		return subject, nil
+	}
+	return "", errNotFound
+}
+
+// ParseClaims проверяет подпись, тип и срок действия токена и возвращает все его claims.
+func ParseClaims(tokenString string, verifier TokenVerifier, expectedTokenType string) (jwt.MapClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &jwt.MapClaims{}, verifier.VerificationKey)
 // отлов встроеным методом что токен протух
 	if err != nil {
 		if strings.Contains(err.Error(), jwt.ErrTokenExpired.Error()) {
-			return "", ErrTokenExpired
+			return nil, ErrTokenExpired
 		}
 
-		return "", ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
 	if claims, ok := token.Claims.(*jwt.MapClaims); ok {
 		// Проверка типа токена
 		if tokenType, ok := (*claims)["type"].(string); !ok || tokenType != expectedTokenType {
-			return "", ErrInvalidTokenType
+			return nil, ErrInvalidTokenType
 		}
 
 		if exp, ok := (*claims)["exp"].(float64); !ok || time.Now().UTC().Unix() > int64(exp) {
-			return "", ErrTokenExpired
+			return nil, ErrTokenExpired
 		}
 
-		if userID, ok := (*claims)["userID"].(string); ok {
-			return userID, nil
-		}
-		return "", ErrUserIDNotFound
+		return *claims, nil
 	}
 
-	return "", ErrTokenClaimsInvalid
+	return nil, ErrTokenClaimsInvalid
+}
+
+// TokenErrorStatus возвращает статус и сообщение, которыми API отвечает на ошибку проверки токена.
+func TokenErrorStatus(err error) (status, message string) {
+	switch err {
+	case ErrTokenExpired:
+		return "TOKEN_EXPIRED", "Your token has expired. Please log in again."
+	case ErrInvalidToken, ErrInvalidTokenType:
+		return "INVALID_TOKEN", "The provided token is invalid. Check the token and try again."
+	case ErrUserIDNotFound:
+		return "USER_ID_NOT_FOUND", "UserID not found in token."
+	case ErrTokenSignatureInvalid:
+		return "INVALID_TOKEN_SIGNATURE", "The token's signature is invalid. The token may have been tampered with."
+	case ErrAccountSuspended:
+		return "ACCOUNT_SUSPENDED", "The account is suspended. Please contact support."
+	case ErrAccountPendingDeletion:
+		return "ACCOUNT_PENDING_DELETION", "The account is scheduled for deletion."
+	default:
+		return "AUTHENTICATION_FAILED", "Error occurred during token validation. Please try again."
+	}
 }
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateOpaqueToken возвращает случайную строку из n байт в base64url без padding.
+// Используется для OAuth client_id, секретов клиентов и кодов авторизации.
+func GenerateOpaqueToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashOpaqueToken возвращает SHA-256 токена в hex. В базе хранится только хеш.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// OpaqueTokenMatches сравнивает токен с сохраненным хешем за постоянное время.
+func OpaqueTokenMatches(token, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashOpaqueToken(token)), []byte(hash)) == 1
+}
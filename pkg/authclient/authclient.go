@@ -0,0 +1,324 @@
+// Package authclient is a Go client for the KidneySmart auth API.
+//
+// A Client performs the passwordless login flow (Login, then VerifyCode), keeps
+// the issued tokens and refreshes the access token shortly before it expires.
+// Refreshes are shared: when many goroutines need a new token at the same time,
+// only one refresh request is sent, which matters because every refresh rotates
+// the refresh token. Transport returns an http.RoundTripper that adds the access
+// token to outgoing requests:
+//
+//	client := authclient.New(authclient.Config{BaseURL: "https://wayofdt.com/kidneysmart-auth/v1"})
+//	if _, err := client.Login(ctx, email); err != nil { ... }
+//	if _, err := client.VerifyCode(ctx, email, code); err != nil { ... }
+//	api := &http.Client{Transport: client.Transport(nil)}
+package authclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	loginmodel "github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/login/model"
+	passwordmodel "github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/password/model"
+	refreshmodel "github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/refresh_token/model"
+	verifymodel "github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/verifycode/model"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Request and response bodies of the API. They are the types the server uses.
+type (
+	RequestLogin         = loginmodel.RequestLogin
+	ResponseLogin        = loginmodel.ResponseLogin
+	RequestVerifyCode    = verifymodel.RequestVerifyCode
+	ResponseVerifyCode   = verifymodel.ResponseVerifyCode
+	RequestRefreshToken  = refreshmodel.RequestRefreshToken
+	ResponseRefreshToken = refreshmodel.ResponseRefreshToken
+	RequestPassword      = passwordmodel.RequestPassword
+	ResponsePassword     = passwordmodel.ResponsePassword
+)
+
+const (
+	defaultTimeout       = 10 * time.Second
+	defaultRefreshBefore = 15 * time.Second
+)
+
+// ErrNoTokens is returned by authenticated calls before the client holds tokens.
+var ErrNoTokens = errors.New("authclient: no tokens, log in first")
+
+// APIError is returned for responses with a status code of 400 or above.
+type APIError struct {
+	StatusCode int
+	// Status is the machine readable status of the body, e.g. TOKEN_EXPIRED. It is
+	// empty for endpoints that only return a message.
+	Status  string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Status != "" {
+		return fmt.Sprintf("authclient: %d %s: %s", e.StatusCode, e.Status, e.Message)
+	}
+	return fmt.Sprintf("authclient: %d: %s", e.StatusCode, e.Message)
+}
+
+// Tokens is the session held by the client.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresAt is the expiry of the access token, read from its "exp" claim.
+	ExpiresAt time.Time
+}
+
+// Config configures a Client.
+type Config struct {
+	// BaseURL is the URL of the v1 API, e.g. https://wayofdt.com/kidneysmart-auth/v1.
+	BaseURL string
+	// HTTPClient sends the requests to the auth API. Defaults to a client with a 10 second timeout.
+	HTTPClient *http.Client
+	// RefreshBefore is how long before expiry the access token is refreshed. Defaults to 15 seconds.
+	RefreshBefore time.Duration
+	// OnTokens, if set, is called whenever new tokens were issued, e.g. to persist
+	// the rotated refresh token. It must not call back into the client.
+	OnTokens func(Tokens)
+}
+
+// Client calls the auth API. It is safe for concurrent use.
+type Client struct {
+	cfg Config
+
+	mu       sync.Mutex
+	tokens   Tokens
+	inflight *refreshCall
+}
+
+// refreshCall is a refresh request shared by every goroutine waiting for it.
+type refreshCall struct {
+	done   chan struct{}
+	tokens Tokens
+	err    error
+}
+
+// New returns a client without tokens.
+func New(cfg Config) *Client {
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: defaultTimeout}
+	}
+	if cfg.RefreshBefore <= 0 {
+		cfg.RefreshBefore = defaultRefreshBefore
+	}
+	return &Client{cfg: cfg}
+}
+
+// Login starts the login flow: a new account is registered and a verification
+// code is sent by email. For existing accounts the API answers with an error whose
+// status tells the next step, e.g. PASSWORD_ENTRY_REQUIRED. The decoded response
+// is returned together with an *APIError.
+func (c *Client) Login(ctx context.Context, email string) (*ResponseLogin, error) {
+	var resp ResponseLogin
+	err := c.do(ctx, http.MethodPost, "/login", "", &RequestLogin{Email: email}, &resp)
+	return &resp, err
+}
+
+// VerifyCode completes the login with the emailed code. On success the client
+// keeps the issued tokens.
+func (c *Client) VerifyCode(ctx context.Context, email, code string) (*ResponseVerifyCode, error) {
+	var resp ResponseVerifyCode
+	if err := c.do(ctx, http.MethodPost, "/verify-code", "", &RequestVerifyCode{Email: email, Code: code}, &resp); err != nil {
+		return &resp, err
+	}
+	if resp.AccessToken != "" {
+		c.SetTokens(newTokens(resp.AccessToken, resp.RefreshToken))
+	}
+	return &resp, nil
+}
+
+// SetPassword sets the password of the logged in user. It must be 8 to 72 bytes long.
+func (c *Client) SetPassword(ctx context.Context, password string) (*ResponsePassword, error) {
+	token, err := c.AccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var resp ResponsePassword
+	err = c.do(ctx, http.MethodPost, "/set-password", token, &RequestPassword{Password: password}, &resp)
+	return &resp, err
+}
+
+// Refresh exchanges the refresh token for new tokens now, regardless of the expiry
+// of the current access token.
+func (c *Client) Refresh(ctx context.Context) (Tokens, error) {
+	return c.refresh(ctx, c.Tokens().AccessToken)
+}
+
+// Tokens returns the tokens currently held.
+func (c *Client) Tokens() Tokens {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens
+}
+
+// SetTokens replaces the session, e.g. with tokens restored from storage.
+// ExpiresAt is read from the access token when it is zero.
+func (c *Client) SetTokens(tokens Tokens) {
+	if tokens.ExpiresAt.IsZero() {
+		tokens.ExpiresAt = tokenExpiry(tokens.AccessToken)
+	}
+	c.mu.Lock()
+	c.tokens = tokens
+	c.mu.Unlock()
+
+	if c.cfg.OnTokens != nil {
+		c.cfg.OnTokens(tokens)
+	}
+}
+
+// AccessToken returns an access token that is valid for at least RefreshBefore,
+// refreshing it if necessary.
+func (c *Client) AccessToken(ctx context.Context) (string, error) {
+	tokens := c.Tokens()
+	if tokens.AccessToken == "" {
+		return "", ErrNoTokens
+	}
+	if time.Until(tokens.ExpiresAt) > c.cfg.RefreshBefore {
+		return tokens.AccessToken, nil
+	}
+	tokens, err := c.refresh(ctx, tokens.AccessToken)
+	if err != nil {
+		return "", err
+	}
+	return tokens.AccessToken, nil
+}
+
+// refresh replaces the access token stale. If another goroutine has already
+// replaced it, its result is used; if a refresh is running, it is waited for.
+func (c *Client) refresh(ctx context.Context, stale string) (Tokens, error) {
+	c.mu.Lock()
+	if c.tokens.RefreshToken == "" {
+		c.mu.Unlock()
+		return Tokens{}, ErrNoTokens
+	}
+	if c.tokens.AccessToken != stale {
+		tokens := c.tokens
+		c.mu.Unlock()
+		return tokens, nil
+	}
+	call := c.inflight
+	if call == nil {
+		call = &refreshCall{done: make(chan struct{})}
+		c.inflight = call
+		go c.runRefresh(call, c.tokens.RefreshToken)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.tokens, call.err
+	case <-ctx.Done():
+		return Tokens{}, ctx.Err()
+	}
+}
+
+// runRefresh sends the refresh request. It does not use the context of the caller:
+// the server rotates the refresh token, so a request abandoned halfway would lose
+// the session. The HTTP client timeout bounds it instead.
+func (c *Client) runRefresh(call *refreshCall, refreshToken string) {
+	var resp ResponseRefreshToken
+	err := c.do(context.Background(), http.MethodPost, "/refresh-token", "", &RequestRefreshToken{RefreshToken: refreshToken}, &resp)
+
+	c.mu.Lock()
+	c.inflight = nil
+	if err == nil {
+		call.tokens = newTokens(resp.AccessToken, resp.RefreshToken)
+		c.tokens = call.tokens
+	}
+	call.err = err
+	c.mu.Unlock()
+	close(call.done)
+
+	if err == nil && c.cfg.OnTokens != nil {
+		c.cfg.OnTokens(call.tokens)
+	}
+}
+
+// do sends body as JSON and decodes the response into out. Responses with a status
+// code of 400 or above are decoded as well and returned with an *APIError.
+func (c *Client) do(ctx context.Context, method, path, accessToken string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		_ = json.Unmarshal(data, out)
+		return newAPIError(resp.StatusCode, data)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("authclient: decoding response of %s: %w", path, err)
+	}
+	return nil
+}
+
+func newAPIError(statusCode int, body []byte) *APIError {
+	var fields struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	_ = json.Unmarshal(body, &fields)
+	apiErr := &APIError{StatusCode: statusCode, Status: fields.Status, Message: fields.Message}
+	if apiErr.Message == "" {
+		apiErr.Message = fields.Error
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(statusCode)
+	}
+	return apiErr
+}
+
+func newTokens(accessToken, refreshToken string) Tokens {
+	return Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    tokenExpiry(accessToken),
+	}
+}
+
+// tokenExpiry reads the "exp" claim without verifying the token: the client only
+// needs to know when to refresh, the server does the verification.
+func tokenExpiry(accessToken string) time.Time {
+	token, _, err := jwt.NewParser().ParseUnverified(accessToken, jwt.MapClaims{})
+	if err != nil {
+		return time.Time{}
+	}
+	exp, err := token.Claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return time.Time{}
+	}
+	return exp.Time
+}
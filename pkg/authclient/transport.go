@@ -0,0 +1,69 @@
+package authclient
+
+import (
+	"io"
+	"net/http"
+)
+
+// Transport returns a RoundTripper that adds "Authorization: Bearer <access token>"
+// to every request, refreshing the token when needed. A request answered with
+// 401 is retried once with a freshly refreshed token if its body can be replayed.
+// base defaults to http.DefaultTransport.
+func (c *Client) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{client: c, base: base}
+}
+
+type transport struct {
+	client *Client
+	base   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.client.AccessToken(req.Context())
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(withToken(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	// The token may have been revoked or rotated on the server; try once more
+	tokens, refreshErr := t.client.refresh(req.Context(), token)
+	if refreshErr != nil {
+		return resp, nil
+	}
+	retry := withToken(req, tokens.AccessToken)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return t.base.RoundTrip(retry)
+}
+
+// withToken returns a copy of req carrying the access token. RoundTrippers must
+// not modify the request they were given.
+func withToken(req *http.Request, token string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", "Bearer "+token)
+	return clone
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,194 @@
+// Package authmw authenticates requests carrying KidneySmart access tokens.
+//
+// It is meant for the backends that sit behind the auth service. A Verifier checks
+// the bearer token either locally, with the public keys published at the JWKS
+// endpoint (JWKSVerifier), or remotely, through the introspection endpoint
+// (IntrospectionVerifier). The Gin and net/http middleware store the verified
+// Claims in the request context and answer failures with the same JSON bodies
+// and status codes as the auth service itself:
+//
+//	verifier := authmw.NewJWKSVerifier(authmw.JWKSConfig{
+//		URL: "https://auth.internal/kidneysmart-auth/.well-known/jwks.json",
+//	})
+//	router.Use(authmw.Gin(verifier))
+//	router.DELETE("/records/:id", authmw.GinRequireRole("admin"), deleteRecord)
+//
+//	mux.Handle("/records", authmw.Middleware(verifier)(authmw.RequireScope("records:read")(handler)))
+package authmw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Errors returned by the verifiers. They are the errors of the auth service, so
+// that both answer with the same status codes.
+var (
+	ErrTokenExpired          = utils.ErrTokenExpired
+	ErrInvalidToken          = utils.ErrInvalidToken
+	ErrInvalidTokenType      = utils.ErrInvalidTokenType
+	ErrUserIDNotFound        = utils.ErrUserIDNotFound
+	ErrTokenClaimsInvalid    = utils.ErrTokenClaimsInvalid
+	ErrTokenSignatureInvalid = utils.ErrTokenSignatureInvalid
+
+	// ErrAccountSuspended and ErrAccountPendingDeletion are returned by verifiers
+	// that check the account of the token, such as the introspection verifier.
+	ErrAccountSuspended       = utils.ErrAccountSuspended
+	ErrAccountPendingDeletion = utils.ErrAccountPendingDeletion
+
+	// ErrVerifierUnavailable means the keys or the introspection endpoint could not be reached.
+	ErrVerifierUnavailable = errors.New("token verifier is unavailable")
+)
+
+// UserIDKey is the Gin context key holding the user ID, as set by the auth service's own middleware.
+const UserIDKey = "userID"
+
+// ClaimsKey is the Gin context key holding the *Claims.
+const ClaimsKey = "authClaims"
+
+// ClientIDKey is the Gin context key holding the client ID of a machine client token.
+const ClientIDKey = "clientID"
+
+// Claims are the verified claims of an access token. Tokens of users carry
+// UserID; tokens of machine clients (client credentials grant) carry only ClientID.
+type Claims struct {
+	UserID    string
+	ClientID  string // OAuth client the token was issued to; empty for the KidneySmart apps
+	TokenType string
+	Scopes    []string
+	Roles     []string
+	ExpiresAt time.Time
+}
+
+// IsClient reports whether the token was issued to a machine client rather than a user.
+func (c *Claims) IsClient() bool {
+	return c.UserID == "" && c.ClientID != ""
+}
+
+// Subject returns the user ID, or the client ID of a machine client token.
+func (c *Claims) Subject() string {
+	if c.IsClient() {
+		return c.ClientID
+	}
+	return c.UserID
+}
+
+// HasScope reports whether the token was granted scope.
+func (c *Claims) HasScope(scope string) bool {
+	return contains(c.Scopes, scope)
+}
+
+// HasRole reports whether the user has role.
+func (c *Claims) HasRole(role string) bool {
+	return contains(c.Roles, role)
+}
+
+// ClaimsFromJWT converts the claims of a verified token. Scopes are read from the
+// space separated "scope" claim, roles from the "roles" array. A token without
+// "userID" is accepted only if it was issued to a machine client.
+func ClaimsFromJWT(m jwt.MapClaims) (*Claims, error) {
+	claims := &Claims{}
+	claims.UserID, _ = m["userID"].(string)
+	claims.ClientID, _ = m["client_id"].(string)
+	if claims.UserID == "" && claims.ClientID == "" {
+		return nil, ErrUserIDNotFound
+	}
+	claims.TokenType, _ = m["type"].(string)
+	if exp, ok := m["exp"].(float64); ok {
+		claims.ExpiresAt = time.Unix(int64(exp), 0).UTC()
+	}
+	if scope, ok := m["scope"].(string); ok {
+		claims.Scopes = strings.Fields(scope)
+	}
+	if roles, ok := m["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if name, ok := role.(string); ok {
+				claims.Roles = append(claims.Roles, name)
+			}
+		}
+	}
+	return claims, nil
+}
+
+// Verifier checks an access token and returns its claims.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*Claims, error)
+}
+
+type claimsContextKey struct{}
+
+// NewContext returns a copy of ctx carrying claims.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by the middleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
+
+// ErrorResponse is the JSON body of every authentication failure.
+type ErrorResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// authenticate extracts and verifies the bearer token of r. On failure it returns
+// the HTTP status code and body to answer with.
+func authenticate(r *http.Request, v Verifier) (*Claims, int, ErrorResponse) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, http.StatusUnauthorized, ErrorResponse{Status: "AUTHORIZATION_REQUIRED", Message: "Authorization header is required"}
+	}
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	if token == authHeader {
+		return nil, http.StatusUnauthorized, ErrorResponse{Status: "INVALID_TOKEN_FORMAT", Message: "Invalid token format. Format should be 'Bearer [token]'."}
+	}
+
+	claims, err := v.Verify(r.Context(), token)
+	if errors.Is(err, ErrVerifierUnavailable) {
+		return nil, http.StatusServiceUnavailable, ErrorResponse{Status: "AUTH_SERVICE_UNAVAILABLE", Message: "Token could not be verified at the moment. Please try again."}
+	}
+	if errors.Is(err, ErrAccountSuspended) || errors.Is(err, ErrAccountPendingDeletion) {
+		status, message := utils.TokenErrorStatus(err)
+		return nil, http.StatusForbidden, ErrorResponse{Status: status, Message: message}
+	}
+	if err != nil {
+		status, message := utils.TokenErrorStatus(err)
+		return nil, http.StatusUnauthorized, ErrorResponse{Status: status, Message: message}
+	}
+	return claims, 0, ErrorResponse{}
+}
+
+// authorize checks that claims hold one of the required values. kind is "scope" or "role".
+func authorize(claims *Claims, kind string, has func(*Claims, string) bool, required []string) (int, ErrorResponse) {
+	if claims == nil {
+		return http.StatusUnauthorized, ErrorResponse{Status: "AUTHORIZATION_REQUIRED", Message: "Authorization header is required"}
+	}
+	for _, value := range required {
+		if has(claims, value) {
+			return 0, ErrorResponse{}
+		}
+	}
+	return http.StatusForbidden, ErrorResponse{
+		Status:  "INSUFFICIENT_" + strings.ToUpper(kind),
+		Message: fmt.Sprintf("This operation requires the %s %s.", kind, strings.Join(required, " or ")),
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package authmw
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Gin returns middleware that rejects requests without a valid access token. The
+// claims are stored in the request context, under ClaimsKey, and the user ID under
+// UserIDKey. For machine client tokens the client ID is stored under ClientIDKey
+// instead, so handlers reading UserIDKey do not serve them.
+func Gin(v Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, status, body := authenticate(c.Request, v)
+		if claims == nil {
+			c.AbortWithStatusJSON(status, body)
+			return
+		}
+
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), claims))
+		c.Set(ClaimsKey, claims)
+		if claims.IsClient() {
+			c.Set(ClientIDKey, claims.ClientID)
+		} else {
+			c.Set(UserIDKey, claims.UserID)
+		}
+		c.Next()
+	}
+}
+
+// GinRequireScope allows the request if the token was granted any of scopes.
+// It must run after Gin.
+func GinRequireScope(scopes ...string) gin.HandlerFunc {
+	return ginRequire("scope", (*Claims).HasScope, scopes)
+}
+
+// GinRequireRole allows the request if the user has any of roles.
+// It must run after Gin.
+func GinRequireRole(roles ...string) gin.HandlerFunc {
+	return ginRequire("role", (*Claims).HasRole, roles)
+}
+
+func ginRequire(kind string, has func(*Claims, string) bool, required []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := ClaimsFromContext(c.Request.Context())
+		if status, body := authorize(claims, kind, has, required); status != 0 {
+			c.AbortWithStatusJSON(status, body)
+			return
+		}
+		c.Next()
+	}
+}
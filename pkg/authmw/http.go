@@ -0,0 +1,52 @@
+package authmw
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Middleware returns net/http middleware that rejects requests without a valid
+// access token and stores the claims in the request context.
+func Middleware(v Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, status, body := authenticate(r, v)
+			if claims == nil {
+				writeError(w, status, body)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
+
+// RequireScope allows the request if the token was granted any of scopes.
+// It must wrap a handler behind Middleware.
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return require("scope", (*Claims).HasScope, scopes)
+}
+
+// RequireRole allows the request if the user has any of roles.
+// It must wrap a handler behind Middleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return require("role", (*Claims).HasRole, roles)
+}
+
+func require(kind string, has func(*Claims, string) bool, required []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
+			if status, body := authorize(claims, kind, has, required); status != 0 {
+				writeError(w, status, body)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, body ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
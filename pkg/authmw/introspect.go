@@ -0,0 +1,161 @@
+package authmw
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/api/v1/introspect/model"
+)
+
+const (
+	defaultIntrospectionCacheTTL = 30 * time.Second
+	maxIntrospectionCacheSize    = 10000
+)
+
+// IntrospectionConfig configures an IntrospectionVerifier.
+type IntrospectionConfig struct {
+	// URL of the endpoint, e.g. https://host/kidneysmart-auth/v1/introspect.
+	URL string
+	// HTTPClient calls the endpoint. Defaults to a client with a 5 second timeout.
+	HTTPClient *http.Client
+	// CacheTTL is how long an active token is remembered. Defaults to 30 seconds,
+	// a negative value disables the cache. Revoked tokens stay accepted for up to this long.
+	CacheTTL time.Duration
+}
+
+// IntrospectionVerifier asks the auth service whether a token is active. It suits
+// services that must not hold key material or need to see revocations quickly.
+// It is safe for concurrent use.
+type IntrospectionVerifier struct {
+	cfg IntrospectionConfig
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedClaims
+}
+
+type cachedClaims struct {
+	claims  *Claims
+	expires time.Time
+}
+
+// statusErrors maps the status of an inactive token back to the error behind it.
+var statusErrors = map[string]error{
+	"TOKEN_EXPIRED":            ErrTokenExpired,
+	"INVALID_TOKEN":            ErrInvalidToken,
+	"USER_ID_NOT_FOUND":        ErrUserIDNotFound,
+	"INVALID_TOKEN_SIGNATURE":  ErrTokenSignatureInvalid,
+	"ACCOUNT_SUSPENDED":        ErrAccountSuspended,
+	"ACCOUNT_PENDING_DELETION": ErrAccountPendingDeletion,
+}
+
+// NewIntrospectionVerifier returns a verifier calling the endpoint at cfg.URL.
+func NewIntrospectionVerifier(cfg IntrospectionConfig) *IntrospectionVerifier {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	if cfg.CacheTTL == 0 {
+		cfg.CacheTTL = defaultIntrospectionCacheTTL
+	}
+	return &IntrospectionVerifier{cfg: cfg, cache: make(map[[sha256.Size]byte]cachedClaims)}
+}
+
+func (v *IntrospectionVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	key := sha256.Sum256([]byte(token))
+	if claims, ok := v.cached(key); ok {
+		return claims, nil
+	}
+
+	resp, err := v.introspect(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerifierUnavailable, err)
+	}
+	if !resp.Active {
+		if err, ok := statusErrors[resp.Status]; ok {
+			return nil, err
+		}
+		return nil, ErrInvalidToken
+	}
+
+	claims := &Claims{
+		UserID:    resp.Sub,
+		ClientID:  resp.ClientID,
+		TokenType: resp.TokenType,
+		Scopes:    strings.Fields(resp.Scope),
+		Roles:     resp.Roles,
+		ExpiresAt: time.Unix(resp.Exp, 0).UTC(),
+	}
+	v.store(key, claims)
+	return claims, nil
+}
+
+func (v *IntrospectionVerifier) introspect(ctx context.Context, token string) (*model.ResponseIntrospect, error) {
+	form := url.Values{"token": {token}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	httpResp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection returned %s", httpResp.Status)
+	}
+
+	var resp model.ResponseIntrospect
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decoding introspection response: %w", err)
+	}
+	return &resp, nil
+}
+
+func (v *IntrospectionVerifier) cached(key [sha256.Size]byte) (*Claims, bool) {
+	if v.cfg.CacheTTL < 0 {
+		return nil, false
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	entry, ok := v.cache[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.claims, true
+}
+
+func (v *IntrospectionVerifier) store(key [sha256.Size]byte, claims *Claims) {
+	if v.cfg.CacheTTL < 0 {
+		return
+	}
+	expires := time.Now().Add(v.cfg.CacheTTL)
+	if !claims.ExpiresAt.IsZero() && claims.ExpiresAt.Before(expires) {
+		expires = claims.ExpiresAt
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(v.cache) >= maxIntrospectionCacheSize {
+		now := time.Now()
+		for k, entry := range v.cache {
+			if now.After(entry.expires) {
+				delete(v.cache, k)
+			}
+		}
+		// Still full: start over rather than grow without bound
+		if len(v.cache) >= maxIntrospectionCacheSize {
+			v.cache = make(map[[sha256.Size]byte]cachedClaims)
+		}
+	}
+	v.cache[key] = cachedClaims{claims: claims, expires: expires}
+}
@@ -0,0 +1,181 @@
+package authmw
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultJWKSRefreshInterval = 10 * time.Minute
+	defaultJWKSMinRefetch      = 30 * time.Second
+	defaultHTTPTimeout         = 5 * time.Second
+)
+
+// JWKSConfig configures a JWKSVerifier.
+type JWKSConfig struct {
+	// URL of the key set, e.g. https://host/kidneysmart-auth/.well-known/jwks.json.
+	URL string
+	// HTTPClient fetches the key set. Defaults to a client with a 5 second timeout.
+	HTTPClient *http.Client
+	// RefreshInterval is how long a fetched key set is used. Defaults to 10 minutes.
+	RefreshInterval time.Duration
+	// MinRefetchInterval limits how often a token with an unknown key ID triggers
+	// a fetch. Defaults to 30 seconds.
+	MinRefetchInterval time.Duration
+	// HMACSecret, if set, also accepts tokens signed with the shared HS256 secret,
+	// which the auth service uses until the first key rotation.
+	HMACSecret string
+}
+
+// JWKSVerifier verifies ES256 tokens locally with the public keys published by the
+// auth service. The key set is cached and fetched again when it gets old or when a
+// token names a key that is not cached yet, e.g. right after a rotation.
+// It is safe for concurrent use.
+type JWKSVerifier struct {
+	cfg JWKSConfig
+
+	mu          sync.Mutex
+	keys        map[string]*ecdsa.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// NewJWKSVerifier returns a verifier for the key set at cfg.URL. Nothing is fetched
+// until the first token is verified.
+func NewJWKSVerifier(cfg JWKSConfig) *JWKSVerifier {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultJWKSRefreshInterval
+	}
+	if cfg.MinRefetchInterval <= 0 {
+		cfg.MinRefetchInterval = defaultJWKSMinRefetch
+	}
+	return &JWKSVerifier{cfg: cfg}
+}
+
+func (v *JWKSVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	keys := &jwksKeys{verifier: v, ctx: ctx}
+	claims, err := utils.ParseClaims(token, keys, "access")
+	if err != nil {
+		if keys.fetchErr != nil {
+			return nil, fmt.Errorf("%w: %v", ErrVerifierUnavailable, keys.fetchErr)
+		}
+		return nil, err
+	}
+	return ClaimsFromJWT(claims)
+}
+
+// key returns the public key with the given ID, fetching the key set if it is
+// stale or does not contain the key.
+func (v *JWKSVerifier) key(ctx context.Context, kid string) (*ecdsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	key, ok := v.keys[kid]
+	stale := now.Sub(v.fetchedAt) > v.cfg.RefreshInterval
+	if ok && !stale {
+		return key, nil
+	}
+	if !stale && now.Sub(v.lastAttempt) < v.cfg.MinRefetchInterval {
+		return nil, nil
+	}
+
+	v.lastAttempt = now
+	keys, err := fetchJWKS(ctx, v.cfg.HTTPClient, v.cfg.URL)
+	if err != nil {
+		// A stale key set is better than none while the auth service is unreachable
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+		return nil, err
+	}
+	v.keys = keys
+	v.fetchedAt = now
+	return v.keys[kid], nil
+}
+
+// jwksKeys adapts the verifier to utils.TokenVerifier for a single token.
+type jwksKeys struct {
+	verifier *JWKSVerifier
+	ctx      context.Context
+	fetchErr error
+}
+
+func (k *jwksKeys) VerificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if k.verifier.cfg.HMACSecret != "" {
+			return utils.HMACSecret(k.verifier.cfg.HMACSecret).VerificationKey(token)
+		}
+	case *jwt.SigningMethodECDSA:
+		kid, _ := token.Header["kid"].(string)
+		key, err := k.verifier.key(k.ctx, kid)
+		if err != nil {
+			k.fetchErr = err
+			return nil, err
+		}
+		if key != nil {
+			return key, nil
+		}
+	}
+	return nil, utils.ErrTokenSignatureInvalid
+}
+
+// jsonWebKey is the subset of RFC 7517 used by the auth service.
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+	KeyID   string `json:"kid"`
+}
+
+func fetchJWKS(ctx context.Context, client *http.Client, url string) (map[string]*ecdsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", url, resp.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decoding key set: %w", err)
+	}
+
+	keys := make(map[string]*ecdsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.KeyType != "EC" || jwk.Curve != "P-256" {
+			continue
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+		y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if errX != nil || errY != nil {
+			continue
+		}
+		keys[jwk.KeyID] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	}
+	return keys, nil
+}
@@ -0,0 +1,26 @@
+package authmw
+
+import (
+	"context"
+
+	"github.com/a-dev-mobile/kidneysmart-auth/internal/utils"
+)
+
+// KeyVerifier verifies tokens in-process with the given keys. The auth service
+// uses it with its own signing keys.
+type KeyVerifier struct {
+	keys utils.TokenVerifier
+}
+
+// NewKeyVerifier returns a Verifier checking signatures with keys.
+func NewKeyVerifier(keys utils.TokenVerifier) *KeyVerifier {
+	return &KeyVerifier{keys: keys}
+}
+
+func (v *KeyVerifier) Verify(_ context.Context, token string) (*Claims, error) {
+	claims, err := utils.ParseClaims(token, v.keys, "access")
+	if err != nil {
+		return nil, err
+	}
+	return ClaimsFromJWT(claims)
+}
@@ -20,7 +20,9 @@ func NewEmailClient(conn *grpc.ClientConn, lg *slog.Logger) *EmailClient {
 	}
 }
 
-func (s *EmailClient) SendEmail(recipient, subject, fromName, fromEmail, body string) error {
+// SendEmail sends the email through the email-sender service. The context carries the
+// deadline and the trace context of the calling request to the remote side.
+func (s *EmailClient) SendEmail(ctx context.Context, recipient, subject, fromName, fromEmail, body string) error {
 	req := &pb.EmailSenderRequest{
 		RecipientEmail: recipient,
 		Subject:        subject,
@@ -29,9 +31,9 @@ func (s *EmailClient) SendEmail(recipient, subject, fromName, fromEmail, body st
 		Body:           body,
 	}
 
-	_, err := s.client.SendEmail(context.Background(), req)
+	_, err := s.client.SendEmail(ctx, req)
 	if err != nil {
-		s.Logger.Warn("could not send email:","error", err)
+		s.Logger.WarnContext(ctx, "could not send email:","error", err)
 		return err
 	}
 